@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -9,6 +10,38 @@ import (
 type ASTNode interface {
 	String() string
 	Accept(visitor ASTVisitor) (interface{}, error)
+	Location() Location
+	SetLocation(loc Location)
+}
+
+// Location is the source range of a node as character offsets into the
+// expression, Stop is exclusive
+type Location struct {
+	Start int
+	Stop  int
+}
+
+// NoLocation is the location of nodes that do not come from the source
+var NoLocation = Location{Start: -1, Stop: -1}
+
+func (l Location) IsValid() bool {
+	return l.Start >= 0 && l.Stop >= l.Start
+}
+
+// located is embedded by all nodes to record where they come from
+type located struct {
+	loc *Location
+}
+
+func (n *located) Location() Location {
+	if n.loc == nil {
+		return NoLocation
+	}
+	return *n.loc
+}
+
+func (n *located) SetLocation(loc Location) {
+	n.loc = &loc
 }
 
 // ASTVisitor visitor pattern interface
@@ -22,10 +55,15 @@ type ASTVisitor interface {
 	VisitList(node *ListNode) (interface{}, error)
 	VisitMap(node *MapNode) (interface{}, error)
 	VisitStruct(node *StructNode) (interface{}, error)
+	VisitComprehension(node *ComprehensionNode) (interface{}, error)
+	VisitPresenceTest(node *PresenceTestNode) (interface{}, error)
+	VisitBind(node *BindNode) (interface{}, error)
 }
 
 // LiteralNode literal value node
 type LiteralNode struct {
+	located
+
 	Value Value
 }
 
@@ -39,6 +77,8 @@ func (n *LiteralNode) Accept(visitor ASTVisitor) (interface{}, error) {
 
 // IdentNode identifier node
 type IdentNode struct {
+	located
+
 	Name       string
 	LeadingDot bool // whether there is a leading dot (.identifier)
 }
@@ -56,6 +96,8 @@ func (n *IdentNode) Accept(visitor ASTVisitor) (interface{}, error) {
 
 // MemberAccessNode member access node (obj.member)
 type MemberAccessNode struct {
+	located
+
 	Object   ASTNode
 	Member   string
 	Optional bool // whether it's optional access (obj.?member)
@@ -75,6 +117,8 @@ func (n *MemberAccessNode) Accept(visitor ASTVisitor) (interface{}, error) {
 
 // FunctionCallNode function call node
 type FunctionCallNode struct {
+	located
+
 	Function ASTNode   // function expression, can be identifier or member access
 	Args     []ASTNode // argument list
 }
@@ -93,6 +137,8 @@ func (n *FunctionCallNode) Accept(visitor ASTVisitor) (interface{}, error) {
 
 // IndexNode index access node (obj[index])
 type IndexNode struct {
+	located
+
 	Object   ASTNode
 	Index    ASTNode
 	Optional bool // whether it's optional index (obj[?index])
@@ -112,6 +158,8 @@ func (n *IndexNode) Accept(visitor ASTVisitor) (interface{}, error) {
 
 // ConditionalNode conditional expression node (condition ? trueExpr : falseExpr)
 type ConditionalNode struct {
+	located
+
 	Condition ASTNode
 	TrueExpr  ASTNode
 	FalseExpr ASTNode
@@ -127,13 +175,26 @@ func (n *ConditionalNode) Accept(visitor ASTVisitor) (interface{}, error) {
 
 // ListNode list literal node
 type ListNode struct {
+	located
+
 	Elements []ASTNode
+	// OptionalIndices are the indices of the optional elements ([?elem]),
+	// which are left out of the list when they are absent
+	OptionalIndices []int
+}
+
+// IsOptional reports whether the element at index i is optional
+func (n *ListNode) IsOptional(i int) bool {
+	return slices.Contains(n.OptionalIndices, i)
 }
 
 func (n *ListNode) String() string {
 	elements := make([]string, len(n.Elements))
 	for i, elem := range n.Elements {
 		elements[i] = elem.String()
+		if n.IsOptional(i) {
+			elements[i] = "?" + elements[i]
+		}
 	}
 	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
 }
@@ -144,13 +205,19 @@ func (n *ListNode) Accept(visitor ASTVisitor) (interface{}, error) {
 
 // MapNode map literal node
 type MapNode struct {
+	located
+
 	Entries []MapEntry
 }
 
 func (n *MapNode) String() string {
 	entries := make([]string, len(n.Entries))
 	for i, entry := range n.Entries {
-		entries[i] = fmt.Sprintf("%s: %s", entry.Key.String(), entry.Value.String())
+		opt := ""
+		if entry.Optional {
+			opt = "?"
+		}
+		entries[i] = fmt.Sprintf("%s%s: %s", opt, entry.Key.String(), entry.Value.String())
 	}
 	return fmt.Sprintf("{%s}", strings.Join(entries, ", "))
 }
@@ -168,6 +235,8 @@ type MapEntry struct {
 
 // StructNode struct literal node (Message{field: value})
 type StructNode struct {
+	located
+
 	TypeName      string
 	Fields        []StructField
 	ReceiverStyle bool // whether there is a leading dot (.Message{})
@@ -200,11 +269,86 @@ type StructField struct {
 	Optional bool
 }
 
+// ComprehensionNode comprehension node, produced by macro expansion (list.all(x, p))
+//
+// For each element of IterRange, IterVar is bound to the element (the key for maps),
+// LoopCondition is evaluated and the loop stops when it is false, otherwise
+// LoopStep is evaluated and becomes the new value of AccuVar. Result is evaluated
+// with AccuVar in scope once the loop ends.
+type ComprehensionNode struct {
+	located
+
+	IterVar       string
+	IterRange     ASTNode
+	AccuVar       string
+	AccuInit      ASTNode
+	LoopCondition ASTNode
+	LoopStep      ASTNode
+	Result        ASTNode
+}
+
+func (n *ComprehensionNode) String() string {
+	return fmt.Sprintf("__comprehension__(%s, %s, %s, %s, %s, %s, %s)",
+		n.IterVar, n.IterRange.String(), n.AccuVar, n.AccuInit.String(),
+		n.LoopCondition.String(), n.LoopStep.String(), n.Result.String())
+}
+
+func (n *ComprehensionNode) Accept(visitor ASTVisitor) (interface{}, error) {
+	return visitor.VisitComprehension(n)
+}
+
+// PresenceTestNode presence test node, produced by the has(obj.member) macro
+type PresenceTestNode struct {
+	located
+
+	Object ASTNode
+	Member string
+}
+
+func (n *PresenceTestNode) String() string {
+	return fmt.Sprintf("has(%s.%s)", n.Object.String(), n.Member)
+}
+
+func (n *PresenceTestNode) Accept(visitor ASTVisitor) (interface{}, error) {
+	return visitor.VisitPresenceTest(n)
+}
+
+// BindNode binds a local variable, produced by the bind(name, init, expr) macro
+//
+// Init is evaluated once, then Result is evaluated with Name bound to its
+// value, shadowing variables of the same name.
+type BindNode struct {
+	located
+
+	Name   string
+	Init   ASTNode
+	Result ASTNode
+}
+
+func (n *BindNode) String() string {
+	return fmt.Sprintf("bind(%s, %s, %s)", n.Name, n.Init.String(), n.Result.String())
+}
+
+func (n *BindNode) Accept(visitor ASTVisitor) (interface{}, error) {
+	return visitor.VisitBind(n)
+}
+
 // Convenience functions for creating AST nodes
 func NewLiteral(value Value) *LiteralNode {
 	return &LiteralNode{Value: value}
 }
 
+// IsLiteralValue reports whether value can be written as a literal in source,
+// folded subexpressions are only replaced by such values
+func IsLiteralValue(value Value) bool {
+	switch value.(type) {
+	case *BoolValue, *IntValue, *UintValue, *DoubleValue,
+		*StringValue, *BytesValue, *NullValue:
+		return true
+	}
+	return false
+}
+
 func NewIdent(name string, leadingDot bool) *IdentNode {
 	return &IdentNode{Name: name, LeadingDot: leadingDot}
 }
@@ -244,3 +388,23 @@ func NewStruct(typeName string, fields []StructField, receiverStyle bool) *Struc
 		ReceiverStyle: receiverStyle,
 	}
 }
+
+func NewComprehension(iterVar string, iterRange ASTNode, accuVar string, accuInit, loopCondition, loopStep, result ASTNode) *ComprehensionNode {
+	return &ComprehensionNode{
+		IterVar:       iterVar,
+		IterRange:     iterRange,
+		AccuVar:       accuVar,
+		AccuInit:      accuInit,
+		LoopCondition: loopCondition,
+		LoopStep:      loopStep,
+		Result:        result,
+	}
+}
+
+func NewPresenceTest(object ASTNode, member string) *PresenceTestNode {
+	return &PresenceTestNode{Object: object, Member: member}
+}
+
+func NewBind(name string, init, result ASTNode) *BindNode {
+	return &BindNode{Name: name, Init: init, Result: result}
+}
@@ -0,0 +1,120 @@
+package ast
+
+import "math"
+
+// CostFunction returns the cost of calling a function with the given arguments
+type CostFunction func(args []Value) uint64
+
+// CallCoster is implemented by functions whose call cost depends on the arguments,
+// calls to other functions cost 1
+type CallCoster interface {
+	Cost(args []Value) uint64
+}
+
+// SizeEstimate is the range of sizes a value may have, see ValueSize
+type SizeEstimate struct {
+	Min uint64
+	Max uint64
+}
+
+// CostEstimate is the range of costs an evaluation may have
+type CostEstimate struct {
+	Min uint64
+	Max uint64
+}
+
+// CostHint estimates the cost of a call from the sizes of its arguments,
+// a nil CostHint costs 1
+type CostHint func(sizes []SizeEstimate) CostEstimate
+
+// UnknownSize is the size estimate of values without any size information
+var UnknownSize = SizeEstimate{Min: 0, Max: math.MaxUint64}
+
+// Add adds two estimates, saturating at math.MaxUint64
+func (c CostEstimate) Add(other CostEstimate) CostEstimate {
+	return CostEstimate{Min: addUint64(c.Min, other.Min), Max: addUint64(c.Max, other.Max)}
+}
+
+// Multiply multiplies the estimate by a size range, saturating at math.MaxUint64
+func (c CostEstimate) Multiply(size SizeEstimate) CostEstimate {
+	return CostEstimate{Min: mulUint64(c.Min, size.Min), Max: mulUint64(c.Max, size.Max)}
+}
+
+// Union returns the range covering both estimates
+func (c CostEstimate) Union(other CostEstimate) CostEstimate {
+	return CostEstimate{Min: min(c.Min, other.Min), Max: max(c.Max, other.Max)}
+}
+
+// Add adds two estimates, saturating at math.MaxUint64
+func (s SizeEstimate) Add(other SizeEstimate) SizeEstimate {
+	return SizeEstimate{Min: addUint64(s.Min, other.Min), Max: addUint64(s.Max, other.Max)}
+}
+
+// Union returns the range covering both estimates
+func (s SizeEstimate) Union(other SizeEstimate) SizeEstimate {
+	return SizeEstimate{Min: min(s.Min, other.Min), Max: max(s.Max, other.Max)}
+}
+
+func addUint64(x, y uint64) uint64 {
+	if x > math.MaxUint64-y {
+		return math.MaxUint64
+	}
+	return x + y
+}
+
+func mulUint64(x, y uint64) uint64 {
+	if x != 0 && y > math.MaxUint64/x {
+		return math.MaxUint64
+	}
+	return x * y
+}
+
+func mulFactor(x uint64, factor float64) uint64 {
+	f := float64(x) * factor
+	if f >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(f)
+}
+
+// ValueSize returns the size of a value used in cost calculation, that is the
+// length of strings, bytes, lists and maps, and 1 for other values
+func ValueSize(v Value) uint64 {
+	switch val := v.(type) {
+	case *StringValue:
+		return uint64(len(val.StringValue))
+	case *BytesValue:
+		return uint64(len(val.BytesValue))
+	case *ListValue:
+		return uint64(len(val.ListValue))
+	case *MapValue:
+		return uint64(len(val.MapValue))
+	default:
+		return 1
+	}
+}
+
+// LinearCost returns a CostFunction that grows linearly with the total size of the arguments
+func LinearCost(factor float64) CostFunction {
+	return func(args []Value) uint64 {
+		var size uint64
+		for _, arg := range args {
+			size = addUint64(size, ValueSize(arg))
+		}
+		return addUint64(1, mulFactor(size, factor))
+	}
+}
+
+// LinearCostHint is the CostHint of LinearCost
+func LinearCostHint(factor float64) CostHint {
+	return func(sizes []SizeEstimate) CostEstimate {
+		var size SizeEstimate
+		for _, s := range sizes {
+			size = size.Add(s)
+		}
+		return CostEstimate{
+			Min: addUint64(1, mulFactor(size.Min, factor)),
+			Max: addUint64(1, mulFactor(size.Max, factor)),
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ast
 import (
 	"fmt"
 	"math"
+	"slices"
 )
 
 const (
@@ -41,11 +42,24 @@ type Function interface {
 	Call(args []Value) (Value, error)
 }
 
+// Purity is implemented by functions that know whether they always return the
+// same result for the same arguments, functions without it are assumed impure
+type Purity interface {
+	Pure() bool
+}
+
 type FunctionCall func(args []Value) (Value, error)
 
 type Definition struct {
 	Type FunctionType
 	Call FunctionCall
+	// Cost of a call, nil costs 1
+	Cost CostFunction
+	// CostHint estimates Cost before running, nil costs 1
+	CostHint CostHint
+	// Pure is set when the result only depends on the arguments, calls of
+	// pure definitions with constant arguments may be folded into constants
+	Pure bool
 }
 
 type BaseFunction struct {
@@ -66,12 +80,59 @@ func (f *BaseFunction) Types() []FunctionType {
 }
 
 func (f *BaseFunction) Call(args []Value) (Value, error) {
+	d, err := f.match(args)
+	if err != nil {
+		return nil, err
+	}
+	return d.Call(ConvertArgs(d.Type.ParamTypes(), args))
+}
+
+// ConvertArgs converts the arguments of map parameters that are not maps, see
+// MapConvertible
+func ConvertArgs(params []ValueType, args []Value) []Value {
+	var converted []Value
+	for i, arg := range args {
+		if _, ok := params[i].(*MapType); !ok {
+			continue
+		}
+		if m, ok := arg.(MapConvertible); ok {
+			if converted == nil {
+				converted = slices.Clone(args)
+			}
+			converted[i] = m.ToMap()
+		}
+	}
+	if converted == nil {
+		return args
+	}
+	return converted
+}
+
+func (f *BaseFunction) Cost(args []Value) uint64 {
+	d, err := f.match(args)
+	if err != nil || d.Cost == nil {
+		return 1
+	}
+	return d.Cost(args)
+}
+
+// Pure reports whether all the definitions of the function are pure
+func (f *BaseFunction) Pure() bool {
+	for _, d := range f.Definitions {
+		if !d.Pure {
+			return false
+		}
+	}
+	return len(f.Definitions) > 0
+}
+
+func (f *BaseFunction) match(args []Value) (*Definition, error) {
 	var argTypes []ValueType
 	for _, arg := range args {
 		argTypes = append(argTypes, arg.Type())
 	}
 
-	for _, d := range f.Definitions {
+	for i, d := range f.Definitions {
 		ft := d.Type.ParamTypes()
 
 		if len(ft) != len(args) {
@@ -83,8 +144,7 @@ func (f *BaseFunction) Call(args []Value) (Value, error) {
 			continue
 		}
 
-		return d.Call(args)
-
+		return &f.Definitions[i], nil
 	}
 	return nil, fmt.Errorf("no matching function definition found, with args %v", argTypes)
 }
@@ -113,6 +173,14 @@ func NewBaseFunction(name string, d []Definition) *BaseFunction {
 	return &BaseFunction{name: name, Definitions: d}
 }
 
+// NewPureFunction is NewBaseFunction with all the definitions marked pure
+func NewPureFunction(name string, d []Definition) *BaseFunction {
+	for i := range d {
+		d[i].Pure = true
+	}
+	return NewBaseFunction(name, d)
+}
+
 const ValueTypeParamTypeType = "param"
 
 type ValueTypeParamType struct {
@@ -171,6 +239,20 @@ func ResolveDynamicType(env map[string]ValueType, dyn ValueType, rt ValueType) (
 			return nil, err
 		}
 		return NewMapType(key, value), nil
+	case *OptionalType:
+		var innerType ValueType
+		if rt != nil {
+			o, ok := rt.(*OptionalType)
+			if !ok {
+				return nil, fmt.Errorf("cannot resolve dynamic type %s to %s", dyn.String(), rt.String())
+			}
+			innerType = o.ElementType()
+		}
+		result, err := ResolveDynamicType(env, dyn.ElementType(), innerType)
+		if err != nil {
+			return nil, err
+		}
+		return NewOptionalType(result), nil
 	default:
 		t, ok := env[dyn.Kind()]
 		if rt == nil {
@@ -221,7 +303,7 @@ var (
 	listOfA = NewListType(paramA)
 	mapOfAB = NewMapType(paramA, paramB)
 
-	LogicalAndFunction = NewBaseFunction(
+	LogicalAndFunction = NewPureFunction(
 		LogicalAnd,
 		[]Definition{
 			{
@@ -233,7 +315,7 @@ var (
 		},
 	)
 
-	LogicalOrFunction = NewBaseFunction(
+	LogicalOrFunction = NewPureFunction(
 		LogicalOr,
 		[]Definition{
 			{
@@ -245,7 +327,7 @@ var (
 		},
 	)
 
-	LogicalNotFunction = NewBaseFunction(
+	LogicalNotFunction = NewPureFunction(
 		LogicalNot,
 		[]Definition{
 			{
@@ -257,7 +339,7 @@ var (
 		},
 	)
 
-	EqualsFunction = NewBaseFunction(
+	EqualsFunction = NewPureFunction(
 		Equals,
 		[]Definition{
 			{
@@ -269,7 +351,7 @@ var (
 		},
 	)
 
-	NotEqualsFunction = NewBaseFunction(
+	NotEqualsFunction = NewPureFunction(
 		NotEquals,
 		[]Definition{
 			{
@@ -281,7 +363,7 @@ var (
 		},
 	)
 
-	AddFunction = NewBaseFunction(
+	AddFunction = NewPureFunction(
 		Add,
 		[]Definition{
 			{
@@ -289,8 +371,10 @@ var (
 				Call: func(args []Value) (Value, error) {
 					x := args[0].(*BytesValue).BytesValue
 					y := args[1].(*BytesValue).BytesValue
-					return NewBytesValue(append(x, y...)), nil
+					return NewBytesValue(slices.Concat(x, y)), nil
 				},
+				Cost:     LinearCost(0.1),
+				CostHint: LinearCostHint(0.1),
 			},
 			{
 				Type: *NewFunctionType(Add, []ValueType{DoubleType, DoubleType}, DoubleType),
@@ -325,17 +409,21 @@ var (
 				Call: func(args []Value) (Value, error) {
 					return NewStringValue(args[0].(*StringValue).StringValue + args[1].(*StringValue).StringValue), nil
 				},
+				Cost:     LinearCost(0.1),
+				CostHint: LinearCostHint(0.1),
 			},
 			{
 				Type: *NewFunctionType(Add, []ValueType{listOfA, listOfA}, listOfA),
 				Call: func(args []Value) (Value, error) {
-					return NewListValue(append(args[0].(*ListValue).ListValue, args[1].(*ListValue).ListValue...), args[0].(*ListValue).ElementType()), nil
+					return NewListValue(slices.Concat(args[0].(*ListValue).ListValue, args[1].(*ListValue).ListValue), args[0].(*ListValue).ElementType()), nil
 				},
+				Cost:     LinearCost(1),
+				CostHint: LinearCostHint(1),
 			},
 		},
 	)
 
-	SubtractFunction = NewBaseFunction(
+	SubtractFunction = NewPureFunction(
 		Subtract,
 		[]Definition{
 			{
@@ -369,7 +457,7 @@ var (
 		},
 	)
 
-	MultiplyFunction = NewBaseFunction(
+	MultiplyFunction = NewPureFunction(
 		Multiply,
 		[]Definition{
 			{
@@ -411,7 +499,7 @@ var (
 		},
 	)
 
-	DivideFunction = NewBaseFunction(
+	DivideFunction = NewPureFunction(
 		Divide,
 		[]Definition{
 			{
@@ -446,7 +534,7 @@ var (
 		},
 	)
 
-	ModuloFunction = NewBaseFunction(
+	ModuloFunction = NewPureFunction(
 		Modulo,
 		[]Definition{
 			{
@@ -475,7 +563,7 @@ var (
 		},
 	)
 
-	NegateFunction = NewBaseFunction(
+	NegateFunction = NewPureFunction(
 		Negate,
 		[]Definition{
 			{
@@ -497,7 +585,7 @@ var (
 		},
 	)
 
-	LessFunction = NewBaseFunction(
+	LessFunction = NewPureFunction(
 		Less,
 		[]Definition{
 			{
@@ -557,7 +645,7 @@ var (
 		},
 	)
 
-	LessEqualsFunction = NewBaseFunction(
+	LessEqualsFunction = NewPureFunction(
 		LessEquals,
 		[]Definition{
 			{
@@ -617,7 +705,7 @@ var (
 		},
 	)
 
-	GreaterFunction = NewBaseFunction(
+	GreaterFunction = NewPureFunction(
 		Greater,
 		[]Definition{
 			{
@@ -677,7 +765,7 @@ var (
 		},
 	)
 
-	GreaterEqualsFunction = NewBaseFunction(
+	GreaterEqualsFunction = NewPureFunction(
 		GreaterEquals,
 		[]Definition{
 			{
@@ -737,7 +825,7 @@ var (
 		},
 	)
 
-	InFunction = NewBaseFunction(
+	InFunction = NewPureFunction(
 		In,
 		[]Definition{
 			{
@@ -754,6 +842,8 @@ var (
 					}
 					return NewBoolValue(false), nil
 				},
+				Cost:     LinearCost(1),
+				CostHint: LinearCostHint(1),
 			},
 			{
 				Type: *NewFunctionType(In, []ValueType{paramA, mapOfAB}, BoolType),
@@ -769,7 +859,7 @@ var (
 		},
 	)
 
-	SizeFunction = NewBaseFunction(
+	SizeFunction = NewPureFunction(
 		Size, []Definition{
 			{
 				Type: *NewFunctionType(Size, []ValueType{BytesType}, IntType),
@@ -798,7 +888,7 @@ var (
 		},
 	)
 
-	TypeFunction = NewBaseFunction(
+	TypeFunction = NewPureFunction(
 		Type,
 		[]Definition{
 			{
@@ -810,7 +900,7 @@ var (
 		},
 	)
 
-	BoolFunction = NewBaseFunction(
+	BoolFunction = NewPureFunction(
 		Bool,
 		[]Definition{
 			{
@@ -828,7 +918,7 @@ var (
 		},
 	)
 
-	BytesFunction = NewBaseFunction(
+	BytesFunction = NewPureFunction(
 		Bytes,
 		[]Definition{
 			{
@@ -846,7 +936,7 @@ var (
 		},
 	)
 
-	DoubleFunction = NewBaseFunction(
+	DoubleFunction = NewPureFunction(
 		Double,
 		[]Definition{
 			{
@@ -876,7 +966,7 @@ var (
 		},
 	)
 
-	IntFunction = NewBaseFunction(
+	IntFunction = NewPureFunction(
 		Int,
 		[]Definition{
 			{
@@ -906,7 +996,7 @@ var (
 		},
 	)
 
-	UintFunction = NewBaseFunction(
+	UintFunction = NewPureFunction(
 		Uint,
 		[]Definition{
 			{
@@ -936,7 +1026,7 @@ var (
 		},
 	)
 
-	StringFunction = NewBaseFunction(
+	StringFunction = NewPureFunction(
 		String,
 		[]Definition{
 			{
@@ -1005,4 +1095,12 @@ var BuiltinFunctions = map[string]Function{
 	Int:    IntFunction,
 	Uint:   UintFunction,
 	String: StringFunction,
+
+	OptionalOf:             OptionalOfFunction,
+	OptionalNone:           OptionalNoneFunction,
+	OptionalOfNonZeroValue: OptionalOfNonZeroValueFunction,
+	HasValue:               HasValueFunction,
+	OptionalValueOf:        OptionalValueFunction,
+	OrValue:                OrValueFunction,
+	Or:                     OrFunction,
 }
@@ -0,0 +1,207 @@
+package ast
+
+import (
+	"fmt"
+)
+
+const (
+	TypeKindOptional = "optional_type"
+
+	OptionalOf             = "optional.of"
+	OptionalNone           = "optional.none"
+	OptionalOfNonZeroValue = "optional.ofNonZeroValue"
+	HasValue               = "hasValue"
+	OptionalValueOf        = "value"
+	OrValue                = "orValue"
+	Or                     = "or"
+)
+
+// OptionalType is the type of values that may be absent, e.g. the result of
+// obj.?field or list[?i]
+type OptionalType struct {
+	*PrimitiveType
+	elementType ValueType
+}
+
+func (t *OptionalType) Equals(other ValueType) bool {
+	if other.Kind() == TypeKindAny {
+		return true
+	}
+
+	if o, ok := other.(*OptionalType); ok {
+		return t.elementType.Equals(o.elementType)
+	}
+	return false
+}
+
+func (t *OptionalType) String() string {
+	return fmt.Sprintf("optional_type(%s)", t.elementType.String())
+}
+
+// ElementType is the type of the value when it is present
+func (t *OptionalType) ElementType() ValueType {
+	return t.elementType
+}
+
+func (t *OptionalType) IsDyn() bool {
+	return t.elementType.IsDyn()
+}
+
+func NewOptionalType(elementType ValueType) *OptionalType {
+	return &OptionalType{PrimitiveType: &PrimitiveType{kind: TypeKindOptional, traitMask: 0}, elementType: elementType}
+}
+
+// OptionalValue is a value that may be absent, Value is nil for
+// optional.none()
+type OptionalValue struct {
+	Value Value
+}
+
+func (v *OptionalValue) Type() ValueType {
+	if v.Value == nil {
+		return NewOptionalType(AnyType)
+	}
+	return NewOptionalType(v.Value.Type())
+}
+
+// Equal reports whether both values are absent, or both are present and equal
+func (v *OptionalValue) Equal(other Value) bool {
+	o, ok := other.(*OptionalValue)
+	if !ok {
+		return false
+	}
+	if v.Value == nil || o.Value == nil {
+		return v.Value == nil && o.Value == nil
+	}
+	return v.Value.Equal(o.Value)
+}
+
+func (v *OptionalValue) String() string {
+	if v.Value == nil {
+		return "optional.none()"
+	}
+	return fmt.Sprintf("optional.of(%s)", v.Value.String())
+}
+
+func (v *OptionalValue) HasValue() bool {
+	return v.Value != nil
+}
+
+// NewOptionalValue returns a present optional value
+func NewOptionalValue(v Value) *OptionalValue { return &OptionalValue{Value: v} }
+
+// NewOptionalNone returns an absent optional value
+func NewOptionalNone() *OptionalValue { return &OptionalValue{} }
+
+// isZeroValue reports whether v is null or the zero value of its type
+func isZeroValue(v Value) bool {
+	if _, ok := v.(*NullValue); ok {
+		return true
+	}
+	if s, ok := v.(*StructValue); ok {
+		return len(s.Fields) == 0
+	}
+	zero, ok := ZeroValue(v.Type())
+	return ok && zero.Equal(v)
+}
+
+var (
+	optionalOfA = NewOptionalType(paramA)
+
+	OptionalOfFunction = NewPureFunction(
+		OptionalOf,
+		[]Definition{
+			{
+				Type: *NewFunctionType(OptionalOf, []ValueType{paramA}, optionalOfA),
+				Call: func(args []Value) (Value, error) {
+					return NewOptionalValue(args[0]), nil
+				},
+			},
+		},
+	)
+
+	OptionalNoneFunction = NewPureFunction(
+		OptionalNone,
+		[]Definition{
+			{
+				Type: *NewFunctionType(OptionalNone, []ValueType{}, NewOptionalType(AnyType)),
+				Call: func(args []Value) (Value, error) {
+					return NewOptionalNone(), nil
+				},
+			},
+		},
+	)
+
+	OptionalOfNonZeroValueFunction = NewPureFunction(
+		OptionalOfNonZeroValue,
+		[]Definition{
+			{
+				Type: *NewFunctionType(OptionalOfNonZeroValue, []ValueType{paramA}, optionalOfA),
+				Call: func(args []Value) (Value, error) {
+					if isZeroValue(args[0]) {
+						return NewOptionalNone(), nil
+					}
+					return NewOptionalValue(args[0]), nil
+				},
+			},
+		},
+	)
+
+	HasValueFunction = NewPureFunction(
+		HasValue,
+		[]Definition{
+			{
+				Type: *NewFunctionType(HasValue, []ValueType{optionalOfA}, BoolType),
+				Call: func(args []Value) (Value, error) {
+					return NewBoolValue(args[0].(*OptionalValue).HasValue()), nil
+				},
+			},
+		},
+	)
+
+	OptionalValueFunction = NewPureFunction(
+		OptionalValueOf,
+		[]Definition{
+			{
+				Type: *NewFunctionType(OptionalValueOf, []ValueType{optionalOfA}, paramA),
+				Call: func(args []Value) (Value, error) {
+					v := args[0].(*OptionalValue)
+					if !v.HasValue() {
+						return nil, fmt.Errorf("optional.none() dereference")
+					}
+					return v.Value, nil
+				},
+			},
+		},
+	)
+
+	OrValueFunction = NewPureFunction(
+		OrValue,
+		[]Definition{
+			{
+				Type: *NewFunctionType(OrValue, []ValueType{optionalOfA, paramA}, paramA),
+				Call: func(args []Value) (Value, error) {
+					if v := args[0].(*OptionalValue); v.HasValue() {
+						return v.Value, nil
+					}
+					return args[1], nil
+				},
+			},
+		},
+	)
+
+	OrFunction = NewPureFunction(
+		Or,
+		[]Definition{
+			{
+				Type: *NewFunctionType(Or, []ValueType{optionalOfA, optionalOfA}, optionalOfA),
+				Call: func(args []Value) (Value, error) {
+					if v := args[0].(*OptionalValue); v.HasValue() {
+						return v, nil
+					}
+					return args[1], nil
+				},
+			},
+		},
+	)
+)
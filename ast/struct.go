@@ -0,0 +1,156 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StructType is a type whose values are built by struct expressions, e.g.
+// HTTPRequest{method: "POST"}. Member returns the type of a field, or nil when
+// the type has no such field.
+type StructType interface {
+	ValueType
+	// NewValue returns a value with the fields set, the other fields are unset
+	NewValue(fields map[string]Value) (Value, error)
+}
+
+// FieldConverter is implemented by struct types whose fields also accept values
+// of other types in struct expressions, NewValue converts them, e.g. a
+// map<string, string> for the headers of an HTTPRequest
+type FieldConverter interface {
+	// ConvertsField reports whether a value of type t can set the field name
+	ConvertsField(name string, t ValueType) bool
+}
+
+// SchemaType is a struct type declared by the types of its fields, its values
+// are StructValue
+type SchemaType struct {
+	*PrimitiveType
+	fields map[string]ValueType
+}
+
+func NewSchemaType(name string, fields map[string]ValueType) *SchemaType {
+	return &SchemaType{PrimitiveType: NewPrimitiveType(name, SelectorType), fields: fields}
+}
+
+func (t *SchemaType) Member(name string) ValueType {
+	return t.fields[name]
+}
+
+// Members returns the field names, sorted
+func (t *SchemaType) Members() []string {
+	names := make([]string, 0, len(t.fields))
+	for name := range t.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *SchemaType) NewValue(fields map[string]Value) (Value, error) {
+	for name, value := range fields {
+		fieldType, ok := t.fields[name]
+		if !ok {
+			return nil, fmt.Errorf("field %s not found in type %s", name, t.Kind())
+		}
+		if !value.Type().Equals(fieldType) {
+			return nil, fmt.Errorf("field %s of type %s cannot be %s", name, t.Kind(), value.Type().String())
+		}
+	}
+	return &StructValue{Fields: fields, structType: t}, nil
+}
+
+// StructValue is a value of a SchemaType, an unset field has the zero value of
+// its type
+type StructValue struct {
+	Fields     map[string]Value
+	structType *SchemaType
+}
+
+func (v *StructValue) Type() ValueType {
+	return v.structType
+}
+
+func (v *StructValue) String() string {
+	names := make([]string, 0, len(v.Fields))
+	for name := range v.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = fmt.Sprintf("%s: %s", name, v.Fields[name].String())
+	}
+	return fmt.Sprintf("%s{%s}", v.structType.Kind(), strings.Join(fields, ", "))
+}
+
+// Equal reports whether the values have the same type and fields, an unset
+// field equals its zero value
+func (v *StructValue) Equal(other Value) bool {
+	o, ok := other.(*StructValue)
+	if !ok || !v.structType.Equals(o.structType) {
+		return false
+	}
+	for _, name := range v.structType.Members() {
+		a, aok := v.Get(NewStringValue(name))
+		b, bok := o.Get(NewStringValue(name))
+		if aok != bok || (aok && !a.Equal(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *StructValue) Get(key Value) (Value, bool) {
+	name, ok := key.(*StringValue)
+	if !ok {
+		return nil, false
+	}
+	if value, ok := v.Fields[name.StringValue]; ok {
+		return value, true
+	}
+	fieldType, ok := v.structType.fields[name.StringValue]
+	if !ok {
+		return nil, false
+	}
+	return ZeroValue(fieldType)
+}
+
+// Has reports whether the field is set
+func (v *StructValue) Has(key Value) bool {
+	name, ok := key.(*StringValue)
+	if !ok {
+		return false
+	}
+	_, ok = v.Fields[name.StringValue]
+	return ok
+}
+
+// ZeroValue returns the zero value of the basic types, lists and maps
+func ZeroValue(t ValueType) (Value, bool) {
+	switch t.Kind() {
+	case TypeKindBool:
+		return NewBoolValue(false), true
+	case TypeKindInt:
+		return NewIntValue(0), true
+	case TypeKindUint:
+		return NewUintValue(0), true
+	case TypeKindDouble:
+		return NewDoubleValue(0), true
+	case TypeKindString:
+		return NewStringValue(""), true
+	case TypeKindBytes:
+		return NewBytesValue([]byte{}), true
+	case TypeKindNull:
+		return NewNullValue(), true
+	}
+	switch t := t.(type) {
+	case *ListType:
+		return NewListValue([]Value{}, t.ElementType()), true
+	case *MapType:
+		return NewMapValue(map[Value]Value{}, t.KeyType(), t.ValueType()), true
+	}
+	return nil, false
+}
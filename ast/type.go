@@ -41,6 +41,7 @@ const (
 	TypeKindNull     = "null_type"
 	TypeKindType     = "type"
 	TypeKindAny      = "any"
+	TypeKindError    = "error"
 )
 
 // Basic type implementation
@@ -244,6 +245,15 @@ var (
 			return true
 		},
 	}
+	// ErrorType is the type of expressions that failed to check, it is
+	// compatible with every type so that one mistake is reported only once
+	ErrorType = &PrimitiveType{
+		kind:      TypeKindError,
+		traitMask: 0,
+		equals: func(other ValueType) bool {
+			return true
+		},
+	}
 )
 
 // List type
@@ -279,6 +289,14 @@ func NewListType(elementType ValueType) *ListType {
 	return &ListType{PrimitiveType: &PrimitiveType{kind: TypeKindList, traitMask: 0}, elementType: elementType}
 }
 
+// KeyedType is the type of Keyed values, the map type and selector types that
+// are indexed with KeyType like a map
+type KeyedType interface {
+	ValueType
+	KeyType() ValueType
+	ValueType() ValueType
+}
+
 // Map type
 type MapType struct {
 	*PrimitiveType
@@ -291,8 +309,10 @@ func (t *MapType) Equals(other ValueType) bool {
 		return true
 	}
 
-	if o, ok := other.(*MapType); ok {
-		return t.keyType.Equals(o.keyType) && t.valueType.Equals(o.valueType)
+	// keyed types, e.g. HTTP headers, are accepted as maps of the same key and
+	// value types, see MapConvertible
+	if o, ok := other.(KeyedType); ok {
+		return t.keyType.Equals(o.KeyType()) && t.valueType.Equals(o.ValueType())
 	}
 	return false
 }
@@ -0,0 +1,54 @@
+package ast
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const TypeKindUnknown = "unknown"
+
+// UnknownType is the type of values that are not known yet in a partial
+// evaluation
+var UnknownType = NewPrimitiveType(TypeKindUnknown, 0)
+
+// UnknownValue is the value of an expression that depends on unknown
+// variables or members, Attributes are their paths, e.g. "response.body"
+type UnknownValue struct {
+	Attributes []string
+}
+
+func (v *UnknownValue) Type() ValueType { return UnknownType }
+
+func (v *UnknownValue) Equal(other Value) bool {
+	o, ok := other.(*UnknownValue)
+	return ok && slices.Equal(v.Attributes, o.Attributes)
+}
+
+func (v *UnknownValue) String() string {
+	return fmt.Sprintf("unknown(%s)", strings.Join(v.Attributes, ", "))
+}
+
+func NewUnknownValue(attributes ...string) *UnknownValue {
+	attributes = slices.Clone(attributes)
+	slices.Sort(attributes)
+	return &UnknownValue{Attributes: slices.Compact(attributes)}
+}
+
+// MergeUnknowns returns the unknown value with the attributes of all the
+// unknown values, it returns false when none is unknown. Nil values are
+// skipped.
+func MergeUnknowns(values ...Value) (*UnknownValue, bool) {
+	var attributes []string
+	found := false
+	for _, value := range values {
+		if u, ok := value.(*UnknownValue); ok {
+			attributes = append(attributes, u.Attributes...)
+			found = true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	return NewUnknownValue(attributes...), true
+}
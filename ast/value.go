@@ -1,6 +1,10 @@
 package ast
 
-import "fmt"
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
 
 // Value represents a runtime value
 type Value interface {
@@ -13,6 +17,19 @@ type Selector interface {
 	Get(key Value) (Value, bool)
 }
 
+// Keyed is implemented by selectors that can be indexed, iterated and tested
+// with in like a map, Keys returns the keys in iteration order
+type Keyed interface {
+	Selector
+	Keys() []Value
+}
+
+// FieldTester is implemented by selectors whose members always exist but may be
+// unset, has(obj.member) uses it instead of Get when available.
+type FieldTester interface {
+	Has(key Value) bool
+}
+
 // Basic value types
 type BoolValue struct {
 	BoolValue bool
@@ -128,7 +145,19 @@ type MapValue struct {
 }
 
 func (v *MapValue) Type() ValueType { return NewMapType(v.keyType, v.valueType) }
+
+// MapConvertible is implemented by keyed values that are also accepted as maps,
+// e.g. HTTP headers as a map<string, string>. They define their equality with
+// maps.
+type MapConvertible interface {
+	Value
+	ToMap() *MapValue
+}
+
 func (v *MapValue) Equal(other Value) bool {
+	if o, ok := other.(MapConvertible); ok {
+		return o.Equal(v)
+	}
 	if o, ok := other.(*MapValue); ok {
 		if len(v.MapValue) != len(o.MapValue) {
 			return false
@@ -155,6 +184,42 @@ func (v *MapValue) Get(key Value) (Value, bool) {
 	return nil, false
 }
 
+// Keys returns the keys sorted, so that comprehensions over maps are
+// deterministic
+func (v *MapValue) Keys() []Value {
+	keys := make([]Value, 0, len(v.MapValue))
+	for k := range v.MapValue {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, compareKeys)
+	return keys
+}
+
+// compareKeys orders map keys by type, then by value
+func compareKeys(a, b Value) int {
+	if c := cmp.Compare(a.Type().String(), b.Type().String()); c != 0 {
+		return c
+	}
+	switch x := a.(type) {
+	case *BoolValue:
+		if y, ok := b.(*BoolValue); ok && x.BoolValue != y.BoolValue {
+			if y.BoolValue {
+				return -1
+			}
+			return 1
+		}
+	case *IntValue:
+		if y, ok := b.(*IntValue); ok {
+			return cmp.Compare(x.IntValue, y.IntValue)
+		}
+	case *UintValue:
+		if y, ok := b.(*UintValue); ok {
+			return cmp.Compare(x.UintValue, y.UintValue)
+		}
+	}
+	return cmp.Compare(a.String(), b.String())
+}
+
 func (m *MapValue) Set(key Value, value Value) {
 	for k := range m.MapValue {
 		if k.Equal(key) {
@@ -0,0 +1,104 @@
+package ast
+
+// Children returns the direct child nodes of a node in source order
+func Children(node ASTNode) []ASTNode {
+	switch n := node.(type) {
+	case *MemberAccessNode:
+		return []ASTNode{n.Object}
+	case *FunctionCallNode:
+		return append([]ASTNode{n.Function}, n.Args...)
+	case *IndexNode:
+		return []ASTNode{n.Object, n.Index}
+	case *ConditionalNode:
+		return []ASTNode{n.Condition, n.TrueExpr, n.FalseExpr}
+	case *ListNode:
+		return n.Elements
+	case *MapNode:
+		children := make([]ASTNode, 0, len(n.Entries)*2)
+		for _, entry := range n.Entries {
+			children = append(children, entry.Key, entry.Value)
+		}
+		return children
+	case *StructNode:
+		children := make([]ASTNode, 0, len(n.Fields))
+		for _, field := range n.Fields {
+			children = append(children, field.Value)
+		}
+		return children
+	case *ComprehensionNode:
+		return []ASTNode{n.IterRange, n.AccuInit, n.LoopCondition, n.LoopStep, n.Result}
+	case *PresenceTestNode:
+		return []ASTNode{n.Object}
+	case *BindNode:
+		return []ASTNode{n.Init, n.Result}
+	}
+	return nil
+}
+
+// Walk visits node and its descendants depth-first, children are skipped when
+// fn returns false
+func Walk(node ASTNode, fn func(ASTNode) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	for _, child := range Children(node) {
+		Walk(child, fn)
+	}
+}
+
+// WithChildren returns a shallow copy of node with its direct children replaced,
+// children are in the order returned by Children
+func WithChildren(node ASTNode, children []ASTNode) ASTNode {
+	switch n := node.(type) {
+	case *MemberAccessNode:
+		c := *n
+		c.Object = children[0]
+		return &c
+	case *FunctionCallNode:
+		c := *n
+		c.Function = children[0]
+		c.Args = children[1:]
+		return &c
+	case *IndexNode:
+		c := *n
+		c.Object, c.Index = children[0], children[1]
+		return &c
+	case *ConditionalNode:
+		c := *n
+		c.Condition, c.TrueExpr, c.FalseExpr = children[0], children[1], children[2]
+		return &c
+	case *ListNode:
+		c := *n
+		c.Elements = children
+		return &c
+	case *MapNode:
+		c := *n
+		c.Entries = make([]MapEntry, len(n.Entries))
+		for i, entry := range n.Entries {
+			entry.Key, entry.Value = children[2*i], children[2*i+1]
+			c.Entries[i] = entry
+		}
+		return &c
+	case *StructNode:
+		c := *n
+		c.Fields = make([]StructField, len(n.Fields))
+		for i, field := range n.Fields {
+			field.Value = children[i]
+			c.Fields[i] = field
+		}
+		return &c
+	case *ComprehensionNode:
+		c := *n
+		c.IterRange, c.AccuInit, c.LoopCondition, c.LoopStep, c.Result = children[0], children[1], children[2], children[3], children[4]
+		return &c
+	case *PresenceTestNode:
+		c := *n
+		c.Object = children[0]
+		return &c
+	case *BindNode:
+		c := *n
+		c.Init, c.Result = children[0], children[1]
+		return &c
+	}
+	return node
+}
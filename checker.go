@@ -16,38 +16,186 @@ func (e *CheckError) Error() string {
 	return fmt.Sprintf("type check error: %s", e.Message)
 }
 
+func (e *CheckError) Location() ast.Location {
+	if e.Node == nil {
+		return ast.NoLocation
+	}
+	return e.Node.Location()
+}
+
 // Checker implements type checking
 type Checker struct {
 	env     *Env
 	program *Program
+	locals  *scope[ast.ValueType]
+
+	// set by CheckAll, errors are collected here instead of stopping the check
+	issues *Issues
+
+	// results of the last Check
+	types     map[ast.ASTNode]ast.ValueType
+	overloads map[*ast.FunctionCallNode]int
+	// calls to functions in a namespace, e.g. optional.of(x)
+	namespaced map[*ast.FunctionCallNode]string
 }
 
 // NewChecker creates a new type checker
 func NewChecker(env *Env, program *Program) *Checker {
-	return &Checker{env: env, program: program}
+	return &Checker{
+		env:        env,
+		program:    program,
+		types:      make(map[ast.ASTNode]ast.ValueType),
+		overloads:  make(map[*ast.FunctionCallNode]int),
+		namespaced: make(map[*ast.FunctionCallNode]string),
+	}
 }
 
-// Check checks the type of expression
+// Check checks the type of expression and estimates its cost, see Program.Cost
 func (tc *Checker) Check() (ast.ValueType, error) {
-	return tc.check(tc.program.ASTNode)
+	t, err := tc.check(tc.program.ASTNode)
+	if err != nil {
+		return nil, err
+	}
+	if err := tc.setCost(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CheckAll checks the type of expression and reports every error found, the
+// type of subexpressions that fail to check is ast.ErrorType
+func (tc *Checker) CheckAll() (ast.ValueType, *Issues) {
+	tc.issues = &Issues{}
+	defer func() { tc.issues = nil }()
+
+	issues := tc.issues
+	t, err := tc.check(tc.program.ASTNode)
+	issues.Add(err)
+	if issues.Len() > 0 {
+		return nil, issues
+	}
+	if err := tc.setCost(); err != nil {
+		issues.Add(err)
+		return nil, issues
+	}
+	return t, nil
+}
+
+func (tc *Checker) setCost() error {
+	cost, err := tc.estimateCost()
+	if err != nil {
+		return err
+	}
+	tc.program.cost = &cost
+	return nil
 }
 
 func (tc *Checker) check(node ast.ASTNode) (ast.ValueType, error) {
 	result, err := node.Accept(tc)
+	if tc.issues != nil && tc.hasErrorChild(node) {
+		// the error has already been reported for the child
+		tc.types[node] = ast.ErrorType
+		return ast.ErrorType, nil
+	}
 	if err != nil {
-		return nil, err
+		if tc.issues == nil {
+			return nil, err
+		}
+		tc.issues.Add(err)
+		tc.types[node] = ast.ErrorType
+		return ast.ErrorType, nil
 	}
 	if typ, ok := result.(ast.ValueType); ok {
+		tc.types[node] = typ
 		return typ, nil
 	}
 	return nil, fmt.Errorf("internal error: type checker returned non-type")
 }
 
+func (tc *Checker) hasErrorChild(node ast.ASTNode) bool {
+	children := ast.Children(node)
+	if call, ok := node.(*ast.FunctionCallNode); ok {
+		if _, args, ok := tc.resolveCheckedCall(call); ok {
+			children = args
+		}
+	}
+	for _, child := range children {
+		if t, ok := tc.types[child]; ok && isErrorType(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func isErrorType(t ast.ValueType) bool {
+	return t.Kind() == ast.TypeKindError
+}
+
+// resolveCheckedCall is resolveCall for a checked node, with the calls to
+// functions in a namespace resolved by the checker
+func (tc *Checker) resolveCheckedCall(node *ast.FunctionCallNode) (string, []ast.ASTNode, bool) {
+	if name, ok := tc.namespaced[node]; ok {
+		return name, node.Args, true
+	}
+	return resolveCall(node)
+}
+
+// isVariable reports whether name is a local or a declared variable
+func (tc *Checker) isVariable(name string) bool {
+	if _, exists := tc.locals.lookup(name); exists {
+		return true
+	}
+	_, exists := tc.program.GetVariable(name)
+	return exists
+}
+
+// TypeOf returns the type of a checked node
+func (tc *Checker) TypeOf(node ast.ASTNode) (ast.ValueType, bool) {
+	t, ok := tc.types[node]
+	return t, ok
+}
+
+// resolveCall returns the function name and the arguments of a call, the
+// receiver of member calls is the first argument
+func resolveCall(node *ast.FunctionCallNode) (string, []ast.ASTNode, bool) {
+	switch fn := node.Function.(type) {
+	case *ast.IdentNode:
+		return fn.Name, node.Args, true
+	case *ast.MemberAccessNode:
+		return fn.Member, append([]ast.ASTNode{fn.Object}, node.Args...), true
+	default:
+		return "", nil, false
+	}
+}
+
+// namespacedFunction returns the name of the function in a namespace that a
+// call like optional.of(x) calls, "optional.of", unless the namespace is a
+// variable
+func namespacedFunction(env *Env, node *ast.FunctionCallNode, isVariable func(name string) bool) (string, bool) {
+	member, ok := node.Function.(*ast.MemberAccessNode)
+	if !ok || member.Optional {
+		return "", false
+	}
+	ident, ok := member.Object.(*ast.IdentNode)
+	if !ok || ident.LeadingDot || isVariable(ident.Name) {
+		return "", false
+	}
+	name := ident.Name + "." + member.Member
+	if _, exists := env.GetFunction(name); !exists {
+		return "", false
+	}
+	return name, true
+}
+
 func (tc *Checker) VisitLiteral(node *ast.LiteralNode) (interface{}, error) {
 	return node.Value.Type(), nil
 }
 
 func (tc *Checker) VisitIdent(node *ast.IdentNode) (interface{}, error) {
+	if t, exists := tc.locals.lookup(node.Name); exists {
+		return t, nil
+	}
+
 	if t, exists := tc.program.GetVariable(node.Name); exists {
 		return t, nil
 	}
@@ -64,6 +212,15 @@ func (tc *Checker) VisitMemberAccess(node *ast.MemberAccessNode) (interface{}, e
 		return nil, err
 	}
 
+	// selecting from an optional value gives an optional value, like obj.?member
+	optional := node.Optional
+	if o, ok := objectType.(*ast.OptionalType); ok {
+		objectType, optional = o.ElementType(), true
+		if objectType.Kind() == ast.TypeKindAny {
+			return ast.NewOptionalType(ast.AnyType), nil
+		}
+	}
+
 	if !objectType.HasTrait(ast.SelectorType) {
 		return nil, &CheckError{
 			Message: fmt.Sprintf("cannot access member of type %s", objectType.String()),
@@ -79,20 +236,19 @@ func (tc *Checker) VisitMemberAccess(node *ast.MemberAccessNode) (interface{}, e
 		}
 	}
 
+	if optional {
+		return ast.NewOptionalType(memberType), nil
+	}
 	return memberType, nil
 }
 
 func (tc *Checker) VisitFunctionCall(node *ast.FunctionCallNode) (interface{}, error) {
-	var fnName string
-	var args []ast.ASTNode
-	switch fn := node.Function.(type) {
-	case *ast.IdentNode:
-		fnName = fn.Name
-		args = node.Args
-	case *ast.MemberAccessNode:
-		fnName = fn.Member
-		args = append([]ast.ASTNode{fn.Object}, node.Args...)
-	default:
+	fnName, args, ok := resolveCall(node)
+	if name, namespaced := namespacedFunction(tc.env, node, tc.isVariable); namespaced {
+		fnName, args, ok = name, node.Args, true
+		tc.namespaced[node] = name
+	}
+	if !ok {
 		return nil, &CheckError{
 			Message: fmt.Sprintf("function call must be an identifier or member access, got %s", node.Function.String()),
 			Node:    node,
@@ -121,13 +277,14 @@ func (tc *Checker) VisitFunctionCall(node *ast.FunctionCallNode) (interface{}, e
 	fnTypes := f.Types()
 	resultEnv := make(map[string]ast.ValueType)
 	var foundFnType *ast.FunctionType
-	for _, fnType := range fnTypes {
+	for i, fnType := range fnTypes {
 		var ok bool
 		resultEnv, ok = ast.MatchFunctionTypes(fnType.ParamTypes(), argTypes)
 		if !ok {
 			continue
 		}
 		foundFnType = &fnType
+		tc.overloads[node] = i
 		break
 	}
 
@@ -161,6 +318,16 @@ func (tc *Checker) VisitIndex(node *ast.IndexNode) (interface{}, error) {
 		return nil, err
 	}
 
+	// indexing an optional value gives an optional value, like obj[?index]
+	optional := node.Optional
+	if o, ok := objectType.(*ast.OptionalType); ok {
+		objectType, optional = o.ElementType(), true
+		if objectType.Kind() == ast.TypeKindAny {
+			return ast.NewOptionalType(ast.AnyType), nil
+		}
+	}
+
+	var elemType ast.ValueType
 	switch objType := objectType.(type) {
 	case *ast.ListType:
 		if indexType.Kind() != ast.TypeKindInt && indexType.Kind() != ast.TypeKindUint {
@@ -169,21 +336,26 @@ func (tc *Checker) VisitIndex(node *ast.IndexNode) (interface{}, error) {
 				Node:    node,
 			}
 		}
-		return objType.ElementType(), nil
-	case *ast.MapType:
+		elemType = objType.ElementType()
+	case ast.KeyedType:
 		if !tc.isCompatible(indexType, objType.KeyType()) {
 			return nil, &CheckError{
 				Message: fmt.Sprintf("map key type mismatch: expected %s, got %s", objType.KeyType().String(), indexType.String()),
 				Node:    node,
 			}
 		}
-		return objType.ValueType(), nil
+		elemType = objType.ValueType()
 	default:
 		return nil, &CheckError{
 			Message: fmt.Sprintf("cannot index type %s", objectType.String()),
 			Node:    node,
 		}
 	}
+
+	if optional {
+		return ast.NewOptionalType(elemType), nil
+	}
+	return elemType, nil
 }
 
 func (tc *Checker) VisitConditional(node *ast.ConditionalNode) (interface{}, error) {
@@ -192,7 +364,7 @@ func (tc *Checker) VisitConditional(node *ast.ConditionalNode) (interface{}, err
 		return nil, err
 	}
 
-	if conditionType.Kind() != ast.TypeKindBool {
+	if conditionType.Kind() != ast.TypeKindBool && !isErrorType(conditionType) {
 		return nil, &CheckError{
 			Message: fmt.Sprintf("conditional expression requires bool condition, got %s", conditionType.String()),
 			Node:    node,
@@ -227,47 +399,70 @@ func (tc *Checker) VisitList(node *ast.ListNode) (interface{}, error) {
 		return ast.NewListType(ast.AnyType), nil
 	}
 
-	// Check the type of the first element as the list element type
-	firstElemType, err := tc.check(node.Elements[0])
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if all element types are consistent
-	for _, elem := range node.Elements[1:] {
+	// The type of the first element is the list element type, unless the
+	// element types are not consistent
+	var firstElemType ast.ValueType
+	for i, elem := range node.Elements {
 		elemType, err := tc.check(elem)
 		if err != nil {
 			return nil, err
 		}
+		if node.IsOptional(i) {
+			if isUnresolvedOptional(elemType) {
+				continue
+			}
+			elemType, err = tc.optionalValueType(elem, elemType)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-		if !tc.isCompatible(elemType, firstElemType) {
+		if firstElemType == nil {
+			firstElemType = elemType
+		} else if !tc.isCompatible(elemType, firstElemType) {
 			firstElemType = ast.AnyType
 		}
 	}
+	if firstElemType == nil {
+		firstElemType = ast.AnyType
+	}
 
 	return ast.NewListType(firstElemType), nil
 }
 
+// optionalValueType returns the type of the value of an optional list element,
+// map entry or struct field, whose expression must be optional
+func (tc *Checker) optionalValueType(node ast.ASTNode, t ast.ValueType) (ast.ValueType, error) {
+	if t.Kind() == ast.TypeKindAny || isErrorType(t) {
+		return t, nil
+	}
+	o, ok := t.(*ast.OptionalType)
+	if !ok {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("optional entry requires an optional value, got %s", t.String()),
+			Node:    node,
+		}
+	}
+	return o.ElementType(), nil
+}
+
+// isUnresolvedOptional reports whether t is an optional type without an element
+// type, e.g. of optional.none(), which does not decide the type of a collection
+func isUnresolvedOptional(t ast.ValueType) bool {
+	o, ok := t.(*ast.OptionalType)
+	return ok && o.ElementType().Kind() == ast.TypeKindAny
+}
+
 func (tc *Checker) VisitMap(node *ast.MapNode) (interface{}, error) {
 	if len(node.Entries) == 0 {
 		// Empty map
 		return ast.NewMapType(ast.AnyType, ast.AnyType), nil
 	}
 
-	// Check the type of the first entry
-	firstEntry := node.Entries[0]
-	keyType, err := tc.check(firstEntry.Key)
-	if err != nil {
-		return nil, err
-	}
-
-	valueType, err := tc.check(firstEntry.Value)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check type consistency of all entries
-	for i, entry := range node.Entries[1:] {
+	// The types of the first entry are the map key and value types, unless the
+	// value types are not consistent
+	var keyType, valueType ast.ValueType
+	for i, entry := range node.Entries {
 		entryKeyType, err := tc.check(entry.Key)
 		if err != nil {
 			return nil, err
@@ -278,17 +473,34 @@ func (tc *Checker) VisitMap(node *ast.MapNode) (interface{}, error) {
 			return nil, err
 		}
 
-		if !tc.isCompatible(entryKeyType, keyType) {
+		if i == 0 {
+			keyType = entryKeyType
+		} else if !tc.isCompatible(entryKeyType, keyType) {
 			return nil, &CheckError{
-				Message: fmt.Sprintf("map entry %d key has type %s, expected %s", i+1, entryKeyType.String(), keyType.String()),
+				Message: fmt.Sprintf("map entry %d key has type %s, expected %s", i, entryKeyType.String(), keyType.String()),
 				Node:    node,
 			}
 		}
 
-		if !tc.isCompatible(entryValueType, valueType) {
+		if entry.Optional {
+			if isUnresolvedOptional(entryValueType) {
+				continue
+			}
+			entryValueType, err = tc.optionalValueType(entry.Value, entryValueType)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if valueType == nil {
+			valueType = entryValueType
+		} else if !tc.isCompatible(entryValueType, valueType) {
 			valueType = ast.AnyType
 		}
 	}
+	if valueType == nil {
+		valueType = ast.AnyType
+	}
 
 	return ast.NewMapType(keyType, valueType), nil
 }
@@ -298,9 +510,158 @@ func (tc *Checker) isCompatible(t1, t2 ast.ValueType) bool {
 }
 
 func (tc *Checker) VisitStruct(node *ast.StructNode) (interface{}, error) {
-	// TODO: struct syntax is not supported yet
-	return nil, &CheckError{
-		Message: "struct is not supported",
-		Node:    node,
+	structType, ok := tc.env.GetType(node.TypeName)
+	if !ok {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("undefined type: %s", node.TypeName),
+			Node:    node,
+		}
+	}
+
+	seen := make(map[string]bool, len(node.Fields))
+	for _, field := range node.Fields {
+		if seen[field.Name] {
+			return nil, &CheckError{
+				Message: fmt.Sprintf("field %s is set more than once", field.Name),
+				Node:    node,
+			}
+		}
+		seen[field.Name] = true
+
+		fieldType := structType.Member(field.Name)
+		if fieldType == nil {
+			return nil, &CheckError{
+				Message: fmt.Sprintf("field %s not found in type %s", field.Name, node.TypeName),
+				Node:    node,
+			}
+		}
+
+		valueType, err := tc.check(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		// an optional field is left unset when its value is absent
+		if field.Optional {
+			valueType, err = tc.optionalValueType(field.Value, valueType)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !tc.isCompatible(valueType, fieldType) && !convertsField(structType, field.Name, valueType) {
+			return nil, &CheckError{
+				Message: fmt.Sprintf("field %s has type %s, expected %s", field.Name, valueType.String(), fieldType.String()),
+				Node:    field.Value,
+			}
+		}
+	}
+
+	return structType, nil
+}
+
+func convertsField(structType ast.StructType, name string, t ast.ValueType) bool {
+	c, ok := structType.(ast.FieldConverter)
+	return ok && c.ConvertsField(name, t)
+}
+
+func (tc *Checker) VisitComprehension(node *ast.ComprehensionNode) (interface{}, error) {
+	rangeType, err := tc.check(node.IterRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var iterType ast.ValueType
+	switch rt := rangeType.(type) {
+	case *ast.ListType:
+		iterType = rt.ElementType()
+	case ast.KeyedType:
+		iterType = rt.KeyType()
+	default:
+		if rangeType.Kind() != ast.TypeKindAny && !isErrorType(rangeType) {
+			return nil, &CheckError{
+				Message: fmt.Sprintf("expression of type %s cannot be the range of a comprehension", rangeType.String()),
+				Node:    node,
+			}
+		}
+		iterType = ast.AnyType
+	}
+
+	accuType, err := tc.check(node.AccuInit)
+	if err != nil {
+		return nil, err
 	}
+
+	outer := tc.locals
+	defer func() { tc.locals = outer }()
+
+	tc.locals = outer.push(node.AccuVar, accuType).push(node.IterVar, iterType)
+	conditionType, err := tc.check(node.LoopCondition)
+	if err != nil {
+		return nil, err
+	}
+	if conditionType.Kind() != ast.TypeKindBool && conditionType.Kind() != ast.TypeKindAny && !isErrorType(conditionType) {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("comprehension loop condition requires bool, got %s", conditionType.String()),
+			Node:    node,
+		}
+	}
+
+	stepType, err := tc.check(node.LoopStep)
+	if err != nil {
+		return nil, err
+	}
+	if !tc.isCompatible(stepType, accuType) {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("comprehension step has type %s, expected %s", stepType.String(), accuType.String()),
+			Node:    node,
+		}
+	}
+
+	// The step is usually more specific than the initial value, e.g. [] + [x]
+	tc.locals = outer.push(node.AccuVar, stepType)
+	return tc.check(node.Result)
+}
+
+func (tc *Checker) VisitBind(node *ast.BindNode) (interface{}, error) {
+	initType, err := tc.check(node.Init)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := tc.locals
+	defer func() { tc.locals = outer }()
+
+	tc.locals = outer.push(node.Name, initType)
+	return tc.check(node.Result)
+}
+
+func (tc *Checker) VisitPresenceTest(node *ast.PresenceTestNode) (interface{}, error) {
+	objectType, err := tc.check(node.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	// an absent optional value has no members
+	if o, ok := objectType.(*ast.OptionalType); ok {
+		objectType = o.ElementType()
+	}
+
+	if objectType.Kind() == ast.TypeKindAny {
+		return ast.BoolType, nil
+	}
+
+	if !objectType.HasTrait(ast.SelectorType) {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("cannot test presence of member on type %s", objectType.String()),
+			Node:    node,
+		}
+	}
+
+	if objectType.Member(node.Member) == nil {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("member %s not found in type %s", node.Member, objectType.String()),
+			Node:    node,
+		}
+	}
+
+	return ast.BoolType, nil
 }
@@ -0,0 +1,288 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// magic starts the binary form, followed by the version
+const magic = "SLAST"
+
+var nodeKinds = []string{
+	kindLiteral, kindIdent, kindSelect, kindCall, kindIndex, kindConditional,
+	kindList, kindMap, kindStruct, kindComprehension, kindPresenceTest, kindBind,
+}
+
+const (
+	flagLocation = 1 << iota
+	flagType
+	flagValue
+	flagSet
+)
+
+// MarshalBinary encodes a checked AST in the binary form
+func MarshalBinary(c *CheckedAST) ([]byte, error) {
+	root, err := encodeNode(c, c.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &writer{}
+	w.buf.WriteString(magic)
+	w.uvarint(Version)
+	if err := w.node(root); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a checked AST encoded by MarshalBinary
+func UnmarshalBinary(data []byte) (*CheckedAST, error) {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, fmt.Errorf("invalid header")
+	}
+	r := &reader{data: data[len(magic):]}
+	if version := r.uvarint(); r.err == nil && version != Version {
+		return nil, fmt.Errorf("unsupported version %d, want %d", version, Version)
+	}
+	root := r.node()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", len(r.data))
+	}
+	return decode(root)
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) uvarint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *writer) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *writer) node(n *node) error {
+	kind := -1
+	for i, k := range nodeKinds {
+		if k == n.Kind {
+			kind = i
+		}
+	}
+	if kind < 0 {
+		return fmt.Errorf("unknown node kind %q", n.Kind)
+	}
+
+	flags := byte(0)
+	if n.Loc != nil {
+		flags |= flagLocation
+	}
+	if n.Type != nil {
+		flags |= flagType
+	}
+	if n.Value != nil {
+		flags |= flagValue
+	}
+	if n.Flag {
+		flags |= flagSet
+	}
+	w.buf.WriteByte(byte(kind))
+	w.buf.WriteByte(flags)
+
+	if n.Loc != nil {
+		w.uvarint(uint64(n.Loc[0]))
+		w.uvarint(uint64(n.Loc[1]))
+	}
+	if n.Type != nil {
+		w.typeRef(n.Type)
+	}
+	w.string(n.Name)
+	w.string(n.Accu)
+	if n.Value != nil {
+		w.value(n.Value)
+	}
+	w.uvarint(uint64(len(n.Fields)))
+	for _, field := range n.Fields {
+		w.string(field)
+	}
+	w.uvarint(uint64(len(n.Optional)))
+	for _, optional := range n.Optional {
+		if optional {
+			w.buf.WriteByte(1)
+		} else {
+			w.buf.WriteByte(0)
+		}
+	}
+	w.uvarint(uint64(len(n.Children)))
+	for _, child := range n.Children {
+		if err := w.node(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *writer) typeRef(t *typeRef) {
+	w.string(t.Kind)
+	w.uvarint(uint64(len(t.Params)))
+	for _, p := range t.Params {
+		w.typeRef(p)
+	}
+}
+
+func (w *writer) value(v *value) {
+	w.string(v.Kind)
+	w.string(v.V)
+	if v.Type != nil {
+		w.buf.WriteByte(1)
+		w.typeRef(v.Type)
+	} else {
+		w.buf.WriteByte(0)
+	}
+	w.uvarint(uint64(len(v.Elements)))
+	for _, elem := range v.Elements {
+		w.value(elem)
+	}
+}
+
+var errTruncated = errors.New("unexpected end of data")
+
+// reader keeps the first error, reads after an error return zero values
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.data = nil
+}
+
+func (r *reader) byte() byte {
+	if len(r.data) == 0 {
+		r.fail(errTruncated)
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *reader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail(errTruncated)
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count reads a length, each item takes at least one byte
+func (r *reader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail(errTruncated)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *reader) int() int {
+	v := r.uvarint()
+	if v > math.MaxInt32 {
+		r.fail(fmt.Errorf("invalid offset %d", v))
+		return 0
+	}
+	return int(v)
+}
+
+func (r *reader) string() string {
+	n := r.count()
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func (r *reader) node() *node {
+	kind := int(r.byte())
+	flags := r.byte()
+	if r.err != nil {
+		return nil
+	}
+	if kind >= len(nodeKinds) {
+		r.fail(fmt.Errorf("unknown node kind %d", kind))
+		return nil
+	}
+
+	n := &node{Kind: nodeKinds[kind], Flag: flags&flagSet != 0}
+	if flags&flagLocation != 0 {
+		n.Loc = []int{r.int(), r.int()}
+	}
+	if flags&flagType != 0 {
+		n.Type = r.typeRef()
+	}
+	n.Name = r.string()
+	n.Accu = r.string()
+	if flags&flagValue != 0 {
+		n.Value = r.value()
+	}
+	if count := r.count(); count > 0 {
+		n.Fields = make([]string, count)
+		for i := range n.Fields {
+			n.Fields[i] = r.string()
+		}
+	}
+	if count := r.count(); count > 0 {
+		n.Optional = make([]bool, count)
+		for i := range n.Optional {
+			n.Optional[i] = r.byte() != 0
+		}
+	}
+	if count := r.count(); count > 0 {
+		n.Children = make([]*node, count)
+		for i := range n.Children {
+			n.Children[i] = r.node()
+		}
+	}
+	if r.err != nil {
+		return nil
+	}
+	return n
+}
+
+func (r *reader) typeRef() *typeRef {
+	t := &typeRef{Kind: r.string()}
+	if count := r.count(); count > 0 {
+		t.Params = make([]*typeRef, count)
+		for i := range t.Params {
+			t.Params[i] = r.typeRef()
+		}
+	}
+	return t
+}
+
+func (r *reader) value() *value {
+	v := &value{Kind: r.string(), V: r.string()}
+	if r.byte() != 0 {
+		v.Type = r.typeRef()
+	}
+	if count := r.count(); count > 0 {
+		v.Elements = make([]*value, count)
+		for i := range v.Elements {
+			v.Elements[i] = r.value()
+		}
+	}
+	return v
+}
@@ -0,0 +1,616 @@
+// Package codec serializes checked ASTs, so that rules can be distributed
+// without parsing them again. There are two forms with the same content: JSON
+// and a compact binary form, both start with a version header. Decoding an
+// encoded AST gives an AST with the same source form, locations and types.
+package codec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+)
+
+// Version is the version of the serialization format, decoding rejects other
+// versions
+const Version = 1
+
+// CheckedAST is an AST with the types inferred by the checker
+type CheckedAST struct {
+	Root  ast.ASTNode
+	Types map[ast.ASTNode]ast.ValueType
+}
+
+// Check checks the program and returns its AST with the inferred types
+func Check(env *sl.Env, p *sl.Program) (*CheckedAST, error) {
+	checker := sl.NewChecker(env, p)
+	if _, err := checker.Check(); err != nil {
+		return nil, err
+	}
+
+	checked := &CheckedAST{Root: p.ASTNode, Types: make(map[ast.ASTNode]ast.ValueType)}
+	ast.Walk(p.ASTNode, func(node ast.ASTNode) bool {
+		if t, ok := checker.TypeOf(node); ok {
+			checked.Types[node] = t
+		}
+		return true
+	})
+	return checked, nil
+}
+
+// TypeOf returns the type of a checked node
+func (c *CheckedAST) TypeOf(node ast.ASTNode) (ast.ValueType, bool) {
+	t, ok := c.Types[node]
+	return t, ok
+}
+
+// Node kinds
+const (
+	kindLiteral       = "literal"
+	kindIdent         = "ident"
+	kindSelect        = "select"
+	kindCall          = "call"
+	kindIndex         = "index"
+	kindConditional   = "conditional"
+	kindList          = "list"
+	kindMap           = "map"
+	kindStruct        = "struct"
+	kindComprehension = "comprehension"
+	kindPresenceTest  = "has"
+	kindBind          = "bind"
+)
+
+// node is the serialized form of an ast.ASTNode, children are in the order of
+// ast.Children
+type node struct {
+	Kind string   `json:"kind"`
+	Loc  []int    `json:"loc,omitempty"`
+	Type *typeRef `json:"type,omitempty"`
+	// identifier, member, struct type or iteration variable name
+	Name string `json:"name,omitempty"`
+	// accumulator variable name of comprehensions
+	Accu  string `json:"accu,omitempty"`
+	Value *value `json:"value,omitempty"`
+	// leading dot of identifiers, optional access or receiver style of structs
+	Flag bool `json:"flag,omitempty"`
+	// struct field names
+	Fields []string `json:"fields,omitempty"`
+	// optional flags of map entries and struct fields
+	Optional []bool  `json:"optional,omitempty"`
+	Children []*node `json:"children,omitempty"`
+}
+
+type typeRef struct {
+	Kind   string     `json:"kind"`
+	Params []*typeRef `json:"params,omitempty"`
+}
+
+// value is the serialized form of an ast.Value, scalars are in V (bytes in
+// base64), the elements of lists and the keys and values of maps, alternating,
+// in Elements
+type value struct {
+	Kind     string   `json:"kind"`
+	V        string   `json:"v,omitempty"`
+	Type     *typeRef `json:"type,omitempty"`
+	Elements []*value `json:"elements,omitempty"`
+}
+
+func encodeNode(c *CheckedAST, n ast.ASTNode) (*node, error) {
+	result := &node{}
+	switch n := n.(type) {
+	case *ast.LiteralNode:
+		result.Kind = kindLiteral
+		v, err := encodeValue(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		result.Value = v
+	case *ast.IdentNode:
+		result.Kind = kindIdent
+		result.Name = n.Name
+		result.Flag = n.LeadingDot
+	case *ast.MemberAccessNode:
+		result.Kind = kindSelect
+		result.Name = n.Member
+		result.Flag = n.Optional
+	case *ast.FunctionCallNode:
+		result.Kind = kindCall
+	case *ast.IndexNode:
+		result.Kind = kindIndex
+		result.Flag = n.Optional
+	case *ast.ConditionalNode:
+		result.Kind = kindConditional
+	case *ast.ListNode:
+		result.Kind = kindList
+		if len(n.OptionalIndices) > 0 {
+			result.Optional = make([]bool, len(n.Elements))
+			for _, i := range n.OptionalIndices {
+				result.Optional[i] = true
+			}
+		}
+	case *ast.MapNode:
+		result.Kind = kindMap
+		for _, entry := range n.Entries {
+			result.Optional = append(result.Optional, entry.Optional)
+		}
+	case *ast.StructNode:
+		result.Kind = kindStruct
+		result.Name = n.TypeName
+		result.Flag = n.ReceiverStyle
+		for _, field := range n.Fields {
+			result.Fields = append(result.Fields, field.Name)
+			result.Optional = append(result.Optional, field.Optional)
+		}
+	case *ast.ComprehensionNode:
+		result.Kind = kindComprehension
+		result.Name = n.IterVar
+		result.Accu = n.AccuVar
+	case *ast.PresenceTestNode:
+		result.Kind = kindPresenceTest
+		result.Name = n.Member
+	case *ast.BindNode:
+		result.Kind = kindBind
+		result.Name = n.Name
+	default:
+		return nil, fmt.Errorf("cannot encode node %T", n)
+	}
+
+	if loc := n.Location(); loc.IsValid() {
+		result.Loc = []int{loc.Start, loc.Stop}
+	}
+	if c.Types != nil {
+		if t, ok := c.Types[n]; ok {
+			ref, err := encodeType(t)
+			if err != nil {
+				return nil, err
+			}
+			result.Type = ref
+		}
+	}
+
+	for _, child := range ast.Children(n) {
+		encoded, err := encodeNode(c, child)
+		if err != nil {
+			return nil, err
+		}
+		result.Children = append(result.Children, encoded)
+	}
+	return result, nil
+}
+
+func decodeNode(c *CheckedAST, n *node) (ast.ASTNode, error) {
+	children := make([]ast.ASTNode, len(n.Children))
+	for i, child := range n.Children {
+		decoded, err := decodeNode(c, child)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = decoded
+	}
+
+	want := map[string]int{
+		kindSelect:        1,
+		kindIndex:         2,
+		kindConditional:   3,
+		kindComprehension: 5,
+		kindPresenceTest:  1,
+		kindBind:          2,
+	}
+	if count, ok := want[n.Kind]; ok && len(children) != count {
+		return nil, fmt.Errorf("node %s has %d children, want %d", n.Kind, len(children), count)
+	}
+
+	var result ast.ASTNode
+	switch n.Kind {
+	case kindLiteral:
+		if n.Value == nil {
+			return nil, fmt.Errorf("literal without value")
+		}
+		v, err := decodeValue(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		result = ast.NewLiteral(v)
+	case kindIdent:
+		result = ast.NewIdent(n.Name, n.Flag)
+	case kindSelect:
+		result = ast.NewMemberAccess(children[0], n.Name, n.Flag)
+	case kindCall:
+		if len(children) == 0 {
+			return nil, fmt.Errorf("call without function")
+		}
+		result = ast.NewFunctionCall(children[0], children[1:])
+	case kindIndex:
+		result = ast.NewIndex(children[0], children[1], n.Flag)
+	case kindConditional:
+		result = ast.NewConditional(children[0], children[1], children[2])
+	case kindList:
+		if len(n.Optional) != 0 && len(n.Optional) != len(children) {
+			return nil, fmt.Errorf("list has %d children for %d elements", len(children), len(n.Optional))
+		}
+		list := ast.NewList(children)
+		for i, optional := range n.Optional {
+			if optional {
+				list.OptionalIndices = append(list.OptionalIndices, i)
+			}
+		}
+		result = list
+	case kindMap:
+		if len(children) != 2*len(n.Optional) {
+			return nil, fmt.Errorf("map has %d children for %d entries", len(children), len(n.Optional))
+		}
+		entries := make([]ast.MapEntry, len(n.Optional))
+		for i, optional := range n.Optional {
+			entries[i] = ast.NewMapEntry(children[2*i], children[2*i+1], optional)
+		}
+		result = ast.NewMap(entries)
+	case kindStruct:
+		if len(children) != len(n.Fields) || len(n.Optional) != len(n.Fields) {
+			return nil, fmt.Errorf("struct has %d children for %d fields", len(children), len(n.Fields))
+		}
+		fields := make([]ast.StructField, len(n.Fields))
+		for i, name := range n.Fields {
+			fields[i] = ast.StructField{Name: name, Value: children[i], Optional: n.Optional[i]}
+		}
+		result = ast.NewStruct(n.Name, fields, n.Flag)
+	case kindComprehension:
+		result = ast.NewComprehension(n.Name, children[0], n.Accu, children[1], children[2], children[3], children[4])
+	case kindPresenceTest:
+		result = ast.NewPresenceTest(children[0], n.Name)
+	case kindBind:
+		result = ast.NewBind(n.Name, children[0], children[1])
+	default:
+		return nil, fmt.Errorf("unknown node kind %q", n.Kind)
+	}
+
+	if len(n.Loc) == 2 {
+		result.SetLocation(ast.Location{Start: n.Loc[0], Stop: n.Loc[1]})
+	}
+	if n.Type != nil {
+		t, err := decodeType(n.Type)
+		if err != nil {
+			return nil, err
+		}
+		c.Types[result] = t
+	}
+	return result, nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]ast.ValueType{}
+	valueCodec = map[string]ValueCodec{}
+)
+
+// ValueCodec converts the values of a type registered with RegisterValue
+// to and from strings
+type ValueCodec struct {
+	Encode func(v ast.Value) (string, error)
+	Decode func(s string) (ast.Value, error)
+}
+
+// RegisterType makes a type known to the decoder, list and map types are built
+// from their parameters and do not need to be registered. The types of the
+// standard library are registered, types set with Env.SetType must also be
+// registered before decoding ASTs that use them.
+func RegisterType(t ast.ValueType) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[t.Kind()] = t
+}
+
+// RegisterValue makes values of a type other than the builtin ones encodable,
+// e.g. in literals created by the optimizer
+func RegisterValue(t ast.ValueType, c ValueCodec) {
+	RegisterType(t)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	valueCodec[t.Kind()] = c
+}
+
+func init() {
+	for _, t := range []ast.ValueType{
+		ast.BoolType, ast.IntType, ast.UintType, ast.DoubleType, ast.StringType,
+		ast.BytesType, ast.NullType, ast.TypeType, ast.AnyType,
+	} {
+		RegisterType(t)
+	}
+	for _, t := range types.LibTypes {
+		RegisterType(t)
+	}
+	RegisterType(types.URLType)
+
+	RegisterValue(types.TimestampType, ValueCodec{
+		Encode: func(v ast.Value) (string, error) {
+			t := v.(*types.TimestampValue)
+			return fmt.Sprintf("%d %d %s", t.Sec, t.NSec, t.TZ), nil
+		},
+		Decode: func(s string) (ast.Value, error) {
+			parts := strings.SplitN(s, " ", 3)
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("invalid timestamp %q", s)
+			}
+			sec, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			nsec, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			return types.NewTimestampValue(sec, nsec, parts[2]), nil
+		},
+	})
+	RegisterValue(types.DurationType, ValueCodec{
+		Encode: func(v ast.Value) (string, error) {
+			return strconv.FormatInt(v.(*types.DurationValue).Nanosecond, 10), nil
+		},
+		Decode: func(s string) (ast.Value, error) {
+			ns, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			return types.NewDurationValue(ns), nil
+		},
+	})
+	RegisterValue(types.XMLType, ValueCodec{
+		Encode: func(v ast.Value) (string, error) {
+			return v.(*types.XMLValue).XML, nil
+		},
+		Decode: func(s string) (ast.Value, error) {
+			return types.NewXMLValue(s), nil
+		},
+	})
+	RegisterValue(types.RegexType, ValueCodec{
+		Encode: func(v ast.Value) (string, error) {
+			return v.(*types.RegexValue).Pattern, nil
+		},
+		Decode: func(s string) (ast.Value, error) {
+			return types.NewRegexValue(s)
+		},
+	})
+}
+
+func encodeType(t ast.ValueType) (*typeRef, error) {
+	switch t := t.(type) {
+	case *ast.ListType:
+		elem, err := encodeType(t.ElementType())
+		if err != nil {
+			return nil, err
+		}
+		return &typeRef{Kind: ast.TypeKindList, Params: []*typeRef{elem}}, nil
+	case *ast.MapType:
+		key, err := encodeType(t.KeyType())
+		if err != nil {
+			return nil, err
+		}
+		val, err := encodeType(t.ValueType())
+		if err != nil {
+			return nil, err
+		}
+		return &typeRef{Kind: ast.TypeKindMap, Params: []*typeRef{key, val}}, nil
+	case *ast.OptionalType:
+		elem, err := encodeType(t.ElementType())
+		if err != nil {
+			return nil, err
+		}
+		return &typeRef{Kind: ast.TypeKindOptional, Params: []*typeRef{elem}}, nil
+	}
+	if t.IsDyn() {
+		return nil, fmt.Errorf("cannot encode dynamic type %s", t.String())
+	}
+	return &typeRef{Kind: t.Kind()}, nil
+}
+
+func decodeType(ref *typeRef) (ast.ValueType, error) {
+	params := make([]ast.ValueType, len(ref.Params))
+	for i, p := range ref.Params {
+		t, err := decodeType(p)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = t
+	}
+
+	switch ref.Kind {
+	case ast.TypeKindList:
+		if len(params) != 1 {
+			return nil, fmt.Errorf("list type with %d parameters", len(params))
+		}
+		return ast.NewListType(params[0]), nil
+	case ast.TypeKindMap:
+		if len(params) != 2 {
+			return nil, fmt.Errorf("map type with %d parameters", len(params))
+		}
+		return ast.NewMapType(params[0], params[1]), nil
+	case ast.TypeKindOptional:
+		if len(params) != 1 {
+			return nil, fmt.Errorf("optional type with %d parameters", len(params))
+		}
+		return ast.NewOptionalType(params[0]), nil
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	t, ok := registry[ref.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q, see RegisterType", ref.Kind)
+	}
+	return t, nil
+}
+
+func encodeValue(v ast.Value) (*value, error) {
+	switch v := v.(type) {
+	case *ast.BoolValue:
+		return &value{Kind: ast.TypeKindBool, V: strconv.FormatBool(v.BoolValue)}, nil
+	case *ast.IntValue:
+		return &value{Kind: ast.TypeKindInt, V: strconv.FormatInt(v.IntValue, 10)}, nil
+	case *ast.UintValue:
+		return &value{Kind: ast.TypeKindUint, V: strconv.FormatUint(v.UintValue, 10)}, nil
+	case *ast.DoubleValue:
+		return &value{Kind: ast.TypeKindDouble, V: strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)}, nil
+	case *ast.StringValue:
+		return &value{Kind: ast.TypeKindString, V: v.StringValue}, nil
+	case *ast.BytesValue:
+		return &value{Kind: ast.TypeKindBytes, V: base64.StdEncoding.EncodeToString(v.BytesValue)}, nil
+	case *ast.NullValue:
+		return &value{Kind: ast.TypeKindNull}, nil
+	case *ast.TypeValue:
+		return &value{Kind: ast.TypeKindType, V: v.Value}, nil
+	case *ast.ListValue:
+		t, err := encodeType(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		result := &value{Kind: ast.TypeKindList, Type: t}
+		for _, elem := range v.ListValue {
+			encoded, err := encodeValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			result.Elements = append(result.Elements, encoded)
+		}
+		return result, nil
+	case *ast.MapValue:
+		t, err := encodeType(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		result := &value{Kind: ast.TypeKindMap, Type: t}
+		entries := make([][2]*value, 0, len(v.MapValue))
+		for k, val := range v.MapValue {
+			key, err := encodeValue(k)
+			if err != nil {
+				return nil, err
+			}
+			encoded, err := encodeValue(val)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, [2]*value{key, encoded})
+		}
+		// keys are scalars, sort them so that the encoding is stable
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i][0], entries[j][0]
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			return a.V < b.V
+		})
+		for _, entry := range entries {
+			result.Elements = append(result.Elements, entry[0], entry[1])
+		}
+		return result, nil
+	}
+
+	kind := v.Type().Kind()
+	registryMu.RLock()
+	c, ok := valueCodec[kind]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("cannot encode value of type %s", v.Type().String())
+	}
+	s, err := c.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return &value{Kind: kind, V: s}, nil
+}
+
+func decodeValue(v *value) (ast.Value, error) {
+	switch v.Kind {
+	case ast.TypeKindBool:
+		b, err := strconv.ParseBool(v.V)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewBoolValue(b), nil
+	case ast.TypeKindInt:
+		i, err := strconv.ParseInt(v.V, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewIntValue(i), nil
+	case ast.TypeKindUint:
+		u, err := strconv.ParseUint(v.V, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewUintValue(u), nil
+	case ast.TypeKindDouble:
+		d, err := strconv.ParseFloat(v.V, 64)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewDoubleValue(d), nil
+	case ast.TypeKindString:
+		return ast.NewStringValue(v.V), nil
+	case ast.TypeKindBytes:
+		b, err := base64.StdEncoding.DecodeString(v.V)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewBytesValue(b), nil
+	case ast.TypeKindNull:
+		return ast.NewNullValue(), nil
+	case ast.TypeKindType:
+		return ast.NewTypeValue(v.V), nil
+	case ast.TypeKindList:
+		t, err := decodeCollectionType(v, ast.TypeKindList)
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]ast.Value, len(v.Elements))
+		for i, elem := range v.Elements {
+			decoded, err := decodeValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = decoded
+		}
+		return ast.NewListValue(elems, t.(*ast.ListType).ElementType()), nil
+	case ast.TypeKindMap:
+		t, err := decodeCollectionType(v, ast.TypeKindMap)
+		if err != nil {
+			return nil, err
+		}
+		if len(v.Elements)%2 != 0 {
+			return nil, fmt.Errorf("map value with %d elements", len(v.Elements))
+		}
+		entries := make(map[ast.Value]ast.Value, len(v.Elements)/2)
+		for i := 0; i < len(v.Elements); i += 2 {
+			key, err := decodeValue(v.Elements[i])
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeValue(v.Elements[i+1])
+			if err != nil {
+				return nil, err
+			}
+			entries[key] = val
+		}
+		mt := t.(*ast.MapType)
+		return ast.NewMapValue(entries, mt.KeyType(), mt.ValueType()), nil
+	}
+
+	registryMu.RLock()
+	c, ok := valueCodec[v.Kind]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("cannot decode value of type %s", v.Kind)
+	}
+	return c.Decode(v.V)
+}
+
+func decodeCollectionType(v *value, kind string) (ast.ValueType, error) {
+	if v.Type == nil || v.Type.Kind != kind {
+		return nil, fmt.Errorf("%s value without %s type", kind, kind)
+	}
+	return decodeType(v.Type)
+}
@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/yywing/sl/ast"
+)
+
+type document struct {
+	Version int   `json:"version"`
+	Root    *node `json:"root"`
+}
+
+// MarshalJSON encodes a checked AST as JSON
+func MarshalJSON(c *CheckedAST) ([]byte, error) {
+	root, err := encodeNode(c, c.Root)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document{Version: Version, Root: root})
+}
+
+// UnmarshalJSON decodes a checked AST encoded by MarshalJSON
+func UnmarshalJSON(data []byte) (*CheckedAST, error) {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Version != Version {
+		return nil, fmt.Errorf("unsupported version %d, want %d", doc.Version, Version)
+	}
+	if doc.Root == nil {
+		return nil, fmt.Errorf("missing root node")
+	}
+	return decode(doc.Root)
+}
+
+func decode(root *node) (*CheckedAST, error) {
+	c := &CheckedAST{Types: make(map[ast.ASTNode]ast.ValueType)}
+	node, err := decodeNode(c, root)
+	if err != nil {
+		return nil, err
+	}
+	c.Root = node
+	return c, nil
+}
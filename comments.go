@@ -0,0 +1,286 @@
+package sl
+
+import (
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/parser"
+)
+
+// nodeComments are the comments written on their own lines before a node, and
+// after it at the end of its line
+type nodeComments struct {
+	leading  []string
+	trailing []string
+}
+
+type comment struct {
+	text string
+	loc  ast.Location
+	// whether the comment is the first thing on its line
+	ownLine bool
+}
+
+// FormatSource formats an expression like Format, keeping its // comments and
+// the quotes of its string and bytes literals. Comments stay next to the
+// operand, argument or element they precede, or follow on the same line, and
+// the expressions around them are wrapped.
+func FormatSource(expression string, opts FormatOptions) (string, error) {
+	node, err := Parse(expression)
+	if err != nil {
+		return "", err
+	}
+	if opts.Indent == "" {
+		opts.Indent = "  "
+	}
+
+	u := &unparser{
+		opts:     opts,
+		comments: make(map[ast.ASTNode]*nodeComments),
+		wrapped:  make(map[ast.ASTNode]bool),
+		source:   []rune(expression),
+	}
+	// comments on their own lines after the expression
+	var footer []string
+	for _, c := range lexComments(expression) {
+		switch {
+		case u.attach(node, c):
+		case c.loc.Stop <= node.Location().Start:
+			u.add(node, c.text, true)
+		case c.ownLine:
+			footer = append(footer, c.text)
+		default:
+			u.add(node, c.text, false)
+		}
+	}
+
+	s, err := u.expr(node, 0)
+	if err != nil {
+		return "", err
+	}
+	if c, ok := u.comments[node]; ok {
+		if len(c.leading) > 0 {
+			s = strings.Join(c.leading, "\n") + "\n" + s
+		}
+		if len(c.trailing) > 0 {
+			s += " " + strings.Join(c.trailing, " ")
+		}
+	}
+	for _, text := range footer {
+		s += "\n" + text
+	}
+	return s, nil
+}
+
+// literalSource returns the source of a string or bytes literal on a single
+// line, e.g. 'a' or r"\d"
+func (u *unparser) literalSource(n *ast.LiteralNode) (string, bool) {
+	switch n.Value.(type) {
+	case *ast.StringValue, *ast.BytesValue:
+	default:
+		return "", false
+	}
+	loc := n.Location()
+	if u.source == nil || !loc.IsValid() || loc.Stop > len(u.source) {
+		return "", false
+	}
+	text := string(u.source[loc.Start:loc.Stop])
+	if strings.ContainsAny(text, "\r\n") {
+		return "", false
+	}
+	return text, true
+}
+
+func lexComments(expression string) []comment {
+	source := []rune(expression)
+	lexer := parser.NewSLLexer(antlr.NewInputStream(expression))
+	lexer.RemoveErrorListeners()
+
+	var comments []comment
+	for _, token := range lexer.GetAllTokens() {
+		if token.GetTokenType() != parser.SLLexerCOMMENT {
+			continue
+		}
+		start := token.GetStart()
+		ownLine := true
+		for i := start - 1; i >= 0 && source[i] != '\n'; i-- {
+			if source[i] != ' ' && source[i] != '\t' && source[i] != '\r' {
+				ownLine = false
+				break
+			}
+		}
+		comments = append(comments, comment{
+			text:    strings.TrimRight(token.GetText(), " \t\r"),
+			loc:     ast.Location{Start: start, Stop: token.GetStop() + 1},
+			ownLine: ownLine,
+		})
+	}
+	return comments
+}
+
+// element is a part of an expression that starts a line when it is wrapped
+type element struct {
+	node ast.ASTNode
+	loc  ast.Location
+}
+
+// elements returns the parts of node that Format puts on their own lines
+func elements(node ast.ASTNode) []element {
+	var nodes []ast.ASTNode
+	var result []element
+	switch n := node.(type) {
+	case *ast.FunctionCallNode:
+		name := callee(n)
+		if (name == ast.LogicalAnd || name == ast.LogicalOr) && len(n.Args) == 2 {
+			nodes = chain(n, name)
+		} else if _, ok := binaryOperators[name]; !ok {
+			if _, ok := unaryOperators[name]; !ok {
+				nodes = n.Args
+			}
+		}
+	case *ast.ConditionalNode:
+		nodes = []ast.ASTNode{n.Condition, n.TrueExpr, n.FalseExpr}
+	case *ast.ListNode:
+		nodes = n.Elements
+	case *ast.MapNode:
+		// the element of an entry is its key, spanning the entry
+		for _, entry := range n.Entries {
+			loc := ast.Location{Start: entry.Key.Location().Start, Stop: entry.Value.Location().Stop}
+			if loc.IsValid() && entry.Key.Location().IsValid() {
+				result = append(result, element{node: entry.Key, loc: loc})
+			}
+		}
+	case *ast.StructNode:
+		for _, field := range n.Fields {
+			nodes = append(nodes, field.Value)
+		}
+	case *ast.ComprehensionNode:
+		if _, _, args, ok := macroCall(n); ok {
+			nodes = args[1:]
+		}
+	case *ast.BindNode:
+		nodes = []ast.ASTNode{n.Init, n.Result}
+	}
+	for _, n := range nodes {
+		if n.Location().IsValid() {
+			result = append(result, element{node: n, loc: n.Location()})
+		}
+	}
+	return result
+}
+
+// attach adds c to the innermost element around it, it returns false if c is
+// not inside node
+func (u *unparser) attach(node ast.ASTNode, c comment) bool {
+	children := ast.Children(node)
+	if n, ok := node.(*ast.ComprehensionNode); ok {
+		// the nodes generated by macros have the location of the whole call,
+		// only look into the arguments
+		if target, _, args, ok := macroCall(n); ok {
+			children = append([]ast.ASTNode{target}, args[1:]...)
+		}
+	}
+	for _, child := range children {
+		if contains(child.Location(), c.loc) && u.attach(child, c) {
+			return true
+		}
+	}
+	elems := elements(node)
+	for _, e := range elems {
+		if contains(e.loc, c.loc) {
+			u.add(e.node, c.text, false)
+			return true
+		}
+	}
+	if len(elems) == 0 || !contains(node.Location(), c.loc) {
+		return false
+	}
+
+	// between elements, a comment on its own line precedes the next element,
+	// otherwise it follows the previous one
+	var prev, next ast.ASTNode
+	for _, e := range elems {
+		if e.loc.Stop <= c.loc.Start {
+			prev = e.node
+		}
+		if next == nil && e.loc.Start >= c.loc.Stop {
+			next = e.node
+		}
+	}
+	if next != nil && (c.ownLine || prev == nil) {
+		u.add(next, c.text, true)
+	} else {
+		u.add(prev, c.text, false)
+	}
+	return true
+}
+
+func contains(outer, inner ast.Location) bool {
+	return outer.IsValid() && outer.Start <= inner.Start && inner.Stop <= outer.Stop
+}
+
+func (u *unparser) add(node ast.ASTNode, text string, leading bool) {
+	c, ok := u.comments[node]
+	if !ok {
+		c = &nodeComments{}
+		u.comments[node] = c
+	}
+	if leading {
+		c.leading = append(c.leading, text)
+	} else {
+		c.trailing = append(c.trailing, text)
+	}
+}
+
+// hasComments reports whether comments are attached below node
+func (u *unparser) hasComments(node ast.ASTNode) bool {
+	if len(u.comments) == 0 {
+		return false
+	}
+	if wrapped, ok := u.wrapped[node]; ok {
+		return wrapped
+	}
+	wrapped := false
+	for _, child := range ast.Children(node) {
+		if _, ok := u.comments[child]; ok || u.hasComments(child) {
+			wrapped = true
+			break
+		}
+	}
+	u.wrapped[node] = wrapped
+	return wrapped
+}
+
+// anyComments reports whether comments are attached to or below nodes
+func (u *unparser) anyComments(nodes []ast.ASTNode) bool {
+	for _, node := range nodes {
+		if _, ok := u.comments[node]; ok || u.hasComments(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// commented adds the comments of node to line, a line that starts at the
+// indentation of depth unless midLine is set
+func (u *unparser) commented(node ast.ASTNode, line string, depth int, midLine bool) string {
+	c, ok := u.comments[node]
+	if !ok {
+		return line
+	}
+	var b strings.Builder
+	for _, text := range c.leading {
+		if midLine {
+			b.WriteString(text + "\n" + u.indent(depth))
+		} else {
+			b.WriteString(u.indent(depth) + text + "\n")
+		}
+	}
+	b.WriteString(line)
+	if len(c.trailing) > 0 {
+		b.WriteString(" " + strings.Join(c.trailing, " "))
+	}
+	return b.String()
+}
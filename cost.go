@@ -0,0 +1,370 @@
+package sl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yywing/sl/ast"
+)
+
+// RunOptions bounds the work of an evaluation
+type RunOptions struct {
+	// CostLimit is the maximum cost of an evaluation, 0 means no limit.
+	// Every evaluated node costs 1 and every function call costs what the
+	// function declares (see ast.CallCoster).
+	CostLimit uint64
+}
+
+// CostLimitError is returned when an evaluation exceeds RunOptions.CostLimit
+type CostLimitError struct {
+	Limit uint64
+	Cost  uint64
+	Node  ast.ASTNode
+}
+
+func (e *CostLimitError) Error() string {
+	return fmt.Sprintf("cost limit exceeded: cost %d, limit %d", e.Cost, e.Limit)
+}
+
+func (e *CostLimitError) Location() ast.Location {
+	if e.Node == nil {
+		return ast.NoLocation
+	}
+	return e.Node.Location()
+}
+
+// budget counts the cost of an evaluation, it stops the evaluation when ctx is
+// done or the limit is exceeded
+type budget struct {
+	ctx   context.Context
+	limit uint64
+	cost  uint64
+}
+
+func (b *budget) add(node ast.ASTNode, cost uint64) error {
+	if b.ctx != nil {
+		select {
+		case <-b.ctx.Done():
+			return b.ctx.Err()
+		default:
+		}
+	}
+
+	b.cost += cost
+	if b.limit > 0 && b.cost > b.limit {
+		return &CostLimitError{
+			Limit: b.limit,
+			Cost:  b.cost,
+			Node:  node,
+		}
+	}
+	return nil
+}
+
+// isBudgetError reports whether err stops the evaluation because ctx is done or
+// the cost limit is exceeded, such errors are never absorbed
+func isBudgetError(err error) bool {
+	var costErr *CostLimitError
+	return errors.As(err, &costErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// estimateCost estimates the range of the cost of the checked program, as
+// counted by RunContext
+func (tc *Checker) estimateCost() (ast.CostEstimate, error) {
+	estimator := &costEstimator{checker: tc}
+	result, err := estimator.estimate(tc.program.ASTNode)
+	if err != nil {
+		return ast.CostEstimate{}, err
+	}
+	return result.cost, nil
+}
+
+type estimate struct {
+	cost ast.CostEstimate
+	size ast.SizeEstimate
+}
+
+// costEstimator mirrors the costs counted by Runner on a checked AST
+type costEstimator struct {
+	checker *Checker
+	locals  *scope[ast.SizeEstimate]
+}
+
+var nodeCost = ast.CostEstimate{Min: 1, Max: 1}
+
+func (ce *costEstimator) estimate(node ast.ASTNode) (estimate, error) {
+	result, err := node.Accept(ce)
+	if err != nil {
+		return estimate{}, err
+	}
+	if e, ok := result.(estimate); ok {
+		return e, nil
+	}
+	return estimate{}, fmt.Errorf("internal error: cost estimator returned non-estimate")
+}
+
+// typeSize returns the size of a node from its checked type
+func (ce *costEstimator) typeSize(node ast.ASTNode) ast.SizeEstimate {
+	t, ok := ce.checker.TypeOf(node)
+	if !ok {
+		return ast.UnknownSize
+	}
+	return sizeOfType(t)
+}
+
+func sizeOfType(t ast.ValueType) ast.SizeEstimate {
+	switch t.Kind() {
+	case ast.TypeKindString, ast.TypeKindBytes, ast.TypeKindList, ast.TypeKindMap, ast.TypeKindAny:
+		return ast.UnknownSize
+	default:
+		return ast.SizeEstimate{Min: 1, Max: 1}
+	}
+}
+
+// hintSize returns the declared size of identifiers and member paths like a.b.c
+func (ce *costEstimator) hintSize(node ast.ASTNode) (ast.SizeEstimate, bool) {
+	path, ok := qualifiedName(node)
+	if !ok {
+		return ast.SizeEstimate{}, false
+	}
+	// locals are not program variables
+	root, _, _ := strings.Cut(path, ".")
+	if _, isLocal := ce.locals.lookup(root); isLocal {
+		return ast.SizeEstimate{}, false
+	}
+	return ce.checker.program.GetSize(path)
+}
+
+func qualifiedName(node ast.ASTNode) (string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentNode:
+		return n.Name, true
+	case *ast.MemberAccessNode:
+		object, ok := qualifiedName(n.Object)
+		if !ok {
+			return "", false
+		}
+		return object + "." + n.Member, true
+	default:
+		return "", false
+	}
+}
+
+func (ce *costEstimator) VisitLiteral(node *ast.LiteralNode) (interface{}, error) {
+	size := ast.ValueSize(node.Value)
+	return estimate{cost: nodeCost, size: ast.SizeEstimate{Min: size, Max: size}}, nil
+}
+
+func (ce *costEstimator) VisitIdent(node *ast.IdentNode) (interface{}, error) {
+	if size, exists := ce.locals.lookup(node.Name); exists {
+		return estimate{cost: nodeCost, size: size}, nil
+	}
+	if size, exists := ce.hintSize(node); exists {
+		return estimate{cost: nodeCost, size: size}, nil
+	}
+	return estimate{cost: nodeCost, size: ce.typeSize(node)}, nil
+}
+
+func (ce *costEstimator) VisitMemberAccess(node *ast.MemberAccessNode) (interface{}, error) {
+	object, err := ce.estimate(node.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	size, exists := ce.hintSize(node)
+	if !exists {
+		size = ce.typeSize(node)
+	}
+	return estimate{cost: nodeCost.Add(object.cost), size: size}, nil
+}
+
+func (ce *costEstimator) VisitFunctionCall(node *ast.FunctionCallNode) (interface{}, error) {
+	fnName, args, ok := ce.checker.resolveCheckedCall(node)
+	if !ok {
+		return nil, fmt.Errorf("function call must be an identifier or member access, got %s", node.Function.String())
+	}
+
+	cost := nodeCost
+	sizes := make([]ast.SizeEstimate, len(args))
+	costs := make([]ast.CostEstimate, len(args))
+	for i, arg := range args {
+		e, err := ce.estimate(arg)
+		if err != nil {
+			return nil, err
+		}
+		cost = cost.Add(e.cost)
+		sizes[i], costs[i] = e.size, e.cost
+	}
+
+	// the right operand of && and || is skipped when the left one decides
+	if _, ok := logicalOperator(fnName, args); ok {
+		cost = nodeCost.Add(costs[0]).Add(ast.CostEstimate{Max: costs[1].Max})
+		return estimate{cost: cost, size: ce.typeSize(node)}, nil
+	}
+
+	callCost := ast.CostEstimate{Min: 1, Max: 1}
+	if fn, exists := ce.checker.env.GetFunction(fnName); exists {
+		overload, checked := ce.checker.overloads[node]
+		if bf, ok := fn.(*ast.BaseFunction); ok && checked && overload < len(bf.Definitions) {
+			if hint := bf.Definitions[overload].CostHint; hint != nil {
+				callCost = hint(sizes)
+			}
+		}
+	}
+
+	return estimate{cost: cost.Add(callCost), size: ce.typeSize(node)}, nil
+}
+
+func (ce *costEstimator) VisitIndex(node *ast.IndexNode) (interface{}, error) {
+	object, err := ce.estimate(node.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := ce.estimate(node.Index)
+	if err != nil {
+		return nil, err
+	}
+	return estimate{cost: nodeCost.Add(object.cost).Add(index.cost), size: ce.typeSize(node)}, nil
+}
+
+func (ce *costEstimator) VisitConditional(node *ast.ConditionalNode) (interface{}, error) {
+	condition, err := ce.estimate(node.Condition)
+	if err != nil {
+		return nil, err
+	}
+	trueExpr, err := ce.estimate(node.TrueExpr)
+	if err != nil {
+		return nil, err
+	}
+	falseExpr, err := ce.estimate(node.FalseExpr)
+	if err != nil {
+		return nil, err
+	}
+	return estimate{
+		cost: nodeCost.Add(condition.cost).Add(trueExpr.cost.Union(falseExpr.cost)),
+		size: trueExpr.size.Union(falseExpr.size),
+	}, nil
+}
+
+func (ce *costEstimator) VisitList(node *ast.ListNode) (interface{}, error) {
+	cost := nodeCost
+	for _, elem := range node.Elements {
+		e, err := ce.estimate(elem)
+		if err != nil {
+			return nil, err
+		}
+		cost = cost.Add(e.cost)
+	}
+	size := uint64(len(node.Elements))
+	return estimate{cost: cost, size: ast.SizeEstimate{Min: size, Max: size}}, nil
+}
+
+func (ce *costEstimator) VisitMap(node *ast.MapNode) (interface{}, error) {
+	cost := nodeCost
+	for _, entry := range node.Entries {
+		key, err := ce.estimate(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := ce.estimate(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		cost = cost.Add(key.cost).Add(value.cost)
+	}
+	size := uint64(len(node.Entries))
+	return estimate{cost: cost, size: ast.SizeEstimate{Min: size, Max: size}}, nil
+}
+
+func (ce *costEstimator) VisitStruct(node *ast.StructNode) (interface{}, error) {
+	cost := nodeCost
+	for _, field := range node.Fields {
+		e, err := ce.estimate(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		cost = cost.Add(e.cost)
+	}
+	return estimate{cost: cost, size: ce.typeSize(node)}, nil
+}
+
+func (ce *costEstimator) VisitComprehension(node *ast.ComprehensionNode) (interface{}, error) {
+	iterRange, err := ce.estimate(node.IterRange)
+	if err != nil {
+		return nil, err
+	}
+	accuInit, err := ce.estimate(node.AccuInit)
+	if err != nil {
+		return nil, err
+	}
+
+	iterSize := ast.UnknownSize
+	switch t, _ := ce.checker.TypeOf(node.IterRange); rt := t.(type) {
+	case *ast.ListType:
+		iterSize = sizeOfType(rt.ElementType())
+	case *ast.MapType:
+		iterSize = sizeOfType(rt.KeyType())
+	}
+
+	// accumulated lists, e.g. map and filter, grow at most by one element per iteration
+	accuSize := accuInit.size
+	if _, ok := node.AccuInit.(*ast.ListNode); ok {
+		accuSize = ast.SizeEstimate{Min: accuInit.size.Min, Max: accuInit.size.Add(iterRange.size).Max}
+	}
+
+	outer := ce.locals
+	defer func() { ce.locals = outer }()
+
+	ce.locals = outer.push(node.AccuVar, accuSize).push(node.IterVar, iterSize)
+	condition, err := ce.estimate(node.LoopCondition)
+	if err != nil {
+		return nil, err
+	}
+	step, err := ce.estimate(node.LoopStep)
+	if err != nil {
+		return nil, err
+	}
+
+	loop := condition.cost.Add(step.cost).Multiply(iterRange.size)
+	if literal, ok := node.LoopCondition.(*ast.LiteralNode); !ok || !literal.Value.Equal(ast.NewBoolValue(true)) {
+		// the loop may stop after the first condition
+		loop.Min = condition.cost.Min * min(iterRange.size.Min, 1)
+	}
+
+	ce.locals = outer.push(node.AccuVar, accuSize)
+	result, err := ce.estimate(node.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := nodeCost.Add(iterRange.cost).Add(accuInit.cost).Add(loop).Add(result.cost)
+	return estimate{cost: cost, size: result.size}, nil
+}
+
+func (ce *costEstimator) VisitBind(node *ast.BindNode) (interface{}, error) {
+	init, err := ce.estimate(node.Init)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := ce.locals
+	defer func() { ce.locals = outer }()
+
+	// the initializer is evaluated once, however often the name is used
+	ce.locals = outer.push(node.Name, init.size)
+	result, err := ce.estimate(node.Result)
+	if err != nil {
+		return nil, err
+	}
+	return estimate{cost: nodeCost.Add(init.cost).Add(result.cost), size: result.size}, nil
+}
+
+func (ce *costEstimator) VisitPresenceTest(node *ast.PresenceTestNode) (interface{}, error) {
+	object, err := ce.estimate(node.Object)
+	if err != nil {
+		return nil, err
+	}
+	return estimate{cost: nodeCost.Add(object.cost), size: ast.SizeEstimate{Min: 1, Max: 1}}, nil
+}
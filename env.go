@@ -1,13 +1,17 @@
 package sl
 
 import (
+	"context"
+
 	"github.com/yywing/sl/ast"
 	"github.com/yywing/sl/lib/functions"
+	"github.com/yywing/sl/lib/types"
 )
 
 // Env represents the execution environment, containing variables and functions
 type Env struct {
-	functions map[string]ast.Function // function mapping
+	functions map[string]ast.Function   // function mapping
+	types     map[string]ast.StructType // types built by struct expressions
 }
 
 // SetFunction sets a function
@@ -32,23 +36,58 @@ func (e *Env) Functions() []string {
 	return names
 }
 
+// SetType sets a type that struct expressions build, e.g. HTTPRequest{...}.
+// Decoding serialized ASTs that use it requires codec.RegisterType.
+func (e *Env) SetType(name string, t ast.StructType) {
+	e.types[name] = t
+}
+
+// GetType gets a type set by SetType
+func (e *Env) GetType(name string) (ast.StructType, bool) {
+	if t, exists := e.types[name]; exists {
+		return t, true
+	}
+	return nil, false
+}
+
+// Types returns all type names
+func (e *Env) Types() []string {
+	var names []string
+	for name := range e.types {
+		names = append(names, name)
+	}
+	return names
+}
+
 func (e *Env) Check(p *Program) (ast.ValueType, error) {
 	checker := NewChecker(e, p)
 	return checker.Check()
 }
 
+// CheckAll checks the program and returns every type error instead of only the first
+func (e *Env) CheckAll(p *Program) (ast.ValueType, *Issues) {
+	checker := NewChecker(e, p)
+	return checker.CheckAll()
+}
+
 func (e *Env) Run(p *Program, variables Variables) (ast.Value, error) {
+	return e.RunContext(context.Background(), p, variables, RunOptions{})
+}
+
+// RunContext runs the program until ctx is done or the cost limit in opts is exceeded
+func (e *Env) RunContext(ctx context.Context, p *Program, variables Variables, opts RunOptions) (ast.Value, error) {
 	if err := p.CheckVariables(variables); err != nil {
 		return nil, err
 	}
 
-	runner := NewRunner(e, p, variables)
+	runner := NewRunnerContext(ctx, e, p, variables, opts)
 	return runner.Eval()
 }
 
 func newEnv() *Env {
 	return &Env{
 		functions: make(map[string]ast.Function),
+		types:     make(map[string]ast.StructType),
 	}
 }
 
@@ -68,6 +107,9 @@ func NewStdEnv() *Env {
 	for name, fn := range functions.LibFunctions {
 		env.SetFunction(name, fn)
 	}
+	for name, t := range types.LibStructTypes {
+		env.SetType(name, t)
+	}
 
 	return env
 }
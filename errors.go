@@ -0,0 +1,101 @@
+package sl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yywing/sl/ast"
+)
+
+// LocatedError is an error that knows which part of the expression caused it,
+// ParseError, CheckError, RuntimeError and CostLimitError all implement it
+type LocatedError interface {
+	error
+	Location() ast.Location
+}
+
+// FormatError renders err followed by the source line it refers to, with the
+// offending part of the expression underlined:
+//
+//	type check error: undefined variable: reqest
+//	  |
+//	2 | && reqest.method == "GET"
+//	  |    ^^^^^^
+//
+// Errors without a location are returned as is.
+func FormatError(expression string, err error) string {
+	var located LocatedError
+	if !errors.As(err, &located) {
+		return err.Error()
+	}
+
+	source := []rune(expression)
+	loc := located.Location()
+	if !loc.IsValid() {
+		// syntax errors at the end of input only know their line and column
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			return err.Error()
+		}
+		offset, ok := lineColumnOffset(source, parseErr.Line, parseErr.Column)
+		if !ok {
+			return err.Error()
+		}
+		loc = ast.Location{Start: offset, Stop: offset + 1}
+	}
+	if loc.Start > len(source) {
+		return err.Error()
+	}
+
+	line, lineStart := 1, 0
+	for i := 0; i < loc.Start; i++ {
+		if source[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+	lineEnd := lineStart
+	for lineEnd < len(source) && source[lineEnd] != '\n' {
+		lineEnd++
+	}
+	stop := min(loc.Stop, lineEnd)
+
+	var underline strings.Builder
+	for i := lineStart; i < loc.Start; i++ {
+		if source[i] == '\t' {
+			underline.WriteByte('\t')
+		} else {
+			underline.WriteByte(' ')
+		}
+	}
+	underline.WriteString(strings.Repeat("^", max(stop-loc.Start, 1)))
+
+	number := fmt.Sprintf("%d", line)
+	gutter := strings.Repeat(" ", len(number))
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", err.Error())
+	fmt.Fprintf(&b, "%s |\n", gutter)
+	fmt.Fprintf(&b, "%s | %s\n", number, string(source[lineStart:lineEnd]))
+	fmt.Fprintf(&b, "%s | %s", gutter, underline.String())
+	return b.String()
+}
+
+// lineColumnOffset converts a 1-based line and 0-based column, as reported by
+// the parser, into a character offset
+func lineColumnOffset(source []rune, line, column int) (int, bool) {
+	offset := 0
+	for current := 1; current < line; current++ {
+		for offset < len(source) && source[offset] != '\n' {
+			offset++
+		}
+		if offset == len(source) {
+			return 0, false
+		}
+		offset++
+	}
+	if offset+column > len(source) {
+		return 0, false
+	}
+	return offset + column, true
+}
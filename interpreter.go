@@ -0,0 +1,752 @@
+package sl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/yywing/sl/ast"
+)
+
+// Interpretable is a node of a compiled program
+type Interpretable interface {
+	// Node returns the AST node the interpretable was compiled from
+	Node() ast.ASTNode
+	Eval(act *Activation) (ast.Value, error)
+}
+
+// Activation holds the variables and the cost of one evaluation of a compiled
+// program
+type Activation struct {
+	slots []ast.Value
+
+	budget
+}
+
+// Cost returns the cost of the evaluation so far, function costs are only
+// counted with a cost limit
+func (act *Activation) Cost() uint64 {
+	return act.cost
+}
+
+// CompiledProgram is a checked program compiled for repeated evaluation:
+// variables are resolved to slots, the overload chosen by the checker is bound
+// at each call site and constant subexpressions are folded. It is safe for
+// concurrent use.
+type CompiledProgram struct {
+	program   *Program
+	root      Interpretable
+	variables []string
+	slots     int
+}
+
+// Compile checks the program and compiles it
+func (e *Env) Compile(p *Program) (*CompiledProgram, error) {
+	checker := NewChecker(e, p)
+	if _, err := checker.Check(); err != nil {
+		return nil, err
+	}
+
+	c := &compiler{env: e, checker: checker}
+	c.variables = p.Variables()
+	sort.Strings(c.variables)
+	for _, name := range c.variables {
+		c.declare(name)
+	}
+
+	root, err := c.compile(p.ASTNode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompiledProgram{
+		program:   p,
+		root:      root,
+		variables: c.variables,
+		slots:     c.slots,
+	}, nil
+}
+
+// Root returns the root of the compiled program
+func (cp *CompiledProgram) Root() Interpretable {
+	return cp.root
+}
+
+// Eval evaluates the program with variables
+func (cp *CompiledProgram) Eval(variables Variables) (ast.Value, error) {
+	return cp.EvalContext(context.Background(), variables, RunOptions{})
+}
+
+// EvalContext evaluates the program until ctx is done or the cost limit in opts
+// is exceeded
+func (cp *CompiledProgram) EvalContext(ctx context.Context, variables Variables, opts RunOptions) (ast.Value, error) {
+	if err := cp.program.CheckVariables(variables); err != nil {
+		return nil, err
+	}
+
+	act := &Activation{
+		slots:  make([]ast.Value, cp.slots),
+		budget: budget{ctx: ctx, limit: opts.CostLimit},
+	}
+	for i, name := range cp.variables {
+		act.slots[i] = variables[name]
+	}
+	return cp.root.Eval(act)
+}
+
+type compiler struct {
+	env     *Env
+	checker *Checker
+
+	variables []string
+	names     *scope[int]
+	slots     int
+}
+
+func (c *compiler) declare(name string) int {
+	slot := c.slots
+	c.slots++
+	c.names = c.names.push(name, slot)
+	return slot
+}
+
+func (c *compiler) compile(node ast.ASTNode) (Interpretable, error) {
+	result, err := node.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := result.(Interpretable)
+	if !ok {
+		return nil, fmt.Errorf("internal error: compiler returned non-interpretable")
+	}
+	return c.fold(i), nil
+}
+
+func (c *compiler) compileAll(nodes []ast.ASTNode) ([]Interpretable, error) {
+	results := make([]Interpretable, len(nodes))
+	for i, node := range nodes {
+		result, err := c.compile(node)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// fold evaluates i once when it only depends on constants, errors are left to
+// be reported when the program runs
+func (c *compiler) fold(i Interpretable) Interpretable {
+	if !c.foldable(i) {
+		return i
+	}
+	value, err := i.Eval(&Activation{})
+	if err != nil {
+		return i
+	}
+	return &evalConst{node: i.Node(), value: value}
+}
+
+func (c *compiler) foldable(i Interpretable) bool {
+	switch i := i.(type) {
+	case *evalCall:
+		return isPure(i.fn) && allConst(i.args...)
+	case *evalLogical:
+		return allConst(i.left, i.right)
+	case *evalSelect:
+		return allConst(i.object)
+	case *evalIndex:
+		return allConst(i.object, i.index)
+	case *evalList:
+		return allConst(i.elements...)
+	case *evalMap:
+		return allConst(i.keys...) && allConst(i.values...)
+	case *evalPresenceTest:
+		return allConst(i.object)
+	}
+	return false
+}
+
+func isPure(fn ast.Function) bool {
+	p, ok := fn.(ast.Purity)
+	return ok && p.Pure()
+}
+
+func allConst(is ...Interpretable) bool {
+	for _, i := range is {
+		if _, ok := i.(*evalConst); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// concreteType reports whether a value of type t always has the type t at
+// runtime, so that an overload chosen by the checker can be bound
+func concreteType(t ast.ValueType) bool {
+	switch t := t.(type) {
+	case *ast.ListType:
+		return concreteType(t.ElementType())
+	case *ast.MapType:
+		return concreteType(t.KeyType()) && concreteType(t.ValueType())
+	case *ast.OptionalType:
+		// optional.none() has no element type
+		return false
+	}
+	return t.Kind() != ast.TypeKindAny && !t.IsDyn()
+}
+
+func (c *compiler) VisitLiteral(node *ast.LiteralNode) (interface{}, error) {
+	return &evalConst{node: node, value: node.Value}, nil
+}
+
+func (c *compiler) VisitIdent(node *ast.IdentNode) (interface{}, error) {
+	slot, ok := c.names.lookup(node.Name)
+	if !ok {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("undefined identifier: %s", node.Name),
+			Node:    node,
+		}
+	}
+	return &evalIdent{node: node, slot: slot}, nil
+}
+
+func (c *compiler) VisitMemberAccess(node *ast.MemberAccessNode) (interface{}, error) {
+	object, err := c.compile(node.Object)
+	if err != nil {
+		return nil, err
+	}
+	return &evalSelect{node: node, object: object}, nil
+}
+
+func (c *compiler) VisitFunctionCall(node *ast.FunctionCallNode) (interface{}, error) {
+	fnName, args, ok := c.checker.resolveCheckedCall(node)
+	if !ok {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("function call must be an identifier or member access, got %s", node.Function.String()),
+			Node:    node,
+		}
+	}
+
+	fn, ok := c.env.GetFunction(fnName)
+	if !ok {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("function %s not found", fnName),
+			Node:    node,
+		}
+	}
+
+	compiled, err := c.compileAll(args)
+	if err != nil {
+		return nil, err
+	}
+	if absorbing, ok := logicalOperator(fnName, args); ok {
+		return &evalLogical{node: node, left: compiled[0], right: compiled[1], absorbing: absorbing}, nil
+	}
+	call := &evalCall{node: node, fn: fn, args: compiled}
+
+	// bind the overload chosen by the checker, unless the arguments may have
+	// other types at runtime
+	base, ok := fn.(*ast.BaseFunction)
+	index, checked := c.checker.overloads[node]
+	if !ok || !checked || index >= len(base.Definitions) {
+		return call, nil
+	}
+	for _, arg := range args {
+		if t, ok := c.checker.TypeOf(arg); !ok || !concreteType(t) {
+			return call, nil
+		}
+	}
+	call.overload = &base.Definitions[index]
+	return call, nil
+}
+
+func (c *compiler) VisitIndex(node *ast.IndexNode) (interface{}, error) {
+	object, err := c.compile(node.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.compile(node.Index)
+	if err != nil {
+		return nil, err
+	}
+	return &evalIndex{node: node, object: object, index: index}, nil
+}
+
+func (c *compiler) VisitConditional(node *ast.ConditionalNode) (interface{}, error) {
+	condition, err := c.compile(node.Condition)
+	if err != nil {
+		return nil, err
+	}
+	trueExpr, err := c.compile(node.TrueExpr)
+	if err != nil {
+		return nil, err
+	}
+	falseExpr, err := c.compile(node.FalseExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	// a constant condition selects its branch at compile time
+	if cond, ok := condition.(*evalConst); ok {
+		if result, err := conditionValue(node, cond.value); err == nil {
+			if result {
+				return trueExpr, nil
+			}
+			return falseExpr, nil
+		}
+	}
+	return &evalConditional{node: node, condition: condition, trueExpr: trueExpr, falseExpr: falseExpr}, nil
+}
+
+func (c *compiler) VisitList(node *ast.ListNode) (interface{}, error) {
+	elements, err := c.compileAll(node.Elements)
+	if err != nil {
+		return nil, err
+	}
+	return &evalList{node: node, elements: elements}, nil
+}
+
+func (c *compiler) VisitMap(node *ast.MapNode) (interface{}, error) {
+	keys := make([]ast.ASTNode, len(node.Entries))
+	values := make([]ast.ASTNode, len(node.Entries))
+	for i, entry := range node.Entries {
+		keys[i], values[i] = entry.Key, entry.Value
+	}
+
+	m := &evalMap{node: node}
+	var err error
+	if m.keys, err = c.compileAll(keys); err != nil {
+		return nil, err
+	}
+	if m.values, err = c.compileAll(values); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *compiler) VisitStruct(node *ast.StructNode) (interface{}, error) {
+	structType, ok := c.env.GetType(node.TypeName)
+	if !ok {
+		return nil, &CheckError{
+			Message: fmt.Sprintf("undefined type: %s", node.TypeName),
+			Node:    node,
+		}
+	}
+
+	values := make([]ast.ASTNode, len(node.Fields))
+	for i, field := range node.Fields {
+		values[i] = field.Value
+	}
+	fields, err := c.compileAll(values)
+	if err != nil {
+		return nil, err
+	}
+	return &evalStruct{node: node, structType: structType, fields: fields}, nil
+}
+
+func (c *compiler) VisitComprehension(node *ast.ComprehensionNode) (interface{}, error) {
+	iterRange, err := c.compile(node.IterRange)
+	if err != nil {
+		return nil, err
+	}
+	accuInit, err := c.compile(node.AccuInit)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := c.names
+	defer func() { c.names = outer }()
+
+	comp := &evalComprehension{node: node, iterRange: iterRange, accuInit: accuInit}
+	comp.accuSlot = c.declare(node.AccuVar)
+	comp.iterSlot = c.declare(node.IterVar)
+	if comp.loopCondition, err = c.compile(node.LoopCondition); err != nil {
+		return nil, err
+	}
+	if comp.loopStep, err = c.compile(node.LoopStep); err != nil {
+		return nil, err
+	}
+
+	// only the accumulator is in scope of the result
+	c.names = outer.push(node.AccuVar, comp.accuSlot)
+	if comp.result, err = c.compile(node.Result); err != nil {
+		return nil, err
+	}
+	return comp, nil
+}
+
+func (c *compiler) VisitBind(node *ast.BindNode) (interface{}, error) {
+	init, err := c.compile(node.Init)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := c.names
+	defer func() { c.names = outer }()
+
+	bind := &evalBind{node: node, init: init}
+	bind.slot = c.declare(node.Name)
+	if bind.result, err = c.compile(node.Result); err != nil {
+		return nil, err
+	}
+	return bind, nil
+}
+
+func (c *compiler) VisitPresenceTest(node *ast.PresenceTestNode) (interface{}, error) {
+	object, err := c.compile(node.Object)
+	if err != nil {
+		return nil, err
+	}
+	return &evalPresenceTest{node: node, object: object}, nil
+}
+
+type evalConst struct {
+	node  ast.ASTNode
+	value ast.Value
+}
+
+func (e *evalConst) Node() ast.ASTNode { return e.node }
+
+func (e *evalConst) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	return e.value, nil
+}
+
+type evalIdent struct {
+	node *ast.IdentNode
+	slot int
+}
+
+func (e *evalIdent) Node() ast.ASTNode { return e.node }
+
+func (e *evalIdent) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	if value := act.slots[e.slot]; value != nil {
+		return localValue(value)
+	}
+	return nil, &RuntimeError{
+		Message: fmt.Sprintf("undefined identifier: %s", e.node.Name),
+		Node:    e.node,
+	}
+}
+
+type evalSelect struct {
+	node   *ast.MemberAccessNode
+	object Interpretable
+}
+
+func (e *evalSelect) Node() ast.ASTNode { return e.node }
+
+func (e *evalSelect) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	object, err := e.object.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+	return selectMember(e.node, object)
+}
+
+type evalCall struct {
+	node *ast.FunctionCallNode
+	fn   ast.Function
+	args []Interpretable
+	// overload is the definition bound at compile time, nil when the
+	// function is resolved by the types of the arguments on each call
+	overload *ast.Definition
+}
+
+func (e *evalCall) Node() ast.ASTNode { return e.node }
+
+func (e *evalCall) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+
+	args := make([]ast.Value, len(e.args))
+	for i, arg := range e.args {
+		value, err := arg.Eval(act)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	if act.limit > 0 {
+		if err := act.add(e.node, e.cost(args)); err != nil {
+			return nil, err
+		}
+	}
+
+	var result ast.Value
+	var err error
+	if e.overload != nil {
+		result, err = e.overload.Call(ast.ConvertArgs(e.overload.Type.ParamTypes(), args))
+	} else {
+		result, err = e.fn.Call(args)
+	}
+	if err != nil {
+		return nil, callError(e.node, err)
+	}
+	return result, nil
+}
+
+// evalLogical is && or ||, see Runner.logical
+type evalLogical struct {
+	node        *ast.FunctionCallNode
+	left, right Interpretable
+	absorbing   bool
+}
+
+func (e *evalLogical) Node() ast.ASTNode { return e.node }
+
+func (e *evalLogical) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	left, leftErr := e.left.Eval(act)
+	if isAbsorbing(left, leftErr, e.absorbing) {
+		return left, nil
+	}
+	right, rightErr := e.right.Eval(act)
+	if isAbsorbing(right, rightErr, e.absorbing) {
+		return right, nil
+	}
+	return logicalResult(e.node, left, right, leftErr, rightErr)
+}
+
+func (e *evalCall) cost(args []ast.Value) uint64 {
+	if e.overload != nil {
+		if e.overload.Cost == nil {
+			return 1
+		}
+		return e.overload.Cost(args)
+	}
+	if coster, ok := e.fn.(ast.CallCoster); ok {
+		return coster.Cost(args)
+	}
+	return 1
+}
+
+type evalIndex struct {
+	node   *ast.IndexNode
+	object Interpretable
+	index  Interpretable
+}
+
+func (e *evalIndex) Node() ast.ASTNode { return e.node }
+
+func (e *evalIndex) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	object, err := e.object.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.index.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+	return indexValue(e.node, object, index)
+}
+
+type evalConditional struct {
+	node      *ast.ConditionalNode
+	condition Interpretable
+	trueExpr  Interpretable
+	falseExpr Interpretable
+}
+
+func (e *evalConditional) Node() ast.ASTNode { return e.node }
+
+func (e *evalConditional) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	condition, err := e.condition.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+	result, err := conditionValue(e.node, condition)
+	if err != nil {
+		return nil, err
+	}
+	if result {
+		return e.trueExpr.Eval(act)
+	}
+	return e.falseExpr.Eval(act)
+}
+
+type evalList struct {
+	node     *ast.ListNode
+	elements []Interpretable
+}
+
+func (e *evalList) Node() ast.ASTNode { return e.node }
+
+func (e *evalList) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	values := make([]ast.Value, len(e.elements))
+	for i, elem := range e.elements {
+		value, err := elem.Eval(act)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return newListValue(e.node, values)
+}
+
+type evalMap struct {
+	node   *ast.MapNode
+	keys   []Interpretable
+	values []Interpretable
+}
+
+func (e *evalMap) Node() ast.ASTNode { return e.node }
+
+func (e *evalMap) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	keys := make([]ast.Value, len(e.keys))
+	values := make([]ast.Value, len(e.values))
+	for i := range e.keys {
+		key, err := e.keys[i].Eval(act)
+		if err != nil {
+			return nil, err
+		}
+		value, err := e.values[i].Eval(act)
+		if err != nil {
+			return nil, err
+		}
+		keys[i], values[i] = key, value
+	}
+	return newMapValue(e.node, keys, values)
+}
+
+type evalStruct struct {
+	node       *ast.StructNode
+	structType ast.StructType
+	fields     []Interpretable
+}
+
+func (e *evalStruct) Node() ast.ASTNode { return e.node }
+
+func (e *evalStruct) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	values := make([]ast.Value, len(e.fields))
+	for i, field := range e.fields {
+		value, err := field.Eval(act)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return newStructValue(e.node, e.structType, values)
+}
+
+type evalComprehension struct {
+	node          *ast.ComprehensionNode
+	iterRange     Interpretable
+	accuInit      Interpretable
+	loopCondition Interpretable
+	loopStep      Interpretable
+	result        Interpretable
+	accuSlot      int
+	iterSlot      int
+}
+
+func (e *evalComprehension) Node() ast.ASTNode { return e.node }
+
+func (e *evalComprehension) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	iterRange, err := e.iterRange.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+	items, err := rangeItems(e.node, iterRange)
+	if err != nil {
+		return nil, err
+	}
+
+	accu, err := e.accuInit.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		act.slots[e.accuSlot] = accu
+		act.slots[e.iterSlot] = item
+
+		condition, err := e.loopCondition.Eval(act)
+		ok, err := loopCondition(e.node, condition, err)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		accu, err = loopStep(e.loopStep.Eval(act))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	act.slots[e.accuSlot] = accu
+	act.slots[e.iterSlot] = nil
+	return e.result.Eval(act)
+}
+
+type evalBind struct {
+	node   *ast.BindNode
+	init   Interpretable
+	result Interpretable
+	slot   int
+}
+
+func (e *evalBind) Node() ast.ASTNode { return e.node }
+
+func (e *evalBind) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	value, err := e.init.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+	act.slots[e.slot] = value
+	return e.result.Eval(act)
+}
+
+type evalPresenceTest struct {
+	node   *ast.PresenceTestNode
+	object Interpretable
+}
+
+func (e *evalPresenceTest) Node() ast.ASTNode { return e.node }
+
+func (e *evalPresenceTest) Eval(act *Activation) (ast.Value, error) {
+	if err := act.add(e.node, 1); err != nil {
+		return nil, err
+	}
+	object, err := e.object.Eval(act)
+	if err != nil {
+		return nil, err
+	}
+	return testPresence(e.node, object)
+}
@@ -0,0 +1,64 @@
+package sl
+
+import (
+	"strings"
+)
+
+// Issues collects every error found in an expression instead of stopping at
+// the first one, see ParseAll and Env.CheckAll
+type Issues struct {
+	errors []error
+}
+
+// Add appends err to the issues, nil errors are ignored
+func (i *Issues) Add(err error) {
+	if err != nil {
+		i.errors = append(i.errors, err)
+	}
+}
+
+// Errors returns the collected errors in the order they were found
+func (i *Issues) Errors() []error {
+	if i == nil {
+		return nil
+	}
+	return i.errors
+}
+
+// Len returns the number of collected errors
+func (i *Issues) Len() int {
+	if i == nil {
+		return 0
+	}
+	return len(i.errors)
+}
+
+// Err returns the issues as an error, or nil when there are none
+func (i *Issues) Err() error {
+	if i.Len() == 0 {
+		return nil
+	}
+	return i
+}
+
+func (i *Issues) Error() string {
+	messages := make([]string, len(i.errors))
+	for j, err := range i.errors {
+		messages[j] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap allows errors.As and errors.Is to match any of the collected errors
+func (i *Issues) Unwrap() []error {
+	return i.errors
+}
+
+// Format renders every error with FormatError
+func (i *Issues) Format(expression string) string {
+	messages := make([]string, len(i.errors))
+	for j, err := range i.errors {
+		messages[j] = FormatError(expression, err)
+	}
+	return strings.Join(messages, "\n")
+}
@@ -8,18 +8,18 @@ import (
 )
 
 func init() {
-	LibFunctions["base64Encode"] = ast.NewBaseFunction(
+	LibFunctions["base64Encode"] = ast.NewPureFunction(
 		"base64Encode",
 		append(
-			native.MustNewNativeFunction("base64Encode", Base64Encode).Definitions(),
-			native.MustNewNativeFunction("base64EncodeBytes", Base64EncodeBytes).Definitions()...,
+			native.MustNewNativeFunction("base64Encode", Base64Encode).WithLinearCost(0.1).Definitions(),
+			native.MustNewNativeFunction("base64EncodeBytes", Base64EncodeBytes).WithLinearCost(0.1).Definitions()...,
 		),
 	)
-	LibFunctions["base64Decode"] = ast.NewBaseFunction(
+	LibFunctions["base64Decode"] = ast.NewPureFunction(
 		"base64Decode",
 		append(
-			native.MustNewNativeFunction("base64Decode", Base64Decode).Definitions(),
-			native.MustNewNativeFunction("base64DecodeBytes", Base64DecodeBytes).Definitions()...,
+			native.MustNewNativeFunction("base64Decode", Base64Decode).WithLinearCost(0.1).Definitions(),
+			native.MustNewNativeFunction("base64DecodeBytes", Base64DecodeBytes).WithLinearCost(0.1).Definitions()...,
 		),
 	)
 }
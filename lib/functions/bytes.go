@@ -0,0 +1,23 @@
+package functions
+
+import (
+	"bytes"
+
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/native"
+)
+
+func init() {
+	LibFunctions["bcontains"] = ast.NewPureFunction("bcontains", native.MustNewNativeFunction("bcontains", BContains).WithLinearCost(0.1).Definitions())
+	LibFunctions["bstartsWith"] = ast.NewPureFunction("bstartsWith", native.MustNewNativeFunction("bstartsWith", BStartsWith).WithLinearCost(0.1).Definitions())
+}
+
+// BContains reports whether sub is within b, like contains for strings
+func BContains(b, sub []byte) bool {
+	return bytes.Contains(b, sub)
+}
+
+// BStartsWith reports whether b begins with prefix, like startsWith for strings
+func BStartsWith(b, prefix []byte) bool {
+	return bytes.HasPrefix(b, prefix)
+}
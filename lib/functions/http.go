@@ -1,16 +1,112 @@
 package functions
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
 	"github.com/yywing/sl/ast"
 	"github.com/yywing/sl/lib/types"
+	"github.com/yywing/sl/native"
 )
 
 func init() {
 	ast.StringFunction.Combine(URLStringFunction)
+	ast.InFunction.Combine(HeadersInFunction)
+	ast.SizeFunction.Combine(HeadersSizeFunction)
+	HasFunction.Combine(HeadersHasFunction)
+	GetFunction.Combine(HeadersGetFunction)
+
+	LibFunctions[FunctionValues] = ValuesFunction
+	LibFunctions[FunctionNames] = NamesFunction
+	LibFunctions[FunctionCookies] = ast.NewPureFunction(
+		FunctionCookies,
+		native.MustNewNativeFunction(FunctionCookies, Cookies).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionSetCookies] = ast.NewPureFunction(
+		FunctionSetCookies,
+		native.MustNewNativeFunction(FunctionSetCookies, SetCookies).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionParseMultipart] = ast.NewPureFunction(
+		FunctionParseMultipart,
+		native.MustNewNativeFunction(FunctionParseMultipart, ParseMultipart).WithLinearCost(0.1).Definitions(),
+	)
+}
+
+const (
+	FunctionValues     = "values"
+	FunctionNames      = "names"
+	FunctionCookies    = "cookies"
+	FunctionSetCookies = "setCookies"
+
+	FunctionParseMultipart = "parseMultipart"
+)
+
+// Cookies returns the cookies sent with the request
+func Cookies(req *types.HTTPRequestValue) []*types.CookieValue {
+	return types.ParseCookies(req.Headers.Values("Cookie"))
+}
+
+// SetCookies returns the cookies set by the response, with their attributes
+func SetCookies(resp *types.HTTPResponseValue) []*types.CookieValue {
+	return types.ParseSetCookies(resp.Headers.Values("Set-Cookie"))
+}
+
+func stringList(values []string) *ast.ListValue {
+	list := make([]ast.Value, len(values))
+	for i, v := range values {
+		list[i] = ast.NewStringValue(v)
+	}
+	return ast.NewListValue(list, ast.StringType)
+}
+
+// ParseMultipart returns the parts of a multipart body, contentType is the
+// Content-Type header with the boundary, e.g. request.content_type
+func ParseMultipart(body []byte, contentType string) ([]*types.MultipartPartValue, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("not a multipart content type: %s", mediaType)
+	}
+	boundary, ok := params["boundary"]
+	if !ok {
+		return nil, fmt.Errorf("no multipart boundary in %s", contentType)
+	}
+
+	// NextRawPart keeps Content-Transfer-Encoding, the content is as sent
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	parts := []*types.MultipartPartValue{}
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		// Part.FileName drops the directories of the filename, keep it as sent
+		_, disposition, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		parts = append(parts, &types.MultipartPartValue{
+			Name:     disposition["name"],
+			Filename: disposition["filename"],
+			Headers:  types.NewHeadersValueFromHTTP(http.Header(part.Header)),
+			Content:  content,
+		})
+	}
 }
 
 var (
-	URLStringFunction = ast.NewBaseFunction(
+	URLStringFunction = ast.NewPureFunction(
 		ast.String,
 		[]ast.Definition{
 			{
@@ -21,4 +117,98 @@ var (
 			},
 		},
 	)
+
+	HeadersInFunction = ast.NewPureFunction(
+		ast.In,
+		[]ast.Definition{
+			{
+				Type: *ast.NewFunctionType(ast.In, []ast.ValueType{ast.StringType, types.HeadersType}, ast.BoolType),
+				Call: func(args []ast.Value) (ast.Value, error) {
+					_, exists := args[1].(*types.HeadersValue).Get(args[0])
+					return ast.NewBoolValue(exists), nil
+				},
+			},
+		},
+	)
+
+	// HeadersSizeFunction returns the number of distinct header names, as for
+	// a map
+	HeadersSizeFunction = ast.NewPureFunction(
+		ast.Size,
+		[]ast.Definition{
+			{
+				Type: *ast.NewFunctionType(ast.Size, []ast.ValueType{types.HeadersType}, ast.IntType),
+				Call: func(args []ast.Value) (ast.Value, error) {
+					return ast.NewIntValue(int64(len(args[0].(*types.HeadersValue).Keys()))), nil
+				},
+			},
+		},
+	)
+
+	HeadersHasFunction = ast.NewPureFunction(
+		FunctionHas,
+		[]ast.Definition{
+			{
+				Type: *ast.NewFunctionType(FunctionHas, []ast.ValueType{types.HeadersType, ast.StringType}, ast.BoolType),
+				Call: func(args []ast.Value) (ast.Value, error) {
+					_, exists := args[0].(*types.HeadersValue).Get(args[1])
+					return ast.NewBoolValue(exists), nil
+				},
+			},
+		},
+	)
+
+	HeadersGetFunction = ast.NewPureFunction(
+		FunctionGet,
+		[]ast.Definition{
+			{
+				Type: *ast.NewFunctionType(FunctionGet, []ast.ValueType{types.HeadersType, ast.StringType}, ast.StringType),
+				Call: func(args []ast.Value) (ast.Value, error) {
+					value, exists := args[0].(*types.HeadersValue).Get(args[1])
+					if !exists {
+						return nil, fmt.Errorf("no such key %s", args[1])
+					}
+					return value, nil
+				},
+			},
+			{
+				Type: *ast.NewFunctionType(FunctionGet, []ast.ValueType{types.HeadersType, ast.StringType, ast.StringType}, ast.StringType),
+				Call: func(args []ast.Value) (ast.Value, error) {
+					value, exists := args[0].(*types.HeadersValue).Get(args[1])
+					if !exists {
+						return args[2], nil
+					}
+					return value, nil
+				},
+			},
+		},
+	)
+
+	// ValuesFunction returns the values of a repeated header in order, e.g.
+	// response.headers.values("Set-Cookie"), the name is case-insensitive
+	ValuesFunction = ast.NewPureFunction(
+		FunctionValues,
+		[]ast.Definition{
+			{
+				Type: *ast.NewFunctionType(FunctionValues, []ast.ValueType{types.HeadersType, ast.StringType}, ast.NewListType(ast.StringType)),
+				Call: func(args []ast.Value) (ast.Value, error) {
+					return stringList(args[0].(*types.HeadersValue).Values(args[1].(*ast.StringValue).StringValue)), nil
+				},
+			},
+		},
+	)
+
+	// NamesFunction returns the name of each header line in order, with its
+	// casing as sent
+	NamesFunction = ast.NewPureFunction(
+		FunctionNames,
+		[]ast.Definition{
+			{
+				Type: *ast.NewFunctionType(FunctionNames, []ast.ValueType{types.HeadersType}, ast.NewListType(ast.StringType)),
+				Call: func(args []ast.Value) (ast.Value, error) {
+					return stringList(args[0].(*types.HeadersValue).Names()), nil
+				},
+			},
+		},
+	)
 )
@@ -8,9 +8,9 @@ import (
 )
 
 func init() {
-	LibFunctions[FunctionJSONPath] = ast.NewBaseFunction(
+	LibFunctions[FunctionJSONPath] = ast.NewPureFunction(
 		FunctionJSONPath,
-		native.MustNewNativeFunction(FunctionJSONPath, JSONPath).Definitions(),
+		native.MustNewNativeFunction(FunctionJSONPath, JSONPath).WithLinearCost(1).Definitions(),
 	)
 }
 
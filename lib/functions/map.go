@@ -21,7 +21,7 @@ var (
 	paramB  = ast.NewValueTypeParamType("B")
 	mapOfAB = ast.NewMapType(paramA, paramB)
 
-	HasFunction = ast.NewBaseFunction(
+	HasFunction = ast.NewPureFunction(
 		FunctionHas,
 		[]ast.Definition{
 			{
@@ -34,7 +34,7 @@ var (
 		},
 	)
 
-	GetFunction = ast.NewBaseFunction(
+	GetFunction = ast.NewPureFunction(
 		FunctionGet,
 		[]ast.Definition{
 			{
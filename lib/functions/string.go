@@ -8,28 +8,32 @@ import (
 
 	"github.com/dlclark/regexp2"
 	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
 	"github.com/yywing/sl/native"
 )
 
 func init() {
-	LibFunctions["contains"] = ast.NewBaseFunction("contains", native.MustNewNativeFunction("contains", Contains).Definitions())
-	LibFunctions["startsWith"] = ast.NewBaseFunction("startsWith", native.MustNewNativeFunction("startsWith", StartsWith).Definitions())
-	LibFunctions["endsWith"] = ast.NewBaseFunction("endsWith", native.MustNewNativeFunction("endsWith", EndsWith).Definitions())
-	LibFunctions["matches"] = ast.NewBaseFunction("matches", native.MustNewNativeFunction("matches", Matches).Definitions())
-	LibFunctions["charAt"] = ast.NewBaseFunction("charAt", native.MustNewNativeFunction("charAt", CharAt).Definitions())
-	LibFunctions["indexOf"] = ast.NewBaseFunction("indexOf", native.MustNewNativeFunction("indexOf", IndexOf).WithDefaultArg(int64(0)).Definitions())
-	LibFunctions["lastIndexOf"] = ast.NewBaseFunction("lastIndexOf", native.MustNewNativeFunction("lastIndexOf", LastIndexOf).WithDefaultArg(int64(-1)).Definitions())
-	LibFunctions["lowerAscii"] = ast.NewBaseFunction("lowerAscii", native.MustNewNativeFunction("lowerAscii", LowerASCII).Definitions())
-	LibFunctions["replace"] = ast.NewBaseFunction("replace", native.MustNewNativeFunction("replace", Replace).WithDefaultArg(int64(-1)).Definitions())
-	LibFunctions["split"] = ast.NewBaseFunction("split", native.MustNewNativeFunction("split", Split).WithDefaultArg(int64(-1)).Definitions())
-	LibFunctions["substring"] = ast.NewBaseFunction("substring", native.MustNewNativeFunction("substring", Substring).WithDefaultArg(int64(-1)).Definitions())
-	LibFunctions["trim"] = ast.NewBaseFunction("trim", native.MustNewNativeFunction("trim", Trim).Definitions())
-	LibFunctions["upperAscii"] = ast.NewBaseFunction("upperAscii", native.MustNewNativeFunction("upperAscii", UpperASCII).Definitions())
+	LibFunctions["contains"] = ast.NewPureFunction("contains", native.MustNewNativeFunction("contains", Contains).WithLinearCost(0.1).Definitions())
+	LibFunctions["startsWith"] = ast.NewPureFunction("startsWith", native.MustNewNativeFunction("startsWith", StartsWith).WithLinearCost(0.1).Definitions())
+	LibFunctions["endsWith"] = ast.NewPureFunction("endsWith", native.MustNewNativeFunction("endsWith", EndsWith).WithLinearCost(0.1).Definitions())
+	LibFunctions["matches"] = ast.NewPureFunction("matches", append(
+		native.MustNewNativeFunction("matches", Matches).WithLinearCost(1).Definitions(),
+		native.MustNewNativeFunction("matches", MatchesRegex).WithLinearCost(1).Definitions()...,
+	))
+	LibFunctions["charAt"] = ast.NewPureFunction("charAt", native.MustNewNativeFunction("charAt", CharAt).Definitions())
+	LibFunctions["indexOf"] = ast.NewPureFunction("indexOf", native.MustNewNativeFunction("indexOf", IndexOf).WithDefaultArg(int64(0)).WithLinearCost(0.1).Definitions())
+	LibFunctions["lastIndexOf"] = ast.NewPureFunction("lastIndexOf", native.MustNewNativeFunction("lastIndexOf", LastIndexOf).WithDefaultArg(int64(-1)).WithLinearCost(0.1).Definitions())
+	LibFunctions["lowerAscii"] = ast.NewPureFunction("lowerAscii", native.MustNewNativeFunction("lowerAscii", LowerASCII).WithLinearCost(0.1).Definitions())
+	LibFunctions["replace"] = ast.NewPureFunction("replace", native.MustNewNativeFunction("replace", Replace).WithDefaultArg(int64(-1)).WithLinearCost(0.1).Definitions())
+	LibFunctions["split"] = ast.NewPureFunction("split", native.MustNewNativeFunction("split", Split).WithDefaultArg(int64(-1)).WithLinearCost(0.1).Definitions())
+	LibFunctions["substring"] = ast.NewPureFunction("substring", native.MustNewNativeFunction("substring", Substring).WithDefaultArg(int64(-1)).WithLinearCost(0.1).Definitions())
+	LibFunctions["trim"] = ast.NewPureFunction("trim", native.MustNewNativeFunction("trim", Trim).WithLinearCost(0.1).Definitions())
+	LibFunctions["upperAscii"] = ast.NewPureFunction("upperAscii", native.MustNewNativeFunction("upperAscii", UpperASCII).WithLinearCost(0.1).Definitions())
 	// TODO
 	// LibFunctions["format"] = native.MustNewNativeFunction("format", Format)
-	LibFunctions["quote"] = ast.NewBaseFunction("quote", native.MustNewNativeFunction("quote", Quote).Definitions())
-	LibFunctions["join"] = ast.NewBaseFunction("join", native.MustNewNativeFunction("join", Join).WithDefaultArg("").Definitions())
-	LibFunctions["reverse"] = ast.NewBaseFunction("reverse", native.MustNewNativeFunction("reverse", Reverse).Definitions())
+	LibFunctions["quote"] = ast.NewPureFunction("quote", native.MustNewNativeFunction("quote", Quote).Definitions())
+	LibFunctions["join"] = ast.NewPureFunction("join", native.MustNewNativeFunction("join", Join).WithDefaultArg("").WithLinearCost(0.1).Definitions())
+	LibFunctions["reverse"] = ast.NewPureFunction("reverse", native.MustNewNativeFunction("reverse", Reverse).WithLinearCost(0.1).Definitions())
 }
 
 func Contains(s, substr string) bool {
@@ -58,6 +62,16 @@ func Matches(s, pattern string) (bool, error) {
 	return ret, nil
 }
 
+// MatchesRegex is matches with a regex compiled by the optimizer
+func MatchesRegex(s string, re *types.RegexValue) (bool, error) {
+	ret, err := re.Regexp.MatchString(s)
+	if err != nil {
+		return false, fmt.Errorf("regexp %v match %v failed: %v\n", re.Pattern, s, err)
+	}
+
+	return ret, nil
+}
+
 func CharAt(str string, ind int64) (string, error) {
 	i := int(ind)
 	runes := []rune(str)
@@ -23,12 +23,12 @@ func init() {
 	ast.StringFunction.Combine(StringFunction)
 
 	LibFunctions["now"] = ast.NewBaseFunction("now", native.MustNewNativeFunction("now", Now).Definitions())
-	LibFunctions["getFullYear"] = ast.NewBaseFunction("getFullYear", native.MustNewNativeFunction("getFullYear", GetFullYear).WithDefaultArg("").Definitions())
-	LibFunctions["getMonth"] = ast.NewBaseFunction("getMonth", native.MustNewNativeFunction("getMonth", GetMonth).WithDefaultArg("").Definitions())
-	LibFunctions["getDayOfYear"] = ast.NewBaseFunction("getDayOfYear", native.MustNewNativeFunction("getDayOfYear", GetDayOfYear).WithDefaultArg("").Definitions())
-	LibFunctions["getDate"] = ast.NewBaseFunction("getDate", native.MustNewNativeFunction("getDate", GetDayOfMonthOneBased).WithDefaultArg("").Definitions())
-	LibFunctions["getDayOfMonth"] = ast.NewBaseFunction("getDayOfMonth", native.MustNewNativeFunction("getDayOfMonth", GetDayOfMonthZeroBased).WithDefaultArg("").Definitions())
-	LibFunctions["getDayOfWeek"] = ast.NewBaseFunction("getDayOfWeek", native.MustNewNativeFunction("getDayOfWeek", GetDayOfWeek).WithDefaultArg("").Definitions())
+	LibFunctions["getFullYear"] = ast.NewPureFunction("getFullYear", native.MustNewNativeFunction("getFullYear", GetFullYear).WithDefaultArg("").Definitions())
+	LibFunctions["getMonth"] = ast.NewPureFunction("getMonth", native.MustNewNativeFunction("getMonth", GetMonth).WithDefaultArg("").Definitions())
+	LibFunctions["getDayOfYear"] = ast.NewPureFunction("getDayOfYear", native.MustNewNativeFunction("getDayOfYear", GetDayOfYear).WithDefaultArg("").Definitions())
+	LibFunctions["getDate"] = ast.NewPureFunction("getDate", native.MustNewNativeFunction("getDate", GetDayOfMonthOneBased).WithDefaultArg("").Definitions())
+	LibFunctions["getDayOfMonth"] = ast.NewPureFunction("getDayOfMonth", native.MustNewNativeFunction("getDayOfMonth", GetDayOfMonthZeroBased).WithDefaultArg("").Definitions())
+	LibFunctions["getDayOfWeek"] = ast.NewPureFunction("getDayOfWeek", native.MustNewNativeFunction("getDayOfWeek", GetDayOfWeek).WithDefaultArg("").Definitions())
 	LibFunctions["getHours"] = GetHoursFunction
 	LibFunctions["getMinutes"] = GetMinutesFunction
 	LibFunctions["getSeconds"] = GetSecondsFunction
@@ -48,7 +48,7 @@ const (
 )
 
 var (
-	AddFunction = ast.NewBaseFunction(
+	AddFunction = ast.NewPureFunction(
 		ast.Add,
 		[]ast.Definition{
 			{
@@ -94,7 +94,7 @@ var (
 			},
 		},
 	)
-	SubtractFunction = ast.NewBaseFunction(
+	SubtractFunction = ast.NewPureFunction(
 		ast.Subtract,
 		[]ast.Definition{
 			{
@@ -144,7 +144,7 @@ var (
 			},
 		},
 	)
-	LessFunction = ast.NewBaseFunction(
+	LessFunction = ast.NewPureFunction(
 		ast.Less,
 		[]ast.Definition{
 			{
@@ -169,7 +169,7 @@ var (
 			},
 		},
 	)
-	LessEqualsFunction = ast.NewBaseFunction(
+	LessEqualsFunction = ast.NewPureFunction(
 		ast.LessEquals,
 		[]ast.Definition{
 			{
@@ -194,7 +194,7 @@ var (
 			},
 		},
 	)
-	GreaterFunction = ast.NewBaseFunction(
+	GreaterFunction = ast.NewPureFunction(
 		ast.Greater,
 		[]ast.Definition{
 			{
@@ -219,7 +219,7 @@ var (
 			},
 		},
 	)
-	GreaterEqualsFunction = ast.NewBaseFunction(
+	GreaterEqualsFunction = ast.NewPureFunction(
 		ast.GreaterEquals,
 		[]ast.Definition{
 			{
@@ -245,7 +245,7 @@ var (
 		},
 	)
 
-	DurationFunction = ast.NewBaseFunction(
+	DurationFunction = ast.NewPureFunction(
 		FunctionDuration,
 		[]ast.Definition{
 			{
@@ -273,7 +273,7 @@ var (
 		},
 	)
 
-	TimestampFunction = ast.NewBaseFunction(
+	TimestampFunction = ast.NewPureFunction(
 		FunctionTimestamp,
 		[]ast.Definition{
 			{
@@ -311,7 +311,7 @@ var (
 		},
 	)
 
-	IntFunction = ast.NewBaseFunction(
+	IntFunction = ast.NewPureFunction(
 		ast.Int,
 		[]ast.Definition{
 			{
@@ -333,7 +333,7 @@ var (
 		},
 	)
 
-	StringFunction = ast.NewBaseFunction(
+	StringFunction = ast.NewPureFunction(
 		ast.String,
 		[]ast.Definition{
 			{
@@ -355,7 +355,7 @@ var (
 		},
 	)
 
-	GetHoursFunction = ast.NewBaseFunction(
+	GetHoursFunction = ast.NewPureFunction(
 		FunctionGetHours,
 		[]ast.Definition{
 			{
@@ -387,7 +387,7 @@ var (
 		},
 	)
 
-	GetMinutesFunction = ast.NewBaseFunction(
+	GetMinutesFunction = ast.NewPureFunction(
 		FunctionGetMinutes,
 		[]ast.Definition{
 			{
@@ -419,7 +419,7 @@ var (
 		},
 	)
 
-	GetSecondsFunction = ast.NewBaseFunction(
+	GetSecondsFunction = ast.NewPureFunction(
 		FunctionGetSeconds,
 		[]ast.Definition{
 			{
@@ -451,7 +451,7 @@ var (
 		},
 	)
 
-	GetMillisecondsFunction = ast.NewBaseFunction(
+	GetMillisecondsFunction = ast.NewPureFunction(
 		FunctionGetMilliseconds,
 		[]ast.Definition{
 			{
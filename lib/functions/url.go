@@ -4,23 +4,76 @@ import (
 	"net/url"
 
 	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
 	"github.com/yywing/sl/native"
 )
 
 func init() {
-	LibFunctions[FunctionURLDecode] = ast.NewBaseFunction(
+	LibFunctions[FunctionURLDecode] = ast.NewPureFunction(
 		FunctionURLDecode,
-		native.MustNewNativeFunction(FunctionURLDecode, URLDecode).Definitions(),
+		native.MustNewNativeFunction(FunctionURLDecode, URLDecode).WithLinearCost(0.1).Definitions(),
 	)
-	LibFunctions[FunctionURLEncode] = ast.NewBaseFunction(
+	LibFunctions[FunctionURLEncode] = ast.NewPureFunction(
 		FunctionURLEncode,
-		native.MustNewNativeFunction(FunctionURLEncode, URLEncode).Definitions(),
+		native.MustNewNativeFunction(FunctionURLEncode, URLEncode).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionQueryParams] = ast.NewPureFunction(
+		FunctionQueryParams,
+		native.MustNewNativeFunction(FunctionQueryParams, QueryParams).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionParseForm] = ast.NewPureFunction(
+		FunctionParseForm,
+		native.MustNewNativeFunction(FunctionParseForm, ParseForm).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionURL] = ast.NewPureFunction(
+		FunctionURL,
+		native.MustNewNativeFunction(FunctionURL, types.ParseURL).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionResolveURL] = ast.NewPureFunction(
+		FunctionResolveURL,
+		append(
+			native.MustNewNativeFunction(FunctionResolveURL, ResolveURL).WithLinearCost(0.1).Definitions(),
+			native.MustNewNativeFunction(FunctionResolveURL, ResolveURLString).WithLinearCost(0.1).Definitions()...,
+		),
+	)
+	LibFunctions[FunctionWithPath] = ast.NewPureFunction(
+		FunctionWithPath,
+		native.MustNewNativeFunction(FunctionWithPath, WithPath).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionWithQuery] = ast.NewPureFunction(
+		FunctionWithQuery,
+		append(
+			native.MustNewNativeFunction(FunctionWithQuery, WithQuery).WithLinearCost(0.1).Definitions(),
+			native.MustNewNativeFunction(FunctionWithQuery, WithQueryValues).WithLinearCost(0.1).Definitions()...,
+		),
+	)
+	LibFunctions[FunctionNormalizeURL] = ast.NewPureFunction(
+		FunctionNormalizeURL,
+		native.MustNewNativeFunction(FunctionNormalizeURL, NormalizeURL).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionPathEscape] = ast.NewPureFunction(
+		FunctionPathEscape,
+		native.MustNewNativeFunction(FunctionPathEscape, url.PathEscape).WithLinearCost(0.1).Definitions(),
+	)
+	LibFunctions[FunctionPathUnescape] = ast.NewPureFunction(
+		FunctionPathUnescape,
+		native.MustNewNativeFunction(FunctionPathUnescape, url.PathUnescape).WithLinearCost(0.1).Definitions(),
 	)
 }
 
 const (
-	FunctionURLDecode = "urlDecode"
-	FunctionURLEncode = "urlEncode"
+	FunctionURLDecode   = "urlDecode"
+	FunctionURLEncode   = "urlEncode"
+	FunctionQueryParams = "queryParams"
+	FunctionParseForm   = "parseForm"
+
+	FunctionURL          = "url"
+	FunctionResolveURL   = "resolveURL"
+	FunctionWithPath     = "withPath"
+	FunctionWithQuery    = "withQuery"
+	FunctionNormalizeURL = "normalizeURL"
+	FunctionPathEscape   = "pathEscape"
+	FunctionPathUnescape = "pathUnescape"
 )
 
 func URLDecode(d string) (string, error) {
@@ -30,3 +83,75 @@ func URLDecode(d string) (string, error) {
 func URLEncode(d string) string {
 	return url.QueryEscape(d)
 }
+
+// QueryParams returns the values of each query parameter in order. Malformed
+// pairs are skipped, probes often send them on purpose.
+func QueryParams(u *types.URL) map[string][]string {
+	values, _ := url.ParseQuery(u.Query)
+	return values
+}
+
+// ParseForm parses an application/x-www-form-urlencoded body like QueryParams
+func ParseForm(body []byte) map[string][]string {
+	values, _ := url.ParseQuery(string(body))
+	return values
+}
+
+// ResolveURL resolves ref, e.g. a Location header or a link, against base
+func ResolveURL(base *types.URL, ref string) (*types.URL, error) {
+	return ResolveURLString(base.URL, ref)
+}
+
+func ResolveURLString(base, ref string) (*types.URL, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	return types.ParseURL(b.ResolveReference(r).String())
+}
+
+// WithPath replaces the path of u, path is escaped already and sent as is,
+// e.g. "/a%2Fb" or "/../etc/passwd"
+func WithPath(u *types.URL, path string) (*types.URL, error) {
+	p, err := url.Parse(u.URL)
+	if err != nil {
+		return nil, err
+	}
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return nil, err
+	}
+	p.Path = unescaped
+	p.RawPath = path
+	return types.ParseURL(p.String())
+}
+
+// WithQuery replaces the query of u, the parameters are sorted by name
+func WithQuery(u *types.URL, query map[string]string) (*types.URL, error) {
+	values := make(map[string][]string, len(query))
+	for k, v := range query {
+		values[k] = []string{v}
+	}
+	return WithQueryValues(u, values)
+}
+
+// WithQueryValues replaces the query of u with the values of each parameter,
+// e.g. the result of queryParams()
+func WithQueryValues(u *types.URL, query map[string][]string) (*types.URL, error) {
+	p, err := url.Parse(u.URL)
+	if err != nil {
+		return nil, err
+	}
+	p.RawQuery = url.Values(query).Encode()
+	return types.ParseURL(p.String())
+}
+
+// NormalizeURL lowercases the scheme and the host of u and strips the default
+// port of the scheme
+func NormalizeURL(u *types.URL) (*types.URL, error) {
+	return u.Normalize()
+}
@@ -10,21 +10,21 @@ import (
 )
 
 func init() {
-	LibFunctions[FunctionXMLPath] = ast.NewBaseFunction(
+	LibFunctions[FunctionXMLPath] = ast.NewPureFunction(
 		FunctionXMLPath,
-		native.MustNewNativeFunction(FunctionXMLPath, XMLPath).Definitions(),
+		native.MustNewNativeFunction(FunctionXMLPath, XMLPath).WithLinearCost(1).Definitions(),
 	)
-	LibFunctions[FunctionXMLAttr] = ast.NewBaseFunction(
+	LibFunctions[FunctionXMLAttr] = ast.NewPureFunction(
 		FunctionXMLAttr,
-		native.MustNewNativeFunction(FunctionXMLAttr, XMLAttr).Definitions(),
+		native.MustNewNativeFunction(FunctionXMLAttr, XMLAttr).WithLinearCost(1).Definitions(),
 	)
-	LibFunctions[FunctionXMLElement] = ast.NewBaseFunction(
+	LibFunctions[FunctionXMLElement] = ast.NewPureFunction(
 		FunctionXMLElement,
-		native.MustNewNativeFunction(FunctionXMLElement, XMLElement).Definitions(),
+		native.MustNewNativeFunction(FunctionXMLElement, XMLElement).WithLinearCost(1).Definitions(),
 	)
-	LibFunctions[FunctionXMLText] = ast.NewBaseFunction(
+	LibFunctions[FunctionXMLText] = ast.NewPureFunction(
 		FunctionXMLText,
-		native.MustNewNativeFunction(FunctionXMLText, XMLText).Definitions(),
+		native.MustNewNativeFunction(FunctionXMLText, XMLText).WithLinearCost(1).Definitions(),
 	)
 }
 
@@ -0,0 +1,119 @@
+package types
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/native"
+)
+
+const (
+	TypeKindCookie = "cookie"
+)
+
+var (
+	CookieType = native.NewNativeSelectorType[*CookieValue](TypeKindCookie)
+)
+
+// CookieValue is a cookie sent in a Cookie header, which only has a name and a
+// value, or set by a Set-Cookie header
+type CookieValue struct {
+	Name     string `sl:"name"`
+	Value    string `sl:"value"`
+	Domain   string `sl:"domain"`
+	Path     string `sl:"path"`
+	Secure   bool   `sl:"secure"`
+	HttpOnly bool   `sl:"httponly"`
+	// Strict, Lax, None or empty when not set
+	SameSite string `sl:"samesite"`
+	// nil when the cookie has no Expires attribute
+	Expires *TimestampValue `sl:"expires"`
+
+	Raw string
+}
+
+func NewCookieValue(c *http.Cookie) *CookieValue {
+	v := &CookieValue{
+		Name:  c.Name,
+		Value: c.Value,
+		// a leading dot is ignored, RFC 6265 section 5.2.3
+		Domain:   strings.TrimPrefix(c.Domain, "."),
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		Raw:      c.Raw,
+	}
+	switch c.SameSite {
+	case http.SameSiteStrictMode:
+		v.SameSite = "Strict"
+	case http.SameSiteLaxMode:
+		v.SameSite = "Lax"
+	case http.SameSiteNoneMode:
+		v.SameSite = "None"
+	}
+	if !c.Expires.IsZero() {
+		t := c.Expires.In(time.UTC)
+		v.Expires = NewTimestampValue(t.Unix(), int64(t.Nanosecond()), t.Location().String())
+	}
+	if v.Raw == "" {
+		v.Raw = c.String()
+	}
+	return v
+}
+
+// ParseCookies returns the cookies of Cookie header values
+func ParseCookies(headers []string) []*CookieValue {
+	req := &http.Request{Header: http.Header{"Cookie": headers}}
+	return newCookieValues(req.Cookies())
+}
+
+// ParseSetCookies returns the cookies of Set-Cookie header values, invalid
+// cookies are skipped
+func ParseSetCookies(headers []string) []*CookieValue {
+	resp := &http.Response{Header: http.Header{"Set-Cookie": headers}}
+	return newCookieValues(resp.Cookies())
+}
+
+func newCookieValues(cookies []*http.Cookie) []*CookieValue {
+	values := make([]*CookieValue, len(cookies))
+	for i, c := range cookies {
+		values[i] = NewCookieValue(c)
+	}
+	return values
+}
+
+func (v *CookieValue) Type() ast.ValueType {
+	return CookieType
+}
+
+func (v *CookieValue) String() string {
+	return v.Raw
+}
+
+func (v *CookieValue) Equal(other ast.Value) bool {
+	otherValue, ok := other.(*CookieValue)
+	if !ok {
+		return false
+	}
+	return v.Raw == otherValue.Raw
+}
+
+func (v *CookieValue) Get(key ast.Value) (ast.Value, bool) {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return CookieType.Get(v, key.(*ast.StringValue).StringValue)
+	default:
+		return nil, false
+	}
+}
+
+func (v *CookieValue) Has(key ast.Value) bool {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return CookieType.Has(v, key.(*ast.StringValue).StringValue)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,207 @@
+package types
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HAREntry is a request and its response loaded from a HAR file
+type HAREntry struct {
+	Request  *HTTPRequestValue
+	Response *HTTPResponseValue
+}
+
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	// total time of the request in milliseconds
+	Time     float64     `json:"time"`
+	Request  harRequest  `json:"request"`
+	Response harResponse `json:"response"`
+}
+
+type harRequest struct {
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	HTTPVersion string    `json:"httpVersion"`
+	Headers     []harPair `json:"headers"`
+	PostData    *struct {
+		MimeType string    `json:"mimeType"`
+		Text     string    `json:"text"`
+		Params   []harPair `json:"params"`
+	} `json:"postData"`
+}
+
+type harResponse struct {
+	Status      int       `json:"status"`
+	StatusText  string    `json:"statusText"`
+	HTTPVersion string    `json:"httpVersion"`
+	Headers     []harPair `json:"headers"`
+	Content     struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Encoding string `json:"encoding"`
+	} `json:"content"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// LoadHARFile loads the entries of a HAR file, see LoadHAR
+func LoadHARFile(path string) ([]HAREntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadHAR(f)
+}
+
+// LoadHAR loads the entries of a HAR log. The headers, raw request and raw
+// response keep the order, casing and repetitions of the recorded headers.
+func LoadHAR(r io.Reader) ([]HAREntry, error) {
+	var file harFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	entries := make([]HAREntry, len(file.Log.Entries))
+	for i, e := range file.Log.Entries {
+		req, err := harRequestValue(e.Request)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		resp, err := harResponseValue(e.Response, time.Duration(e.Time*float64(time.Millisecond)))
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		entries[i] = HAREntry{Request: req, Response: resp}
+	}
+	return entries, nil
+}
+
+func harRequestValue(r harRequest) (*HTTPRequestValue, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if r.PostData != nil {
+		if r.PostData.Text != "" || len(r.PostData.Params) == 0 {
+			body = []byte(r.PostData.Text)
+		} else {
+			// forms may only be recorded as parameters
+			form := url.Values{}
+			for _, p := range r.PostData.Params {
+				form.Add(p.Name, p.Value)
+			}
+			body = []byte(form.Encode())
+		}
+	}
+
+	headers, contentType := harHeaders(r.Headers)
+	if contentType == "" && r.PostData != nil {
+		contentType = r.PostData.MimeType
+	}
+	requestLine := fmt.Sprintf("%s %s %s", r.Method, u.RequestURI(), httpVersion(r.HTTPVersion))
+	rawHeader := harRawHeader(requestLine, r.Headers)
+
+	return &HTTPRequestValue{
+		URL:         NewURL(r.URL),
+		Raw:         append(append([]byte{}, rawHeader...), body...),
+		Method:      r.Method,
+		Headers:     headers,
+		Body:        body,
+		ContentType: contentType,
+		RawHeader:   rawHeader,
+	}, nil
+}
+
+func harResponseValue(r harResponse, latency time.Duration) (*HTTPResponseValue, error) {
+	body := []byte(r.Content.Text)
+	if r.Content.Encoding == "base64" {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(r.Content.Text)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headers, contentType := harHeaders(r.Headers)
+	if contentType == "" {
+		contentType = r.Content.MimeType
+	}
+	statusText := r.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(r.Status)
+	}
+	statusLine := strings.TrimSpace(fmt.Sprintf("%s %s %s", httpVersion(r.HTTPVersion), strconv.Itoa(r.Status), statusText))
+	rawHeader := harRawHeader(statusLine, r.Headers)
+
+	return &HTTPResponseValue{
+		Status:      int64(r.Status),
+		Headers:     headers,
+		Body:        body,
+		ContentType: contentType,
+		Raw:         append(append([]byte{}, rawHeader...), body...),
+		RawHeader:   rawHeader,
+		Latency:     NewDurationValue(latency.Nanoseconds()),
+	}, nil
+}
+
+// harHeaders returns the recorded headers, HTTP/2 pseudo headers such as
+// :authority are left out
+func harHeaders(pairs []harPair) (*HeadersValue, string) {
+	var headers []Header
+	for _, p := range pairs {
+		if strings.HasPrefix(p.Name, ":") {
+			continue
+		}
+		headers = append(headers, Header{Name: p.Name, Value: p.Value})
+	}
+	v := NewHeadersValue(headers)
+	return v, strings.Join(v.Values("Content-Type"), ",")
+}
+
+func harRawHeader(firstLine string, pairs []harPair) []byte {
+	var b bytes.Buffer
+	b.WriteString(firstLine + "\r\n")
+	for _, p := range pairs {
+		if strings.HasPrefix(p.Name, ":") {
+			continue
+		}
+		b.WriteString(p.Name + ": " + p.Value + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// httpVersion returns the protocol of the request or status line, browsers
+// record HTTP/2 as h2
+func httpVersion(v string) string {
+	switch strings.ToLower(v) {
+	case "":
+		return "HTTP/1.1"
+	case "h2", "http/2", "http/2.0":
+		return "HTTP/2.0"
+	case "h3", "http/3", "http/3.0":
+		return "HTTP/3.0"
+	}
+	return v
+}
@@ -0,0 +1,283 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/yywing/sl/ast"
+)
+
+const (
+	TypeKindHeaders = "headers"
+)
+
+var (
+	HeadersType = &HeadersValueType{PrimitiveType: ast.NewPrimitiveType(TypeKindHeaders, ast.SelectorType)}
+)
+
+// HeadersValueType is indexed by header name like a map<string, string>, and
+// is accepted where such a map is expected
+type HeadersValueType struct {
+	*ast.PrimitiveType
+}
+
+func (t *HeadersValueType) Equals(other ast.ValueType) bool {
+	if m, ok := other.(*ast.MapType); ok {
+		return m.Equals(t)
+	}
+	return t.PrimitiveType.Equals(other)
+}
+
+func (t *HeadersValueType) KeyType() ast.ValueType {
+	return ast.StringType
+}
+
+func (t *HeadersValueType) ValueType() ast.ValueType {
+	return ast.StringType
+}
+
+func (t *HeadersValueType) Member(name string) ast.ValueType {
+	return ast.StringType
+}
+
+// Header is a header line as it was sent
+type Header struct {
+	Name  string
+	Value string
+}
+
+// HeadersValue keeps the header lines of a request or response in order, with
+// the casing of their names and repeated headers. Lookups ignore the case of
+// the name and join the values of a repeated header with ",".
+type HeadersValue struct {
+	Headers []Header
+}
+
+func NewHeadersValue(headers []Header) *HeadersValue {
+	return &HeadersValue{Headers: headers}
+}
+
+// NewHeadersValueFromMap returns the headers of m sorted by name, e.g. for
+// headers that were set as a map[string]string
+func NewHeadersValueFromMap(m map[string]string) *HeadersValue {
+	h := make(http.Header, len(m))
+	for name, value := range m {
+		h[name] = []string{value}
+	}
+	return NewHeadersValueFromHTTP(h)
+}
+
+// NewHeadersValueFromHTTP returns the headers of h sorted by name, the order of
+// the lines is not known
+func NewHeadersValueFromHTTP(h http.Header) *HeadersValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var headers []Header
+	for _, name := range names {
+		for _, value := range h[name] {
+			headers = append(headers, Header{Name: name, Value: value})
+		}
+	}
+	return NewHeadersValue(headers)
+}
+
+// ParseHeaders reads the header lines of a raw request or response, the first
+// line is skipped. It stops at the first empty line.
+func ParseHeaders(rawHeader []byte) *HeadersValue {
+	lines := bytes.Split(rawHeader, []byte("\n"))
+	var headers []Header
+	for _, line := range lines[1:] {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			break
+		}
+		// obsolete line folding continues the previous value
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			last := &headers[len(headers)-1]
+			last.Value += " " + string(bytes.TrimSpace(line))
+			continue
+		}
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+		headers = append(headers, Header{
+			Name:  string(name),
+			Value: string(bytes.TrimSpace(value)),
+		})
+	}
+	return NewHeadersValue(headers)
+}
+
+// lines returns the header lines, a nil *HeadersValue has none, e.g. in a
+// request built by HTTPRequest{}
+func (v *HeadersValue) lines() []Header {
+	if v == nil {
+		return nil
+	}
+	return v.Headers
+}
+
+func (v *HeadersValue) Type() ast.ValueType {
+	return HeadersType
+}
+
+func (v *HeadersValue) String() string {
+	var b strings.Builder
+	for _, h := range v.lines() {
+		b.WriteString(h.Name + ": " + h.Value + "\r\n")
+	}
+	return b.String()
+}
+
+// Equal compares the header lines in order, or with a map<string, string> the
+// value of each header ignoring the case of names
+func (v *HeadersValue) Equal(other ast.Value) bool {
+	if m, ok := other.(*ast.MapValue); ok {
+		return v.equalMap(m)
+	}
+	otherValue, ok := other.(*HeadersValue)
+	if !ok || len(v.lines()) != len(otherValue.lines()) {
+		return false
+	}
+	for i, h := range v.lines() {
+		if h != otherValue.lines()[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *HeadersValue) equalMap(m *ast.MapValue) bool {
+	if len(v.Keys()) != len(m.MapValue) {
+		return false
+	}
+	for key, value := range m.MapValue {
+		got, ok := v.Get(key)
+		if !ok || !got.Equal(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ToMap returns the headers as a map<string, string>, see Map
+func (v *HeadersValue) ToMap() *ast.MapValue {
+	m := make(map[ast.Value]ast.Value)
+	for name, value := range v.Map() {
+		m[ast.NewStringValue(name)] = ast.NewStringValue(value)
+	}
+	return ast.NewMapValue(m, ast.StringType, ast.StringType)
+}
+
+// ConvertsFrom reports whether the headers can be set from a value of type t, a
+// map<string, string> or a map<string, list<string>> for repeated headers, see
+// native.Convertible
+func (v *HeadersValue) ConvertsFrom(t ast.ValueType) bool {
+	m, ok := t.(*ast.MapType)
+	if !ok || !m.KeyType().Equals(ast.StringType) {
+		return false
+	}
+	return m.ValueType().Equals(ast.StringType) || m.ValueType().Equals(ast.NewListType(ast.StringType))
+}
+
+// SetFrom sets the headers to the entries of a map sorted by name, a list value
+// gives a line for each element
+func (v *HeadersValue) SetFrom(value ast.Value) error {
+	m, ok := value.(*ast.MapValue)
+	if !ok {
+		return fmt.Errorf("headers cannot be set from %s", value.Type().String())
+	}
+	h := make(http.Header, len(m.MapValue))
+	for key, value := range m.MapValue {
+		name, ok := key.(*ast.StringValue)
+		if !ok {
+			return fmt.Errorf("header name must be a string, got %s", key.Type().String())
+		}
+		switch value := value.(type) {
+		case *ast.StringValue:
+			h[name.StringValue] = append(h[name.StringValue], value.StringValue)
+		case *ast.ListValue:
+			for _, elem := range value.ListValue {
+				s, ok := elem.(*ast.StringValue)
+				if !ok {
+					return fmt.Errorf("header %s must be strings, got %s", name.StringValue, elem.Type().String())
+				}
+				h[name.StringValue] = append(h[name.StringValue], s.StringValue)
+			}
+		default:
+			return fmt.Errorf("header %s must be a string, got %s", name.StringValue, value.Type().String())
+		}
+	}
+	v.Headers = NewHeadersValueFromHTTP(h).Headers
+	return nil
+}
+
+// Values returns the values of the headers named name in order
+func (v *HeadersValue) Values(name string) []string {
+	var values []string
+	for _, h := range v.lines() {
+		if strings.EqualFold(h.Name, name) {
+			values = append(values, h.Value)
+		}
+	}
+	return values
+}
+
+// Names returns the names of the header lines as they were sent
+func (v *HeadersValue) Names() []string {
+	names := make([]string, len(v.lines()))
+	for i, h := range v.lines() {
+		names[i] = h.Name
+	}
+	return names
+}
+
+// Map returns the values of each header joined with ",", by canonical name
+func (v *HeadersValue) Map() map[string]string {
+	m := make(map[string]string)
+	for _, h := range v.lines() {
+		name := textproto.CanonicalMIMEHeaderKey(h.Name)
+		if value, ok := m[name]; ok {
+			m[name] = value + "," + h.Value
+		} else {
+			m[name] = h.Value
+		}
+	}
+	return m
+}
+
+func (v *HeadersValue) Get(key ast.Value) (ast.Value, bool) {
+	name, ok := key.(*ast.StringValue)
+	if !ok {
+		return nil, false
+	}
+	values := v.Values(name.StringValue)
+	if values == nil {
+		return nil, false
+	}
+	return ast.NewStringValue(strings.Join(values, ",")), true
+}
+
+// Keys returns the canonical name of each header, in the order they first
+// appear
+func (v *HeadersValue) Keys() []ast.Value {
+	var keys []ast.Value
+	seen := make(map[string]bool)
+	for _, h := range v.lines() {
+		name := textproto.CanonicalMIMEHeaderKey(h.Name)
+		if !seen[name] {
+			seen[name] = true
+			keys = append(keys, ast.NewStringValue(name))
+		}
+	}
+	return keys
+}
@@ -1,12 +1,15 @@
 package types
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/yywing/sl/ast"
 	"github.com/yywing/sl/native"
@@ -14,13 +17,15 @@ import (
 )
 
 const (
-	TypeKindURL         = "url"
-	TypeKindHTTPRequest = "http_request"
+	TypeKindURL          = "url"
+	TypeKindHTTPRequest  = "http_request"
+	TypeKindHTTPResponse = "http_response"
 )
 
 var (
-	URLType         = native.NewNativeSelectorType[*URL](TypeKindURL)
-	HTTPRequestType = native.NewNativeSelectorType[*HTTPRequestValue](TypeKindHTTPRequest)
+	URLType          = native.NewNativeSelectorType[*URL](TypeKindURL)
+	HTTPRequestType  = native.NewNativeSelectorType[*HTTPRequestValue](TypeKindHTTPRequest)
+	HTTPResponseType = native.NewNativeSelectorType[*HTTPResponseValue](TypeKindHTTPResponse)
 )
 
 type URL struct {
@@ -31,15 +36,32 @@ type URL struct {
 	Path     string `sl:"path"`
 	Query    string `sl:"query"`
 	Fragment string `sl:"fragment"`
+	User     string `sl:"user"`
+	Password string `sl:"password"`
+	// the path as sent, with its escapes
+	RawPath string `sl:"raw_path"`
+	// the query as sent, same as query
+	RawQuery string `sl:"raw_query"`
 
 	URL string
 }
 
 func NewURL(u string) *URL {
-	parsedURL, err := url.Parse(u)
+	v, err := ParseURL(u)
 	if err != nil {
 		return nil
 	}
+	return v
+}
+
+// ParseURL is NewURL returning the parse error
+func ParseURL(u string) (*URL, error) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	password, _ := parsedURL.User.Password()
 
 	// 处理一下默认端口
 	port := parsedURL.Port()
@@ -56,8 +78,38 @@ func NewURL(u string) *URL {
 		Path:     parsedURL.Path,
 		Query:    parsedURL.RawQuery,
 		Fragment: parsedURL.Fragment,
+		User:     parsedURL.User.Username(),
+		Password: password,
+		RawPath:  parsedURL.EscapedPath(),
+		RawQuery: parsedURL.RawQuery,
 		URL:      u,
+	}, nil
+}
+
+// Normalize returns the URL with its scheme and host lowercased and without
+// the default port of the scheme
+func (v *URL) Normalize() (*URL, error) {
+	p, err := url.Parse(v.URL)
+	if err != nil {
+		return nil, err
 	}
+	return ParseURL(normalizeURL(p))
+}
+
+func normalizeURL(p *url.URL) string {
+	p.Scheme = strings.ToLower(p.Scheme)
+	host, port := strings.ToLower(p.Hostname()), p.Port()
+	if defaultPort := util.HttpSchemeToPort(p.Scheme); defaultPort != 0 && port == strconv.Itoa(defaultPort) {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	p.Host = host
+	if port != "" {
+		p.Host += ":" + port
+	}
+	return p.String()
 }
 
 func (v *URL) Type() ast.ValueType {
@@ -68,8 +120,22 @@ func (v *URL) String() string {
 	return v.URL
 }
 
+// Equal compares the normalized URLs, e.g. HTTP://Example.com:80/ equals
+// http://example.com/
 func (v *URL) Equal(other ast.Value) bool {
-	return false
+	otherValue, ok := other.(*URL)
+	if !ok || v == nil || otherValue == nil {
+		return ok && v == otherValue
+	}
+	return v.normalized() == otherValue.normalized()
+}
+
+func (v *URL) normalized() string {
+	p, err := url.Parse(v.URL)
+	if err != nil {
+		return v.URL
+	}
+	return normalizeURL(p)
 }
 
 func (v *URL) Get(key ast.Value) (ast.Value, bool) {
@@ -81,26 +147,29 @@ func (v *URL) Get(key ast.Value) (ast.Value, bool) {
 	}
 }
 
+func (v *URL) Has(key ast.Value) bool {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return URLType.Has(v, key.(*ast.StringValue).StringValue)
+	default:
+		return false
+	}
+}
+
 type HTTPRequestValue struct {
-	URL     *URL              `sl:"url"`
-	Raw     []byte            `sl:"raw"`
-	Method  string            `sl:"method"`
-	Headers map[string]string `sl:"headers"`
-	Body    []byte            `sl:"body"`
+	URL     *URL          `sl:"url"`
+	Raw     []byte        `sl:"raw"`
+	Method  string        `sl:"method"`
+	Headers *HeadersValue `sl:"headers"`
+	Body    []byte        `sl:"body"`
 
 	ContentType string `sl:"content_type"`
 	RawHeader   []byte `sl:"raw_header"`
 }
 
 func NewHTTPRequestValueFromRequest(req *http.Request) (*HTTPRequestValue, error) {
-	headers := make(map[string]string)
-	var contentType string
-	for k, v := range req.Header {
-		if k == "Content-Type" {
-			contentType = strings.Join(v, ",")
-		}
-		headers[k] = strings.Join(v, ",")
-	}
+	headers := NewHeadersValueFromHTTP(req.Header)
+	contentType := strings.Join(req.Header.Values("Content-Type"), ",")
 
 	var body []byte
 	if req.Body != nil {
@@ -132,16 +201,55 @@ func NewHTTPRequestValueFromRequest(req *http.Request) (*HTTPRequestValue, error
 	}, nil
 }
 
+// NewHTTPRequestValueFromRaw parses a raw HTTP/1.x request, e.g. captured
+// traffic, the URL is made of scheme and the Host header. Without a
+// Content-Length header, the rest of raw is the body.
+func NewHTTPRequestValueFromRaw(raw []byte, scheme string) (*HTTPRequestValue, error) {
+	r := bufio.NewReader(bytes.NewReader(raw))
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Scheme = scheme
+	req.URL.Host = req.Host
+	if req.ContentLength == 0 && len(req.TransferEncoding) == 0 && req.Header.Get("Content-Length") == "" {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > 0 {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+	}
+	v, err := NewHTTPRequestValueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	// keep the order and casing of the header lines
+	v.Headers = ParseHeaders(raw)
+	return v, nil
+}
+
 func (v *HTTPRequestValue) Type() ast.ValueType {
 	return HTTPRequestType
 }
 
 func (v *HTTPRequestValue) String() string {
+	if v.URL == nil {
+		return v.Method
+	}
 	return v.URL.URL
 }
 
+// Equal compares the method, URL, headers and body of the requests
 func (v *HTTPRequestValue) Equal(other ast.Value) bool {
-	return false
+	otherValue, ok := other.(*HTTPRequestValue)
+	if !ok {
+		return false
+	}
+	return v.Method == otherValue.Method && v.URL.Equal(otherValue.URL) &&
+		v.Headers.Equal(otherValue.Headers) && bytes.Equal(v.Body, otherValue.Body)
 }
 
 func (v *HTTPRequestValue) Get(key ast.Value) (ast.Value, bool) {
@@ -152,3 +260,111 @@ func (v *HTTPRequestValue) Get(key ast.Value) (ast.Value, bool) {
 		return nil, false
 	}
 }
+
+func (v *HTTPRequestValue) Has(key ast.Value) bool {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return HTTPRequestType.Has(v, key.(*ast.StringValue).StringValue)
+	default:
+		return false
+	}
+}
+
+type HTTPResponseValue struct {
+	Status      int64          `sl:"status"`
+	Headers     *HeadersValue  `sl:"headers"`
+	Body        []byte         `sl:"body"`
+	ContentType string         `sl:"content_type"`
+	Raw         []byte         `sl:"raw"`
+	RawHeader   []byte         `sl:"raw_header"`
+	Latency     *DurationValue `sl:"latency"`
+}
+
+// NewHTTPResponseValueFromResponse reads the whole response body, latency is the
+// time between sending the request and receiving the response.
+func NewHTTPResponseValueFromResponse(resp *http.Response, latency time.Duration) (*HTTPResponseValue, error) {
+	headers := NewHeadersValueFromHTTP(resp.Header)
+	contentType := strings.Join(resp.Header.Values("Content-Type"), ",")
+
+	// DumpResponse restores resp.Body after reading it
+	raw, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, err
+	}
+
+	rawHeader, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if resp.Body != nil {
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &HTTPResponseValue{
+		Status:      int64(resp.StatusCode),
+		Headers:     headers,
+		Body:        body,
+		ContentType: contentType,
+		Raw:         raw,
+		RawHeader:   rawHeader,
+		Latency:     NewDurationValue(latency.Nanoseconds()),
+	}, nil
+}
+
+// NewHTTPResponseValueFromRaw parses a raw HTTP/1.x response, e.g. captured
+// traffic, its latency is zero
+func NewHTTPResponseValueFromRaw(raw []byte) (*HTTPResponseValue, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	v, err := NewHTTPResponseValueFromResponse(resp, 0)
+	if err != nil {
+		return nil, err
+	}
+	v.Headers = ParseHeaders(raw)
+	return v, nil
+}
+
+func (v *HTTPResponseValue) Type() ast.ValueType {
+	return HTTPResponseType
+}
+
+func (v *HTTPResponseValue) String() string {
+	return strconv.FormatInt(v.Status, 10)
+}
+
+// Equal compares the status, headers and body, the raw message and the latency
+// of a recorded response are not compared
+func (v *HTTPResponseValue) Equal(other ast.Value) bool {
+	otherValue, ok := other.(*HTTPResponseValue)
+	if !ok {
+		return false
+	}
+	return v.Status == otherValue.Status && v.Headers.Equal(otherValue.Headers) &&
+		bytes.Equal(v.Body, otherValue.Body)
+}
+
+func (v *HTTPResponseValue) Get(key ast.Value) (ast.Value, bool) {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return HTTPResponseType.Get(v, key.(*ast.StringValue).StringValue)
+	default:
+		return nil, false
+	}
+}
+
+func (v *HTTPResponseValue) Has(key ast.Value) bool {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return HTTPResponseType.Has(v, key.(*ast.StringValue).StringValue)
+	default:
+		return false
+	}
+}
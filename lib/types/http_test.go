@@ -1,12 +1,16 @@
 package types_test
 
 import (
+	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/yywing/sl"
 	"github.com/yywing/sl/ast"
 	"github.com/yywing/sl/lib/types"
+	"github.com/yywing/sl/native"
 )
 
 type TestCase struct {
@@ -82,9 +86,319 @@ func TestHTTPRequestType(t *testing.T) {
 			expr:    "request.xxx",
 			wantErr: true,
 		},
+		{
+			variables: sl.Variables{
+				"request": value,
+			},
+			expr: "has(request.url.scheme) && !has(request.body)",
+			want: ast.NewBoolValue(true),
+		},
+		{
+			variables: sl.Variables{
+				"request": value,
+			},
+			expr:    "has(request.xxx)",
+			wantErr: true,
+		},
 	}
 
 	for _, testCase := range testCases {
 		RunTestCase(t, testCase)
 	}
 }
+
+func TestHTTPResponseType(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 200,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type": []string{"text/plain"},
+		},
+		Body: io.NopCloser(strings.NewReader("root:x:0:0:root:/root:/bin/bash")),
+	}
+
+	value, err := types.NewHTTPResponseValueFromResponse(resp, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []TestCase{
+		{
+			variables: sl.Variables{
+				"response": value,
+			},
+			expr: `response.status == 200 && response.body.bcontains(b"root:")`,
+			want: ast.NewBoolValue(true),
+		},
+		{
+			variables: sl.Variables{
+				"response": value,
+			},
+			expr: `response.content_type`,
+			want: ast.NewStringValue("text/plain"),
+		},
+		{
+			variables: sl.Variables{
+				"response": value,
+			},
+			expr: `response.latency > duration("1s")`,
+			want: ast.NewBoolValue(true),
+		},
+		{
+			variables: sl.Variables{
+				"response": value,
+			},
+			expr: `response.raw.bstartsWith(b"HTTP/1.1 200 OK")`,
+			want: ast.NewBoolValue(true),
+		},
+		{
+			variables: sl.Variables{
+				"response": value,
+			},
+			expr:    "response.url",
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		RunTestCase(t, testCase)
+	}
+}
+
+func TestHTTPValueFromRaw(t *testing.T) {
+	// hand written dumps often use \n and omit Content-Length
+	request, err := types.NewHTTPRequestValueFromRaw([]byte("POST /upload?a=1 HTTP/1.1\nHost: example.com:8080\nContent-Type: text/plain\n\nhello"), "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := types.NewHTTPResponseValueFromRaw([]byte("HTTP/1.1 201 Created\r\nContent-Type: application/json\r\n\r\n{\"ok\":true}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := sl.Variables{"request": request, "response": response}
+	for _, expr := range []string{
+		`request.method == "POST" && request.url.host == "example.com:8080" && request.url.scheme == "https"`,
+		`request.url.path == "/upload" && request.url.query == "a=1" && request.body == b"hello"`,
+		`response.status == 201 && response.content_type == "application/json" && response.body == b"{\"ok\":true}"`,
+	} {
+		RunTestCase(t, TestCase{variables: variables, expr: expr, want: ast.NewBoolValue(true)})
+	}
+
+	if _, err := types.NewHTTPRequestValueFromRaw([]byte("not http"), "http"); err == nil {
+		t.Error("NewHTTPRequestValueFromRaw(invalid): want error")
+	}
+}
+
+func TestHTTPHeaders(t *testing.T) {
+	response, err := types.NewHTTPResponseValueFromRaw([]byte("HTTP/1.1 200 OK\r\nset-cookie: a=1\r\nContent-Length: 0\r\nSet-Cookie: b=2\r\nX-Frame-Options: DENY\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := sl.Variables{"response": response}
+	var testCases = []TestCase{
+		{expr: `response.headers["Set-Cookie"]`, want: ast.NewStringValue("a=1,b=2")},
+		{expr: `response.headers["x-frame-options"] == "DENY"`, want: ast.NewBoolValue(true)},
+		{expr: `response.headers.values("SET-COOKIE") == ["a=1", "b=2"]`, want: ast.NewBoolValue(true)},
+		{expr: `response.headers.values("Location") == []`, want: ast.NewBoolValue(true)},
+		{expr: `response.headers.names() == ["set-cookie", "Content-Length", "Set-Cookie", "X-Frame-Options"]`, want: ast.NewBoolValue(true)},
+		{expr: `response.headers.map(k, k) == ["Set-Cookie", "Content-Length", "X-Frame-Options"]`, want: ast.NewBoolValue(true)},
+		{expr: `"set-cookie" in response.headers && !("Location" in response.headers) && size(response.headers) == 3`, want: ast.NewBoolValue(true)},
+		{expr: `response.headers.get("Location", "/") == "/" && has(response.headers.Server) == false`, want: ast.NewBoolValue(true)},
+		{expr: `response.headers[1]`, wantErr: true},
+	}
+	for _, testCase := range testCases {
+		testCase.variables = variables
+		RunTestCase(t, testCase)
+	}
+}
+
+// headers are still usable as a map<string, string>
+func TestHTTPHeadersAsMap(t *testing.T) {
+	request, err := types.NewHTTPRequestValueFromRaw([]byte("GET / HTTP/1.1\r\nHost: x.com\r\nX-A: 1\r\n\r\n"), "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := sl.Variables{"request": request}
+	var testCases = []TestCase{
+		{expr: `request.headers == {"X-A": "1", "Host": "x.com"}`, want: ast.NewBoolValue(true)},
+		{expr: `{"host": "x.com", "x-a": "1"} == request.headers`, want: ast.NewBoolValue(true)},
+		{expr: `request.headers != {"X-A": "1"} && request.headers != {"X-A": "2", "Host": "x.com"}`, want: ast.NewBoolValue(true)},
+		{expr: `[request.headers, {"a": "b"}][0]["x-a"]`, want: ast.NewStringValue("1")},
+		{expr: `request.headers == {"X-A": 1}`, wantErr: true},
+	}
+	for _, testCase := range testCases {
+		testCase.variables = variables
+		RunTestCase(t, testCase)
+	}
+
+	// functions and variables declared over maps accept headers
+	env := sl.NewStdEnv()
+	env.SetFunction("header", ast.NewBaseFunction("header", native.MustNewNativeFunction("header", func(h map[string]string, name string) string {
+		return h[name]
+	}).Definitions()))
+	node, err := sl.Parse(`header(request.headers, "X-A") + h["host"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := sl.NewProgram(node, sl.VariablesType{
+		"request": types.HTTPRequestType,
+		"h":       ast.NewMapType(ast.StringType, ast.StringType),
+	})
+	if _, err := env.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	vars := sl.Variables{"request": request, "h": request.Headers}
+	result, err := env.Run(program, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Equal(ast.NewStringValue("1x.com")) {
+		t.Errorf("want 1x.com, got %v", result)
+	}
+	compiled, err := env.Compile(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := compiled.Eval(vars); err != nil || !result.Equal(ast.NewStringValue("1x.com")) {
+		t.Errorf("compiled: want 1x.com, got %v, %v", result, err)
+	}
+
+	headers := types.NewHeadersValueFromMap(map[string]string{"Host": "x.com", "X-A": "1"})
+	if !headers.Equal(request.Headers) {
+		t.Errorf("NewHeadersValueFromMap: got %v, want %v", headers, request.Headers)
+	}
+}
+
+func TestHTTPCookies(t *testing.T) {
+	request, err := types.NewHTTPRequestValueFromRaw([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nCookie: session=abc; theme=dark\r\n\r\n"), "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := types.NewHTTPResponseValueFromRaw([]byte("HTTP/1.1 200 OK\r\n" +
+		"Set-Cookie: session=xyz; Domain=.example.com; Path=/; Expires=Wed, 21 Oct 2037 07:28:00 GMT; Secure; HttpOnly; SameSite=Strict\r\n" +
+		"Set-Cookie: theme=light\r\n" +
+		"Content-Length: 0\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := sl.Variables{"request": request, "response": response}
+	var testCases = []TestCase{
+		{expr: `cookies(request).map(c, c.name + "=" + c.value) == ["session=abc", "theme=dark"]`, want: ast.NewBoolValue(true)},
+		{expr: `request.cookies().exists(c, c.name == "session" && !c.secure && c.domain == "")`, want: ast.NewBoolValue(true)},
+		{expr: `setCookies(response).size()`, want: ast.NewIntValue(2)},
+		{expr: `response.setCookies()[0].value == "xyz" && response.setCookies()[0].domain == "example.com" && response.setCookies()[0].path == "/"`, want: ast.NewBoolValue(true)},
+		{expr: `response.setCookies().all(c, c.name != "session" || c.secure && c.httponly && c.samesite == "Strict")`, want: ast.NewBoolValue(true)},
+		{expr: `response.setCookies()[0].expires == timestamp("2037-10-21T07:28:00Z")`, want: ast.NewBoolValue(true)},
+		{expr: `has(response.setCookies()[0].expires) && !has(response.setCookies()[1].expires) && response.setCookies()[1].samesite == ""`, want: ast.NewBoolValue(true)},
+		// an unset timestamp reads as the zero timestamp
+		{expr: `int(response.setCookies()[1].expires) == 0`, want: ast.NewBoolValue(true)},
+		{expr: `cookies(response)`, wantErr: true},
+	}
+	for _, testCase := range testCases {
+		testCase.variables = variables
+		RunTestCase(t, testCase)
+	}
+}
+
+func TestHTTPParams(t *testing.T) {
+	body := "--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"user\"\r\n\r\n" +
+		"admin\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"../../shell.php\"\r\n" +
+		"Content-Type: application/octet-stream\r\n\r\n" +
+		"<?php echo 1; ?>\r\n" +
+		"--XyZ--\r\n"
+	request, err := types.NewHTTPRequestValueFromRaw([]byte("POST /upload?id=1&id=2&q=a%20b HTTP/1.1\r\nHost: example.com\r\nContent-Type: multipart/form-data; boundary=XyZ\r\n\r\n"+body), "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := sl.Variables{"request": request}
+	var testCases = []TestCase{
+		{expr: `request.url.queryParams() == {"id": ["1", "2"], "q": ["a b"]}`, want: ast.NewBoolValue(true)},
+		{expr: `"x" in queryParams(request.url)`, want: ast.NewBoolValue(false)},
+		{expr: `parseMultipart(request.body, request.content_type).map(p, p.name) == ["user", "file"]`, want: ast.NewBoolValue(true)},
+		{expr: `parseMultipart(request.body, request.content_type)[0].content == b"admin"`, want: ast.NewBoolValue(true)},
+		{expr: `parseMultipart(request.body, request.content_type).exists(p, p.filename.endsWith(".php") && p.filename.startsWith("../") && p.headers["content-type"] == "application/octet-stream" && p.content.bcontains(b"<?php"))`, want: ast.NewBoolValue(true)},
+		{expr: `has(parseMultipart(request.body, request.content_type)[0].filename)`, want: ast.NewBoolValue(false)},
+	}
+	for _, testCase := range testCases {
+		testCase.variables = variables
+		RunTestCase(t, testCase)
+	}
+
+	env := sl.NewStdEnv()
+	node, err := sl.Parse(`parseMultipart(request.body, "text/plain")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := sl.NewProgram(node, variables.Type())
+	if _, err := env.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Run(program, variables); err == nil {
+		t.Error("parseMultipart(text/plain): want error")
+	}
+}
+
+func TestHTTPRequestEqual(t *testing.T) {
+	raw := "GET /a HTTP/1.1\r\nHost: Example.com\r\nAccept: */*\r\n\r\n"
+	a, err := types.NewHTTPRequestValueFromRaw([]byte(raw), "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := types.NewHTTPRequestValueFromRaw([]byte(raw), "HTTPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := types.NewHTTPRequestValueFromRaw([]byte(strings.Replace(raw, "*/*", "text/html", 1)), "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.Equal(b) {
+		t.Error("Equal(same request): got false")
+	}
+	if a.Equal(c) {
+		t.Error("Equal(other headers): got true")
+	}
+	if !a.URL.Equal(types.NewURL("https://example.com:443/a")) {
+		t.Errorf("URL.Equal(%s): got false", a.URL)
+	}
+}
+
+func TestHTTPResponseEqual(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<h1>hi</h1>"
+	a, err := types.NewHTTPResponseValueFromRaw([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{raw: raw, want: true},
+		{raw: strings.Replace(raw, "200 OK", "404 Not Found", 1)},
+		{raw: strings.Replace(raw, "text/html", "text/plain", 1)},
+		{raw: strings.Replace(raw, "hi", "ho", 1)},
+	}
+	for _, tt := range tests {
+		b, err := types.NewHTTPResponseValueFromRaw([]byte(tt.raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.Equal(b); got != tt.want {
+			t.Errorf("Equal(%q): got %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+	if a.Equal(ast.NewIntValue(200)) {
+		t.Error("Equal(int): got true")
+	}
+}
@@ -0,0 +1,59 @@
+package types
+
+import (
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/native"
+)
+
+const (
+	TypeKindMultipartPart = "multipart_part"
+)
+
+var (
+	MultipartPartType = native.NewNativeSelectorType[*MultipartPartValue](TypeKindMultipartPart)
+)
+
+// MultipartPartValue is a part of a multipart body, e.g. a field or a file of
+// a multipart/form-data upload
+type MultipartPartValue struct {
+	// the name parameter of Content-Disposition
+	Name     string        `sl:"name"`
+	Filename string        `sl:"filename"`
+	Headers  *HeadersValue `sl:"headers"`
+	Content  []byte        `sl:"content"`
+}
+
+func (v *MultipartPartValue) Type() ast.ValueType {
+	return MultipartPartType
+}
+
+func (v *MultipartPartValue) String() string {
+	return v.Headers.String() + "\r\n" + string(v.Content)
+}
+
+func (v *MultipartPartValue) Equal(other ast.Value) bool {
+	otherValue, ok := other.(*MultipartPartValue)
+	if !ok {
+		return false
+	}
+	return v.Name == otherValue.Name && v.Filename == otherValue.Filename &&
+		v.Headers.Equal(otherValue.Headers) && string(v.Content) == string(otherValue.Content)
+}
+
+func (v *MultipartPartValue) Get(key ast.Value) (ast.Value, bool) {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return MultipartPartType.Get(v, key.(*ast.StringValue).StringValue)
+	default:
+		return nil, false
+	}
+}
+
+func (v *MultipartPartValue) Has(key ast.Value) bool {
+	switch key.Type().Kind() {
+	case ast.TypeKindString:
+		return MultipartPartType.Has(v, key.(*ast.StringValue).StringValue)
+	default:
+		return false
+	}
+}
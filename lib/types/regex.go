@@ -0,0 +1,48 @@
+package types
+
+import (
+	"github.com/dlclark/regexp2"
+	"github.com/yywing/sl/ast"
+)
+
+const (
+	TypeKindRegex = "regex"
+)
+
+var (
+	RegexType = ast.NewPrimitiveType(TypeKindRegex, 0)
+)
+
+// RegexValue is a compiled regular expression, the optimizer replaces pattern
+// literals passed to matches() with it so they are compiled only once
+type RegexValue struct {
+	Pattern string
+	Regexp  *regexp2.Regexp
+}
+
+func NewRegexValue(pattern string) (*RegexValue, error) {
+	re, err := regexp2.Compile(pattern, regexp2.RE2)
+	if err != nil {
+		return nil, err
+	}
+	return &RegexValue{
+		Pattern: pattern,
+		Regexp:  re,
+	}, nil
+}
+
+func (v *RegexValue) Type() ast.ValueType {
+	return RegexType
+}
+
+func (v *RegexValue) String() string {
+	return v.Pattern
+}
+
+func (v *RegexValue) Equal(other ast.Value) bool {
+	otherValue, ok := other.(*RegexValue)
+	if !ok {
+		return false
+	}
+	return v.Pattern == otherValue.Pattern
+}
@@ -8,4 +8,14 @@ var LibTypes = []ast.ValueType{
 	// DurationType,
 	// XMLType,
 	HTTPRequestType,
+	HTTPResponseType,
+	HeadersType,
+	CookieType,
+	MultipartPartType,
+}
+
+// types built by struct expressions, e.g. HTTPRequest{method: "POST"}
+var LibStructTypes = map[string]ast.StructType{
+	"HTTPRequest":  HTTPRequestType,
+	"HTTPResponse": HTTPResponseType,
 }
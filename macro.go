@@ -0,0 +1,239 @@
+package sl
+
+import (
+	"fmt"
+
+	"github.com/yywing/sl/ast"
+)
+
+const (
+	MacroAll       = "all"
+	MacroExists    = "exists"
+	MacroExistsOne = "exists_one"
+	MacroMap       = "map"
+	MacroFilter    = "filter"
+	MacroHas       = "has"
+	MacroBind      = "bind"
+	MacroCelBind   = "cel.bind"
+
+	// AccumulatorName is the name of the accumulator variable of expanded
+	// comprehensions, it is not an identifier so it cannot hide a variable
+	AccumulatorName = "@result"
+)
+
+// MacroExpander expands a macro call into a new AST, target is nil for global calls
+type MacroExpander func(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error)
+
+// Macro is a function call that is rewritten at parse time
+type Macro struct {
+	Name          string
+	ArgCount      int
+	ReceiverStyle bool
+	Expander      MacroExpander
+}
+
+func (m *Macro) key() string {
+	return macroKey(m.Name, m.ArgCount, m.ReceiverStyle)
+}
+
+func macroKey(name string, argCount int, receiverStyle bool) string {
+	return fmt.Sprintf("%s:%d:%t", name, argCount, receiverStyle)
+}
+
+var (
+	HasMacro = &Macro{
+		Name:          MacroHas,
+		ArgCount:      1,
+		ReceiverStyle: false,
+		Expander:      expandHas,
+	}
+	AllMacro = &Macro{
+		Name:          MacroAll,
+		ArgCount:      2,
+		ReceiverStyle: true,
+		Expander:      expandAll,
+	}
+	ExistsMacro = &Macro{
+		Name:          MacroExists,
+		ArgCount:      2,
+		ReceiverStyle: true,
+		Expander:      expandExists,
+	}
+	ExistsOneMacro = &Macro{
+		Name:          MacroExistsOne,
+		ArgCount:      2,
+		ReceiverStyle: true,
+		Expander:      expandExistsOne,
+	}
+	MapMacro = &Macro{
+		Name:          MacroMap,
+		ArgCount:      2,
+		ReceiverStyle: true,
+		Expander:      expandMap,
+	}
+	MapFilterMacro = &Macro{
+		Name:          MacroMap,
+		ArgCount:      3,
+		ReceiverStyle: true,
+		Expander:      expandMap,
+	}
+	FilterMacro = &Macro{
+		Name:          MacroFilter,
+		ArgCount:      2,
+		ReceiverStyle: true,
+		Expander:      expandFilter,
+	}
+
+	BindMacro = &Macro{
+		Name:          MacroBind,
+		ArgCount:      3,
+		ReceiverStyle: false,
+		Expander:      expandBind,
+	}
+	// CelBindMacro is bind written like in CEL
+	CelBindMacro = &Macro{
+		Name:          MacroCelBind,
+		ArgCount:      3,
+		ReceiverStyle: false,
+		Expander:      expandBind,
+	}
+
+	BuiltinMacros = []*Macro{
+		HasMacro,
+		AllMacro,
+		ExistsMacro,
+		ExistsOneMacro,
+		MapMacro,
+		MapFilterMacro,
+		FilterMacro,
+		BindMacro,
+		CelBindMacro,
+	}
+
+	macros = func() map[string]*Macro {
+		result := make(map[string]*Macro, len(BuiltinMacros))
+		for _, m := range BuiltinMacros {
+			result[m.key()] = m
+		}
+		return result
+	}()
+)
+
+func findMacro(name string, argCount int, receiverStyle bool) (*Macro, bool) {
+	m, ok := macros[macroKey(name, argCount, receiverStyle)]
+	return m, ok
+}
+
+func iterVarName(node ast.ASTNode) (string, error) {
+	ident, ok := node.(*ast.IdentNode)
+	if !ok || ident.LeadingDot {
+		return "", fmt.Errorf("argument must be a simple name, got %s", node.String())
+	}
+	if ident.Name == AccumulatorName {
+		return "", fmt.Errorf("iteration variable overwrites accumulator variable")
+	}
+	return ident.Name, nil
+}
+
+func accuIdent() ast.ASTNode {
+	return ast.NewIdent(AccumulatorName, false)
+}
+
+func call(fn string, args ...ast.ASTNode) ast.ASTNode {
+	return ast.NewFunctionCall(ast.NewIdent(fn, false), args)
+}
+
+func expandHas(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error) {
+	member, ok := args[0].(*ast.MemberAccessNode)
+	if !ok || member.Optional {
+		return nil, fmt.Errorf("invalid argument to has() macro, got %s", args[0].String())
+	}
+	return ast.NewPresenceTest(member.Object, member.Member), nil
+}
+
+func expandAll(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error) {
+	v, err := iterVarName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewComprehension(
+		v, target, AccumulatorName,
+		ast.NewLiteral(ast.NewBoolValue(true)),
+		accuIdent(),
+		call(ast.LogicalAnd, accuIdent(), args[1]),
+		accuIdent(),
+	), nil
+}
+
+func expandExists(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error) {
+	v, err := iterVarName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewComprehension(
+		v, target, AccumulatorName,
+		ast.NewLiteral(ast.NewBoolValue(false)),
+		call(ast.LogicalNot, accuIdent()),
+		call(ast.LogicalOr, accuIdent(), args[1]),
+		accuIdent(),
+	), nil
+}
+
+func expandExistsOne(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error) {
+	v, err := iterVarName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	one := ast.NewLiteral(ast.NewIntValue(1))
+	return ast.NewComprehension(
+		v, target, AccumulatorName,
+		ast.NewLiteral(ast.NewIntValue(0)),
+		ast.NewLiteral(ast.NewBoolValue(true)),
+		ast.NewConditional(args[1], call(ast.Add, accuIdent(), one), accuIdent()),
+		call(ast.Equals, accuIdent(), one),
+	), nil
+}
+
+// map(x, t) or map(x, p, t)
+func expandMap(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error) {
+	v, err := iterVarName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var step ast.ASTNode
+	if len(args) == 3 {
+		step = ast.NewConditional(args[1], call(ast.Add, accuIdent(), ast.NewList([]ast.ASTNode{args[2]})), accuIdent())
+	} else {
+		step = call(ast.Add, accuIdent(), ast.NewList([]ast.ASTNode{args[1]}))
+	}
+	return ast.NewComprehension(
+		v, target, AccumulatorName,
+		ast.NewList(nil),
+		ast.NewLiteral(ast.NewBoolValue(true)),
+		step,
+		accuIdent(),
+	), nil
+}
+
+func expandFilter(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error) {
+	v, err := iterVarName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	step := ast.NewConditional(args[1], call(ast.Add, accuIdent(), ast.NewList([]ast.ASTNode{ast.NewIdent(v, false)})), accuIdent())
+	return ast.NewComprehension(
+		v, target, AccumulatorName,
+		ast.NewList(nil),
+		ast.NewLiteral(ast.NewBoolValue(true)),
+		step,
+		accuIdent(),
+	), nil
+}
+
+func expandBind(target ast.ASTNode, args []ast.ASTNode) (ast.ASTNode, error) {
+	ident, ok := args[0].(*ast.IdentNode)
+	if !ok || ident.LeadingDot {
+		return nil, fmt.Errorf("variable name must be a simple name, got %s", args[0].String())
+	}
+	return ast.NewBind(ident.Name, args[1], args[2]), nil
+}
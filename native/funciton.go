@@ -16,6 +16,9 @@ type NativeFunction struct {
 	returnType ast.ValueType
 	// Is a reverse list of parameters
 	defaultArgs []reflect.Value
+	cost        ast.CostFunction
+	costHint    ast.CostHint
+	pure        bool
 }
 
 func (f *NativeFunction) Definitions() []ast.Definition {
@@ -30,6 +33,9 @@ func (f *NativeFunction) Definitions() []ast.Definition {
 			Call: func(args []ast.Value) (ast.Value, error) {
 				return f.call(args)
 			},
+			Cost:     f.cost,
+			CostHint: f.costHint,
+			Pure:     f.pure,
 		})
 	}
 	return defs
@@ -41,6 +47,31 @@ func (f *NativeFunction) WithDefaultArg(value interface{}) *NativeFunction {
 	return f
 }
 
+// WithCost sets the cost of a call, the default cost is 1
+func (f *NativeFunction) WithCost(cost ast.CostFunction) *NativeFunction {
+	f.cost = cost
+	return f
+}
+
+// WithCostHint sets the estimation of the cost of a call by the checker, the
+// default estimation is 1
+func (f *NativeFunction) WithCostHint(hint ast.CostHint) *NativeFunction {
+	f.costHint = hint
+	return f
+}
+
+// WithLinearCost sets a cost that grows linearly with the size of the arguments
+func (f *NativeFunction) WithLinearCost(factor float64) *NativeFunction {
+	return f.WithCost(ast.LinearCost(factor)).WithCostHint(ast.LinearCostHint(factor))
+}
+
+// WithPure marks the function as always returning the same result for the same
+// arguments, so that calls with constant arguments may be folded
+func (f *NativeFunction) WithPure() *NativeFunction {
+	f.pure = true
+	return f
+}
+
 func (f *NativeFunction) Call(args []ast.Value) (result ast.Value, err error) {
 	defer func() {
 		if r := recover(); r != nil {
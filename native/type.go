@@ -1,12 +1,24 @@
 package native
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/yywing/sl/ast"
 )
 
+// Convertible is implemented by the pointer types of members that struct
+// expressions also set from values of other types, e.g. headers from a
+// map<string, string>
+type Convertible interface {
+	// ConvertsFrom reports whether a value of type t can be converted
+	ConvertsFrom(t ast.ValueType) bool
+	// SetFrom sets the receiver to the conversion of v
+	SetFrom(v ast.Value) error
+}
+
 type NativeSelectorType[T ast.Value] struct {
 	*ast.PrimitiveType
 	once   sync.Once
@@ -61,6 +73,16 @@ func (t *NativeSelectorType[T]) Member(name string) ast.ValueType {
 	return t.types[name]
 }
 
+// Members returns the member names, sorted
+func (t *NativeSelectorType[T]) Members() []string {
+	names := make([]string, 0, len(t.types))
+	for name := range t.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (t *NativeSelectorType[T]) Get(v T, key string) (ast.Value, bool) {
 	index, ok := t.fields[key]
 	if !ok {
@@ -74,8 +96,122 @@ func (t *NativeSelectorType[T]) Get(v T, key string) (ast.Value, bool) {
 
 	field := value.FieldByIndex(index)
 
+	// an unset value, e.g. a nil *TimestampValue, reads as the zero value of
+	// its type, Has reports it as unset
+	if field.Kind() == reflect.Pointer && field.IsNil() {
+		if field.Type().Elem().Kind() != reflect.Struct {
+			return ast.NewNullValue(), true
+		}
+		field = reflect.New(field.Type().Elem())
+	}
 	if field.IsValid() {
 		return ValueFromGo(field.Interface()), true
 	}
 	return nil, false
 }
+
+// Has reports whether the member is set to a non-zero value, members with keys
+// such as headers are set when they are not empty
+func (t *NativeSelectorType[T]) Has(v T, key string) bool {
+	index, ok := t.fields[key]
+	if !ok {
+		return false
+	}
+
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+
+	field := value.FieldByIndex(index)
+	if !field.IsValid() || field.IsZero() {
+		return false
+	}
+	if keyed, ok := field.Interface().(ast.Keyed); ok {
+		return len(keyed.Keys()) > 0
+	}
+	return true
+}
+
+// ConvertsField reports whether the member name is Convertible from t, see
+// ast.FieldConverter
+func (t *NativeSelectorType[T]) ConvertsField(name string, vt ast.ValueType) bool {
+	c, ok := t.convertible(name)
+	return ok && c.ConvertsFrom(vt)
+}
+
+// convertible returns a new value of the member name when its type is
+// Convertible
+func (t *NativeSelectorType[T]) convertible(name string) (Convertible, bool) {
+	index, ok := t.fields[name]
+	if !ok {
+		return nil, false
+	}
+	var zero T
+	tType := reflect.TypeOf(zero)
+	if tType.Kind() == reflect.Pointer {
+		tType = tType.Elem()
+	}
+	fieldType := tType.FieldByIndex(index).Type
+	if fieldType.Kind() != reflect.Pointer {
+		return nil, false
+	}
+	c, ok := reflect.New(fieldType.Elem()).Interface().(Convertible)
+	return c, ok
+}
+
+// NewValue returns a T with the members in fields set, see ast.StructType
+func (t *NativeSelectorType[T]) NewValue(fields map[string]ast.Value) (ast.Value, error) {
+	var zero T
+	tType := reflect.TypeOf(zero)
+	if tType.Kind() != reflect.Pointer || tType.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type %s cannot be constructed", t.Kind())
+	}
+
+	value := reflect.New(tType.Elem())
+	for name, fieldValue := range fields {
+		index, ok := t.fields[name]
+		if !ok {
+			return nil, fmt.Errorf("member %s not found in type %s", name, t.Kind())
+		}
+		field := value.Elem().FieldByIndex(index)
+
+		if c, ok := t.convertible(name); ok && reflect.TypeOf(fieldValue) != field.Type() {
+			if err := c.SetFrom(fieldValue); err != nil {
+				return nil, fmt.Errorf("member %s of type %s: %v", name, t.Kind(), err)
+			}
+			field.Set(reflect.ValueOf(c))
+			continue
+		}
+
+		goValue, err := ValueToGo(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+		// null, empty lists and maps leave the zero value
+		if goValue == nil {
+			continue
+		}
+		v := reflect.ValueOf(goValue)
+		switch {
+		case v.Type().AssignableTo(field.Type()):
+			field.Set(v)
+		case v.Kind() == field.Kind() && v.Type().ConvertibleTo(field.Type()):
+			field.Set(v.Convert(field.Type()))
+		default:
+			return nil, fmt.Errorf("member %s of type %s cannot be %s", name, t.Kind(), fieldValue.Type().String())
+		}
+	}
+	// unset members with keys, e.g. headers, are empty rather than nil
+	for _, index := range t.fields {
+		field := value.Elem().FieldByIndex(index)
+		if field.Kind() != reflect.Pointer || !field.IsNil() {
+			continue
+		}
+		empty := reflect.New(field.Type().Elem())
+		if _, ok := empty.Interface().(ast.Keyed); ok {
+			field.Set(empty)
+		}
+	}
+	return value.Interface().(T), nil
+}
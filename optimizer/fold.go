@@ -0,0 +1,58 @@
+package optimizer
+
+import (
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+// FoldConstants evaluates subexpressions whose operands are all constants, e.g.
+// "a" + "b" or base64Decode("..."). Calls are only folded for pure functions,
+// and only results that can be written as literals replace the expression.
+// Subexpressions that fail are kept so that the error is reported at runtime.
+func FoldConstants(o *Optimizer, node ast.ASTNode) ast.ASTNode {
+	var operands []ast.ASTNode
+	switch n := node.(type) {
+	case *ast.FunctionCallNode:
+		name, args := callName(n)
+		fn, ok := o.env.GetFunction(name)
+		if !ok {
+			return node
+		}
+		if p, ok := fn.(ast.Purity); !ok || !p.Pure() {
+			return node
+		}
+		operands = args
+	case *ast.MemberAccessNode, *ast.IndexNode, *ast.ListNode, *ast.MapNode, *ast.PresenceTestNode:
+		operands = ast.Children(node)
+	default:
+		return node
+	}
+
+	for _, operand := range operands {
+		if !isConstant(operand) {
+			return node
+		}
+	}
+
+	value, err := o.env.Run(sl.NewProgram(node, nil), nil)
+	if err != nil || !ast.IsLiteralValue(value) {
+		return node
+	}
+	return literal(value, node.Location())
+}
+
+// isConstant reports whether node is a literal, or a list or map of constants
+func isConstant(node ast.ASTNode) bool {
+	switch node.(type) {
+	case *ast.LiteralNode:
+		return true
+	case *ast.ListNode, *ast.MapNode:
+		for _, child := range ast.Children(node) {
+			if !isConstant(child) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package optimizer
+
+import (
+	"github.com/yywing/sl/ast"
+)
+
+// ShortCircuit removes the operands of && and || that cannot change the result,
+// e.g. true || x is true and true && x is x, and selects the branch of
+// conditionals with a literal condition. Only a literal left operand decides
+// the result, x || true is kept since x is evaluated first and may fail, while
+// x || false is x.
+func ShortCircuit(o *Optimizer, node ast.ASTNode) ast.ASTNode {
+	switch n := node.(type) {
+	case *ast.ConditionalNode:
+		if cond, ok := boolLiteral(n.Condition); ok {
+			if cond {
+				return n.TrueExpr
+			}
+			return n.FalseExpr
+		}
+	case *ast.FunctionCallNode:
+		fn, ok := n.Function.(*ast.IdentNode)
+		if !ok || len(n.Args) != 2 {
+			return node
+		}
+		switch fn.Name {
+		case ast.LogicalOr:
+			// true absorbs, false is the identity
+			return shortCircuit(n, true)
+		case ast.LogicalAnd:
+			// false absorbs, true is the identity
+			return shortCircuit(n, false)
+		}
+	}
+	return node
+}
+
+func shortCircuit(n *ast.FunctionCallNode, absorbing bool) ast.ASTNode {
+	left, right := n.Args[0], n.Args[1]
+	if b, ok := boolLiteral(left); ok {
+		if b == absorbing {
+			return literal(ast.NewBoolValue(b), n.Location())
+		}
+		return right
+	}
+	if b, ok := boolLiteral(right); ok && b != absorbing {
+		return left
+	}
+	return n
+}
@@ -0,0 +1,95 @@
+// Package optimizer rewrites ASTs into equivalent ones that are cheaper to
+// evaluate. It should run on checked programs, passes assume the AST is well
+// typed and may remove subexpressions that would not type check.
+package optimizer
+
+import (
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+// Pass rewrites a node whose children are already optimized, it returns node
+// itself when there is nothing to do
+type Pass func(o *Optimizer, node ast.ASTNode) ast.ASTNode
+
+// DefaultPasses are the passes used when none are given to New
+var DefaultPasses = []Pass{ShortCircuit, FoldConstants, PrecompileRegex}
+
+// Optimizer applies passes to every node of an AST, bottom-up
+type Optimizer struct {
+	env    *sl.Env
+	passes []Pass
+}
+
+// New creates an optimizer for expressions of env
+func New(env *sl.Env, passes ...Pass) *Optimizer {
+	if len(passes) == 0 {
+		passes = DefaultPasses
+	}
+	return &Optimizer{env: env, passes: passes}
+}
+
+// Env returns the environment of the optimized expressions
+func (o *Optimizer) Env() *sl.Env {
+	return o.env
+}
+
+// Optimize returns an optimized copy of node, node itself is not modified
+func (o *Optimizer) Optimize(node ast.ASTNode) ast.ASTNode {
+	children := ast.Children(node)
+	optimized := make([]ast.ASTNode, len(children))
+	for i, child := range children {
+		if _, ok := node.(*ast.FunctionCallNode); ok && i == 0 {
+			// the function name is not an expression, only its receiver is
+			optimized[i] = ast.WithChildren(child, o.optimizeAll(ast.Children(child)))
+			continue
+		}
+		optimized[i] = o.Optimize(child)
+	}
+	if len(children) > 0 {
+		node = ast.WithChildren(node, optimized)
+	}
+
+	for _, pass := range o.passes {
+		node = pass(o, node)
+	}
+	return node
+}
+
+func (o *Optimizer) optimizeAll(nodes []ast.ASTNode) []ast.ASTNode {
+	results := make([]ast.ASTNode, len(nodes))
+	for i, node := range nodes {
+		results[i] = o.Optimize(node)
+	}
+	return results
+}
+
+// callName returns the name and the arguments of a call, the receiver of member
+// calls is the first argument
+func callName(node *ast.FunctionCallNode) (string, []ast.ASTNode) {
+	switch fn := node.Function.(type) {
+	case *ast.IdentNode:
+		return fn.Name, node.Args
+	case *ast.MemberAccessNode:
+		return fn.Member, append([]ast.ASTNode{fn.Object}, node.Args...)
+	}
+	return "", nil
+}
+
+func literal(value ast.Value, loc ast.Location) ast.ASTNode {
+	node := ast.NewLiteral(value)
+	node.SetLocation(loc)
+	return node
+}
+
+func boolLiteral(node ast.ASTNode) (bool, bool) {
+	lit, ok := node.(*ast.LiteralNode)
+	if !ok {
+		return false, false
+	}
+	b, ok := lit.Value.(*ast.BoolValue)
+	if !ok {
+		return false, false
+	}
+	return b.BoolValue, true
+}
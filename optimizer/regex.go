@@ -0,0 +1,53 @@
+package optimizer
+
+import (
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+)
+
+const matches = "matches"
+
+// PrecompileRegex replaces pattern literals passed to matches() with compiled
+// regexes, so that they are not compiled on each call. It requires the
+// matches(string, regex) overload of the standard library, invalid patterns
+// are kept so that the error is reported at runtime.
+func PrecompileRegex(o *Optimizer, node ast.ASTNode) ast.ASTNode {
+	call, ok := node.(*ast.FunctionCallNode)
+	if !ok || len(call.Args) == 0 {
+		return node
+	}
+	name, args := callName(call)
+	if name != matches || len(args) != 2 || !o.hasRegexOverload() {
+		return node
+	}
+
+	pattern, ok := call.Args[len(call.Args)-1].(*ast.LiteralNode)
+	if !ok {
+		return node
+	}
+	s, ok := pattern.Value.(*ast.StringValue)
+	if !ok {
+		return node
+	}
+	re, err := types.NewRegexValue(s.StringValue)
+	if err != nil {
+		return node
+	}
+
+	result := *call
+	result.Args = append(append([]ast.ASTNode{}, call.Args[:len(call.Args)-1]...), literal(re, pattern.Location()))
+	return &result
+}
+
+func (o *Optimizer) hasRegexOverload() bool {
+	fn, ok := o.env.GetFunction(matches)
+	if !ok {
+		return false
+	}
+	for _, t := range fn.Types() {
+		if _, ok := ast.MatchFunctionTypes(t.ParamTypes(), []ast.ValueType{ast.StringType, types.RegexType}); ok {
+			return true
+		}
+	}
+	return false
+}
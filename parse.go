@@ -17,23 +17,37 @@ type ParseError struct {
 	Message string
 	Line    int
 	Column  int
+	// character offsets of the offending text, -1 when unknown
+	Start int
+	Stop  int
 }
 
 func (e *ParseError) Error() string {
 	return fmt.Sprintf("parse error at line %d, column %d: %s", e.Line, e.Column, e.Message)
 }
 
+func (e *ParseError) Location() ast.Location {
+	return ast.Location{Start: e.Start, Stop: e.Stop}
+}
+
 // ErrorListener implements the antlr.ErrorListener interface
 type ErrorListener struct {
 	Errors []ParseError
 }
 
 func (e *ErrorListener) SyntaxError(recognizer antlr.Recognizer, offendingSymbol interface{}, line, column int, msg string, ex antlr.RecognitionException) {
-	e.Errors = append(e.Errors, ParseError{
+	parseError := ParseError{
 		Message: msg,
 		Line:    line,
 		Column:  column,
-	})
+		Start:   -1,
+		Stop:    -1,
+	}
+	if token, ok := offendingSymbol.(antlr.Token); ok && token.GetTokenType() != antlr.TokenEOF {
+		parseError.Start = token.GetStart()
+		parseError.Stop = token.GetStop() + 1
+	}
+	e.Errors = append(e.Errors, parseError)
 }
 
 func (e *ErrorListener) ReportAmbiguity(recognizer antlr.Parser, dfa *antlr.DFA, startIndex, stopIndex int, exact bool, ambigAlts *antlr.BitSet, configs *antlr.ATNConfigSet) {
@@ -51,24 +65,43 @@ func (e *ErrorListener) ReportContextSensitivity(recognizer antlr.Parser, dfa *a
 // ASTBuilder implements parser.BaseSLVisitor to build AST
 type ASTBuilder struct {
 	parser.BaseSLVisitor
+
+	// errors found while building, e.g. invalid macro arguments
+	issues *Issues
 }
 
-// Parse parses an expression string and returns an AST
+// Parse parses an expression string and returns an AST, only the first error
+// is returned, use ParseAll to get all of them
 func Parse(expression string) (ast.ASTNode, error) {
+	node, issues := ParseAll(expression)
+	if issues.Len() > 0 {
+		return nil, issues.Errors()[0]
+	}
+	return node, nil
+}
+
+// ParseAll parses an expression string and returns an AST, or every syntax
+// error found in the expression
+func ParseAll(expression string) (ast.ASTNode, *Issues) {
+	issues := &Issues{}
+
 	// Create input stream
 	input := antlr.NewInputStream(expression)
 
 	// Create lexer
 	lexer := parser.NewSLLexer(input)
 
+	// Add error listener
+	errorListener := &ErrorListener{}
+	lexer.RemoveErrorListeners()
+	lexer.AddErrorListener(errorListener)
+
 	// Create token stream
 	stream := antlr.NewCommonTokenStream(lexer, 0)
 
 	// Create parser
 	p := parser.NewSLParser(stream)
 
-	// Add error listener
-	errorListener := &ErrorListener{}
 	p.RemoveErrorListeners()
 	p.AddErrorListener(errorListener)
 
@@ -77,25 +110,48 @@ func Parse(expression string) (ast.ASTNode, error) {
 
 	// Check for parsing errors
 	if len(errorListener.Errors) > 0 {
-		return nil, &errorListener.Errors[0]
+		for i := range errorListener.Errors {
+			issues.Add(&errorListener.Errors[i])
+		}
+		return nil, issues
 	}
 
 	// Build AST
-	builder := &ASTBuilder{}
+	builder := &ASTBuilder{issues: issues}
 	result := builder.Visit(tree)
+	if issues.Len() > 0 {
+		return nil, issues
+	}
 
-	switch result := result.(type) {
+	node, ok := result.(ast.ASTNode)
+	if !ok {
+		issues.Add(fmt.Errorf("failed to build AST"))
+		return nil, issues
+	}
+	return node, nil
+}
+
+// Visit dispatches to specific visit methods based on node type, the resulting
+// node is given the location of the rule it was built from
+func (v *ASTBuilder) Visit(tree antlr.ParseTree) interface{} {
+	result := v.visit(tree)
+	ctx, ok := tree.(antlr.ParserRuleContext)
+	if !ok {
+		return result
+	}
+
+	switch r := result.(type) {
 	case ast.ASTNode:
-		return result, nil
+		setLocation(r, ruleLocation(ctx))
 	case error:
-		return nil, result
-	default:
-		return nil, fmt.Errorf("failed to build AST")
+		// e.g. out of range literals, keep building so that every error is reported
+		v.addError(ctx, r.Error())
+		return ast.NewLiteral(ast.NewNullValue())
 	}
+	return result
 }
 
-// Visit dispatches to specific visit methods based on node type
-func (v *ASTBuilder) Visit(tree antlr.ParseTree) interface{} {
+func (v *ASTBuilder) visit(tree antlr.ParseTree) interface{} {
 	switch t := tree.(type) {
 	case parser.IStartContext:
 		return v.VisitStart(t)
@@ -122,6 +178,32 @@ func (v *ASTBuilder) Visit(tree antlr.ParseTree) interface{} {
 	}
 }
 
+func tokenLocation(start, stop antlr.Token) ast.Location {
+	if start == nil || stop == nil {
+		return ast.NoLocation
+	}
+	return ast.Location{Start: start.GetStart(), Stop: stop.GetStop() + 1}
+}
+
+func ruleLocation(ctx antlr.ParserRuleContext) ast.Location {
+	return tokenLocation(ctx.GetStart(), ctx.GetStop())
+}
+
+// setLocation sets loc on node and on descendants without a location, e.g. the
+// function name of operators or the nodes generated by macros
+func setLocation(node ast.ASTNode, loc ast.Location) {
+	if !loc.IsValid() {
+		return
+	}
+	ast.Walk(node, func(n ast.ASTNode) bool {
+		if n.Location().IsValid() {
+			return false
+		}
+		n.SetLocation(loc)
+		return true
+	})
+}
+
 func (v *ASTBuilder) VisitStart(ctx parser.IStartContext) interface{} {
 	if ctx.GetE() != nil {
 		return v.Visit(ctx.GetE())
@@ -157,6 +239,7 @@ func (v *ASTBuilder) VisitConditionalOr(ctx parser.IConditionalOrContext) interf
 			}
 
 			left = ast.NewFunctionCall(ast.NewIdent(functionName, false), []ast.ASTNode{left, right})
+			setLocation(left, tokenLocation(ctx.GetStart(), ctx.GetE1()[i].GetStop()))
 		}
 	}
 
@@ -178,6 +261,7 @@ func (v *ASTBuilder) VisitConditionalAnd(ctx parser.IConditionalAndContext) inte
 			}
 
 			left = ast.NewFunctionCall(ast.NewIdent(functionName, false), []ast.ASTNode{left, right})
+			setLocation(left, tokenLocation(ctx.GetStart(), ctx.GetE1()[i].GetStop()))
 		}
 	}
 
@@ -261,8 +345,9 @@ func (v *ASTBuilder) VisitUnary(ctx parser.IUnaryContext) interface{} {
 			// Handle logical NOT operator
 			ops := unaryCtx.GetOps()
 			result := memberNode
-			for range ops {
+			for i := range ops {
 				result = ast.NewFunctionCall(ast.NewIdent(ast.LogicalNot, false), []ast.ASTNode{result})
+				setLocation(result, tokenLocation(ops[len(ops)-1-i], unaryCtx.GetStop()))
 			}
 			return result
 		}
@@ -272,8 +357,9 @@ func (v *ASTBuilder) VisitUnary(ctx parser.IUnaryContext) interface{} {
 			// Handle negation operator
 			ops := unaryCtx.GetOps()
 			result := memberNode
-			for range ops {
+			for i := range ops {
 				result = ast.NewFunctionCall(ast.NewIdent(ast.Negate, false), []ast.ASTNode{result})
+				setLocation(result, tokenLocation(ops[len(ops)-1-i], unaryCtx.GetStop()))
 			}
 			return result
 		}
@@ -311,6 +397,15 @@ func (v *ASTBuilder) VisitMember(ctx parser.IMemberContext) interface{} {
 			if argsCtx := memberCtx.GetArgs(); argsCtx != nil {
 				args = v.VisitExprList(argsCtx)
 			}
+			if m, ok := findMacro(methodName, len(args), true); ok {
+				return v.expandMacro(memberCtx, m, memberNode, args)
+			}
+			if ident, ok := memberNode.(*ast.IdentNode); ok && !ident.LeadingDot {
+				// macros in a namespace, e.g. cel.bind(x, init, expr)
+				if m, ok := findMacro(ident.Name+"."+methodName, len(args), false); ok {
+					return v.expandMacro(memberCtx, m, nil, args)
+				}
+			}
 			return ast.NewFunctionCall(ast.NewMemberAccess(memberNode, methodName, false), args)
 		}
 	case *parser.IndexContext:
@@ -346,16 +441,19 @@ func (v *ASTBuilder) VisitPrimary(ctx parser.IPrimaryContext) interface{} {
 			args = v.VisitExprList(argsCtx)
 		}
 		receiverStyle := primaryCtx.GetLeadingDot() != nil
+		if m, ok := findMacro(funcName, len(args), false); ok && !receiverStyle {
+			return v.expandMacro(primaryCtx, m, nil, args)
+		}
 		if receiverStyle {
 			return ast.NewFunctionCall(ast.NewIdent("."+funcName, false), args)
 		}
 		return ast.NewFunctionCall(ast.NewIdent(funcName, false), args)
 	case *parser.CreateListContext:
-		var elements []ast.ASTNode
+		list := ast.NewList(nil)
 		if elemsCtx := primaryCtx.GetElems(); elemsCtx != nil {
-			elements = v.VisitListInit(elemsCtx)
+			list.Elements, list.OptionalIndices = v.VisitListInit(elemsCtx)
 		}
-		return ast.NewList(elements)
+		return list
 	case *parser.CreateStructContext:
 		var entries []ast.MapEntry
 		if entriesCtx := primaryCtx.GetEntries(); entriesCtx != nil {
@@ -385,6 +483,36 @@ func (v *ASTBuilder) VisitPrimary(ctx parser.IPrimaryContext) interface{} {
 	return nil
 }
 
+func (v *ASTBuilder) expandMacro(ctx antlr.ParserRuleContext, m *Macro, target ast.ASTNode, args []ast.ASTNode) ast.ASTNode {
+	node, err := m.Expander(target, args)
+	if err == nil {
+		return node
+	}
+
+	v.addError(ctx, fmt.Sprintf("invalid macro %s: %s", m.Name, err.Error()))
+
+	// keep building with the unexpanded call, the error is reported by Parse
+	if target != nil {
+		return ast.NewFunctionCall(ast.NewMemberAccess(target, m.Name, false), args)
+	}
+	return ast.NewFunctionCall(ast.NewIdent(m.Name, false), args)
+}
+
+func (v *ASTBuilder) addError(ctx antlr.ParserRuleContext, message string) {
+	if v.issues == nil {
+		v.issues = &Issues{}
+	}
+	start := ctx.GetStart()
+	loc := ruleLocation(ctx)
+	v.issues.Add(&ParseError{
+		Message: message,
+		Line:    start.GetLine(),
+		Column:  start.GetColumn(),
+		Start:   loc.Start,
+		Stop:    loc.Stop,
+	})
+}
+
 func (v *ASTBuilder) VisitLiteral(ctx parser.ILiteralContext) interface{} {
 	// Check specific child Context type
 	switch literalCtx := ctx.(type) {
@@ -471,20 +599,26 @@ func (v *ASTBuilder) VisitExprList(ctx parser.IExprListContext) []ast.ASTNode {
 	return args
 }
 
-func (v *ASTBuilder) VisitListInit(ctx parser.IListInitContext) []ast.ASTNode {
+// VisitListInit returns the elements of a list and the indices of the optional
+// ones
+func (v *ASTBuilder) VisitListInit(ctx parser.IListInitContext) ([]ast.ASTNode, []int) {
 	if ctx == nil {
-		return nil
+		return nil, nil
 	}
 
 	listInitCtx := ctx.(*parser.ListInitContext)
 	var elements []ast.ASTNode
+	var optionalIndices []int
 	for _, elem := range listInitCtx.GetElems() {
 		// Handle optional expressions
 		if optExpr, ok := elem.(*parser.OptExprContext); ok {
+			if optExpr.GetOpt() != nil {
+				optionalIndices = append(optionalIndices, len(elements))
+			}
 			elements = append(elements, v.Visit(optExpr.GetE()).(ast.ASTNode))
 		}
 	}
-	return elements
+	return elements, optionalIndices
 }
 
 func (v *ASTBuilder) VisitMapInitializerList(ctx parser.IMapInitializerListContext) []ast.MapEntry {
@@ -496,19 +630,20 @@ func (v *ASTBuilder) VisitMapInitializerList(ctx parser.IMapInitializerListConte
 	var entries []ast.MapEntry
 	for i, key := range mapInitCtx.GetKeys() {
 		if i < len(mapInitCtx.GetValues()) {
-			keyNode := v.visitOptExpr(key)
+			keyNode, optional := v.visitOptExpr(key)
 			valueNode := v.Visit(mapInitCtx.GetValues()[i]).(ast.ASTNode)
-			entries = append(entries, ast.NewMapEntry(keyNode, valueNode, false))
+			entries = append(entries, ast.NewMapEntry(keyNode, valueNode, optional))
 		}
 	}
 	return entries
 }
 
-func (v *ASTBuilder) visitOptExpr(ctx parser.IOptExprContext) ast.ASTNode {
+// visitOptExpr returns the expression and whether it is marked optional (?e)
+func (v *ASTBuilder) visitOptExpr(ctx parser.IOptExprContext) (ast.ASTNode, bool) {
 	if optExpr, ok := ctx.(*parser.OptExprContext); ok {
-		return v.Visit(optExpr.GetE()).(ast.ASTNode)
+		return v.Visit(optExpr.GetE()).(ast.ASTNode), optExpr.GetOpt() != nil
 	}
-	return nil
+	return nil, false
 }
 
 // VisitFieldInitializerList handles field initialization list
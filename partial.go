@@ -0,0 +1,117 @@
+package sl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/yywing/sl/ast"
+)
+
+// partialState is the state of a partial evaluation, the values of the nodes
+// evaluated once, outside of the steps of comprehensions, are kept to build the
+// residual
+type partialState struct {
+	patterns []string
+	values   map[ast.ASTNode]ast.Value
+	// loops is the number of comprehension steps being evaluated
+	loops int
+}
+
+// isUnknown reports whether the variable or member with the path, e.g.
+// "response.body", is unknown
+func (s *partialState) isUnknown(path string) bool {
+	return s != nil && slices.Contains(s.patterns, path)
+}
+
+func (s *partialState) record(node ast.ASTNode, value ast.Value) {
+	// the steps of comprehensions are evaluated once per element
+	if s == nil || s.loops > 0 {
+		return
+	}
+	s.values[node] = value
+}
+
+func (s *partialState) enterLoop() {
+	if s != nil {
+		s.loops++
+	}
+}
+
+func (s *partialState) exitLoop() {
+	if s != nil {
+		s.loops--
+	}
+}
+
+// PartialRun runs the program with some variables unknown: the declared
+// variables missing from variables, and the variables or members whose paths,
+// like "response.body", are in unknowns. Results depending on them are
+// *ast.UnknownValue, and the residual is the expression left to evaluate once
+// they are known, with the known parts folded, e.g. size(s) + x with s = "abc"
+// and x unknown leaves 3 + x. Known parts of the steps of comprehensions are
+// not folded, they are evaluated once per element.
+func (e *Env) PartialRun(p *Program, variables Variables, unknowns ...string) (ast.Value, ast.ASTNode, error) {
+	for name, value := range variables {
+		if t, exists := p.GetVariable(name); exists && !ast.TypeEquals(t, value.Type()) {
+			return nil, nil, fmt.Errorf("variable %s is not compatible with %s", name, t)
+		}
+	}
+
+	state := &partialState{patterns: unknowns, values: make(map[ast.ASTNode]ast.Value)}
+	runner := NewRunnerContext(context.Background(), e, p, variables, RunOptions{})
+	runner.partial = state
+	value, err := runner.Eval()
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, state.residual(p.ASTNode), nil
+}
+
+func (s *partialState) residual(node ast.ASTNode) ast.ASTNode {
+	// known values that cannot be written as literals, e.g. lists, keep their
+	// expression with the known parts folded
+	if value, evaluated := s.values[node]; evaluated && ast.IsLiteralValue(value) {
+		lit := ast.NewLiteral(value)
+		lit.SetLocation(node.Location())
+		return lit
+	}
+
+	switch n := node.(type) {
+	case *ast.FunctionCallNode:
+		// an operand that does not decide && or || leaves the other one
+		if name, args, ok := resolveCall(n); ok {
+			if absorbing, ok := logicalOperator(name, args); ok {
+				if s.isBool(args[0], !absorbing) {
+					return s.residual(args[1])
+				}
+				if s.isBool(args[1], !absorbing) {
+					return s.residual(args[0])
+				}
+			}
+		}
+	case *ast.ConditionalNode:
+		if s.isBool(n.Condition, true) {
+			return s.residual(n.TrueExpr)
+		}
+		if s.isBool(n.Condition, false) {
+			return s.residual(n.FalseExpr)
+		}
+	}
+
+	children := ast.Children(node)
+	if len(children) == 0 {
+		return node
+	}
+	residuals := make([]ast.ASTNode, len(children))
+	for i, child := range children {
+		residuals[i] = s.residual(child)
+	}
+	return ast.WithChildren(node, residuals)
+}
+
+// isBool reports whether node was evaluated to b
+func (s *partialState) isBool(node ast.ASTNode, b bool) bool {
+	value, ok := s.values[node].(*ast.BoolValue)
+	return ok && value.BoolValue == b
+}
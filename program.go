@@ -2,6 +2,7 @@ package sl
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/yywing/sl/ast"
 )
@@ -9,6 +10,9 @@ import (
 type Program struct {
 	ast.ASTNode
 	variablesType VariablesType
+
+	// set by a successful check
+	cost *ast.CostEstimate
 }
 
 func NewProgram(node ast.ASTNode, variablesType VariablesType) *Program {
@@ -29,11 +33,35 @@ func (e *Program) SetVariable(name string, value ast.ValueType) {
 // GetVariable gets a variable
 func (e *Program) GetVariable(name string) (ast.ValueType, bool) {
 	if value, exists := e.variablesType[name]; exists {
-		return value, true
+		return declaredType(value), true
 	}
 	return nil, false
 }
 
+// GetSize gets the size of a variable, or of a member with a path like
+// "response.body", declared with NewSizedType
+func (e *Program) GetSize(path string) (ast.SizeEstimate, bool) {
+	name, member, isMember := strings.Cut(path, ".")
+	sized, ok := e.variablesType[name].(*SizedType)
+	if !ok {
+		return ast.SizeEstimate{}, false
+	}
+	if !isMember {
+		return sized.size, true
+	}
+	size, exists := sized.members[member]
+	return size, exists
+}
+
+// Cost returns the range of the cost of the program as counted by RunContext,
+// estimated by the last check
+func (e *Program) Cost() (ast.CostEstimate, bool) {
+	if e.cost == nil {
+		return ast.CostEstimate{}, false
+	}
+	return *e.cost, true
+}
+
 // Variables returns all variable names
 func (e *Program) Variables() []string {
 	var names []string
@@ -49,7 +77,7 @@ func (e *Program) CheckVariables(variables Variables) error {
 		if !exists {
 			return fmt.Errorf("variable %s is not defined", k)
 		}
-		if !ast.TypeEquals(v, value.Type()) {
+		if !ast.TypeEquals(declaredType(v), value.Type()) {
 			return fmt.Errorf("variable %s is not compatible with %s", k, v)
 		}
 	}
@@ -1,7 +1,10 @@
 package sl
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/yywing/sl/ast"
 )
@@ -10,17 +13,35 @@ import (
 type RuntimeError struct {
 	Message string
 	Node    ast.ASTNode
+	// Err is the error returned by a function call, if any
+	Err error
 }
 
 func (e *RuntimeError) Error() string {
 	return fmt.Sprintf("runtime error: %s", e.Message)
 }
 
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RuntimeError) Location() ast.Location {
+	if e.Node == nil {
+		return ast.NoLocation
+	}
+	return e.Node.Location()
+}
+
 // Runner implements expression evaluation
 type Runner struct {
 	env       *Env
 	program   *Program
 	variables Variables
+	locals    *scope[ast.Value]
+	// partial is set by Env.PartialRun
+	partial *partialState
+
+	budget
 }
 
 // NewRunner creates a new evaluator
@@ -28,17 +49,36 @@ func NewRunner(env *Env, program *Program, variables Variables) *Runner {
 	return &Runner{env: env, program: program, variables: variables}
 }
 
+// NewRunnerContext creates a new evaluator that stops when ctx is done or the
+// cost limit in opts is exceeded
+func NewRunnerContext(ctx context.Context, env *Env, program *Program, variables Variables, opts RunOptions) *Runner {
+	runner := NewRunner(env, program, variables)
+	runner.budget = budget{ctx: ctx, limit: opts.CostLimit}
+	return runner
+}
+
 // Eval evaluates the expression
 func (runner *Runner) Eval() (ast.Value, error) {
 	return runner.eval(runner.program.ASTNode)
 }
 
+// Cost returns the cost of the evaluation so far, function costs are only
+// counted with a cost limit
+func (runner *Runner) Cost() uint64 {
+	return runner.cost
+}
+
 func (runner *Runner) eval(node ast.ASTNode) (ast.Value, error) {
+	if err := runner.add(node, 1); err != nil {
+		return nil, err
+	}
+
 	result, err := node.Accept(runner)
 	if err != nil {
 		return nil, err
 	}
 	if value, ok := result.(ast.Value); ok {
+		runner.partial.record(node, value)
 		return value, nil
 	}
 	return nil, fmt.Errorf("internal error: Runner returned non-value")
@@ -49,39 +89,93 @@ func (runner *Runner) VisitLiteral(node *ast.LiteralNode) (interface{}, error) {
 }
 
 func (runner *Runner) VisitIdent(node *ast.IdentNode) (interface{}, error) {
+	if value, exists := runner.locals.lookup(node.Name); exists {
+		return localValue(value)
+	}
+
+	if runner.partial.isUnknown(node.Name) {
+		return ast.NewUnknownValue(node.Name), nil
+	}
+
 	if value, exists := runner.variables[node.Name]; exists {
 		return value, nil
 	}
 
+	// a declared variable that is not set is unknown in a partial evaluation
+	if _, declared := runner.program.GetVariable(node.Name); declared && runner.partial != nil {
+		return ast.NewUnknownValue(node.Name), nil
+	}
+
 	return nil, &RuntimeError{
 		Message: fmt.Sprintf("undefined identifier: %s", node.Name),
 		Node:    node,
 	}
 }
 
+// isVariable reports whether name is a local, a set or a declared variable
+func (runner *Runner) isVariable(name string) bool {
+	if _, exists := runner.locals.lookup(name); exists {
+		return true
+	}
+	if _, exists := runner.variables[name]; exists {
+		return true
+	}
+	_, exists := runner.program.GetVariable(name)
+	return exists
+}
+
 func (runner *Runner) VisitMemberAccess(node *ast.MemberAccessNode) (interface{}, error) {
+	if path, ok := qualifiedName(node); ok && runner.partial.isUnknown(path) {
+		// locals are not program variables
+		root, _, _ := strings.Cut(path, ".")
+		if _, isLocal := runner.locals.lookup(root); !isLocal {
+			return ast.NewUnknownValue(path), nil
+		}
+	}
+
 	object, err := runner.eval(node.Object)
 	if err != nil {
 		return nil, err
 	}
+	return selectMember(node, object)
+}
+
+func selectMember(node *ast.MemberAccessNode, object ast.Value) (ast.Value, error) {
+	if u, ok := object.(*ast.UnknownValue); ok {
+		return u, nil
+	}
+
+	// selecting from an optional value gives an optional value, like obj.?member
+	optional := node.Optional
+	if o, ok := object.(*ast.OptionalValue); ok {
+		if !o.HasValue() {
+			return o, nil
+		}
+		object, optional = o.Value, true
+	}
 
 	switch obj := object.(type) {
 	case ast.Selector:
-		if value, exists := obj.Get(ast.NewStringValue(node.Member)); exists {
-			return value, nil
+		key := ast.NewStringValue(node.Member)
+		value, exists := obj.Get(key)
+		if optional {
+			// an unset field is absent
+			if tester, ok := obj.(ast.FieldTester); ok && exists {
+				exists = tester.Has(key)
+			}
+			if !exists {
+				return ast.NewOptionalNone(), nil
+			}
+			return ast.NewOptionalValue(value), nil
 		}
-		if node.Optional {
-			return ast.NewNullValue(), nil
+		if exists {
+			return value, nil
 		}
 		return nil, &RuntimeError{
 			Message: fmt.Sprintf("selector does not have member: %s", node.Member),
 			Node:    node,
 		}
 	default:
-		// For other types, simplified handling
-		if node.Optional {
-			return ast.NewNullValue(), nil
-		}
 		return nil, &RuntimeError{
 			Message: fmt.Sprintf("cannot access member %s on type %T", node.Member, object),
 			Node:    node,
@@ -90,22 +184,21 @@ func (runner *Runner) VisitMemberAccess(node *ast.MemberAccessNode) (interface{}
 }
 
 func (runner *Runner) VisitFunctionCall(node *ast.FunctionCallNode) (interface{}, error) {
-	var fnName string
-	var args []ast.ASTNode
-	switch fn := node.Function.(type) {
-	case *ast.IdentNode:
-		fnName = fn.Name
-		args = node.Args
-	case *ast.MemberAccessNode:
-		fnName = fn.Member
-		args = append([]ast.ASTNode{fn.Object}, node.Args...)
-	default:
+	fnName, args, ok := resolveCall(node)
+	if name, namespaced := namespacedFunction(runner.env, node, runner.isVariable); namespaced {
+		fnName, args, ok = name, node.Args, true
+	}
+	if !ok {
 		return nil, &CheckError{
 			Message: fmt.Sprintf("function call must be an identifier or member access, got %s", node.Function.String()),
 			Node:    node,
 		}
 	}
 
+	if absorbing, ok := logicalOperator(fnName, args); ok {
+		return runner.logical(node, args, absorbing)
+	}
+
 	fn, exists := runner.env.GetFunction(fnName)
 	if !exists {
 		return nil, &RuntimeError{
@@ -119,25 +212,104 @@ func (runner *Runner) VisitFunctionCall(node *ast.FunctionCallNode) (interface{}
 	for i, arg := range args {
 		argValue, err := runner.eval(arg)
 		if err != nil {
-			// Special handling for or
-			if fn.Name() == ast.LogicalOr {
-				argValue = ast.NewBoolValue(false)
-			} else {
-				return nil, err
-			}
+			return nil, err
 		}
 		argValues[i] = argValue
 	}
+	// a call with unknown arguments is unknown
+	if u, ok := ast.MergeUnknowns(argValues...); ok {
+		return u, nil
+	}
+
+	if runner.limit > 0 {
+		var cost uint64 = 1
+		if coster, ok := fn.(ast.CallCoster); ok {
+			cost = coster.Cost(argValues)
+		}
+		if err := runner.add(node, cost); err != nil {
+			return nil, err
+		}
+	}
 
 	// Call function
 	result, err := fn.Call(argValues)
 	if err != nil {
-		return nil, err
+		return nil, callError(node, err)
 	}
 
 	return result, nil
 }
 
+// logical evaluates && and ||, the right operand is only evaluated when the left
+// one does not decide the result
+func (runner *Runner) logical(node *ast.FunctionCallNode, args []ast.ASTNode, absorbing bool) (ast.Value, error) {
+	left, leftErr := runner.eval(args[0])
+	if isAbsorbing(left, leftErr, absorbing) {
+		return left, nil
+	}
+	right, rightErr := runner.eval(args[1])
+	if isAbsorbing(right, rightErr, absorbing) {
+		return right, nil
+	}
+	return logicalResult(node, left, right, leftErr, rightErr)
+}
+
+// logicalOperator reports whether a call is && or ||, absorbing is the value of
+// an operand that decides the result alone: false for && and true for ||
+func logicalOperator(name string, args []ast.ASTNode) (absorbing bool, ok bool) {
+	if len(args) != 2 {
+		return false, false
+	}
+	switch name {
+	case ast.LogicalAnd:
+		return false, true
+	case ast.LogicalOr:
+		return true, true
+	}
+	return false, false
+}
+
+func isAbsorbing(value ast.Value, err error, absorbing bool) bool {
+	b, ok := value.(*ast.BoolValue)
+	return err == nil && ok && b.BoolValue == absorbing
+}
+
+// logicalResult is the result of && or || when neither operand decides it.
+// Like CEL, an error of either operand is absorbed by the other operand when
+// that one decides the result, e.g. false && 1/0 > 0 and 1/0 > 0 && false are
+// both false. Otherwise an unknown operand makes the result unknown, and the
+// error of the left operand is returned first.
+func logicalResult(node *ast.FunctionCallNode, left, right ast.Value, leftErr, rightErr error) (ast.Value, error) {
+	// unknowns win over errors, the unknown operand may decide the result
+	if u, ok := ast.MergeUnknowns(left, right); ok {
+		return u, nil
+	}
+	if leftErr != nil {
+		return nil, leftErr
+	}
+	if rightErr != nil {
+		return nil, rightErr
+	}
+	for _, operand := range []ast.Value{left, right} {
+		if _, ok := operand.(*ast.BoolValue); !ok {
+			return nil, &RuntimeError{
+				Message: fmt.Sprintf("no matching overload for %s with %s", callee(node), operand.Type().String()),
+				Node:    node,
+			}
+		}
+	}
+	// both operands are the identity, e.g. true && true
+	return left, nil
+}
+
+func callError(node *ast.FunctionCallNode, err error) error {
+	return &RuntimeError{
+		Message: err.Error(),
+		Node:    node,
+		Err:     err,
+	}
+}
+
 func (runner *Runner) VisitIndex(node *ast.IndexNode) (interface{}, error) {
 	object, err := runner.eval(node.Object)
 	if err != nil {
@@ -149,6 +321,23 @@ func (runner *Runner) VisitIndex(node *ast.IndexNode) (interface{}, error) {
 		return nil, err
 	}
 
+	return indexValue(node, object, index)
+}
+
+func indexValue(node *ast.IndexNode, object, index ast.Value) (ast.Value, error) {
+	if u, ok := ast.MergeUnknowns(object, index); ok {
+		return u, nil
+	}
+
+	// indexing an optional value gives an optional value, like obj[?index]
+	optional := node.Optional
+	if o, ok := object.(*ast.OptionalValue); ok {
+		if !o.HasValue() {
+			return o, nil
+		}
+		object, optional = o.Value, true
+	}
+
 	switch obj := object.(type) {
 	case *ast.ListValue:
 		var idx int
@@ -166,22 +355,29 @@ func (runner *Runner) VisitIndex(node *ast.IndexNode) (interface{}, error) {
 
 		values := obj.ListValue
 		if idx < 0 || idx >= len(values) {
-			if node.Optional {
-				return ast.NewNullValue(), nil
+			if optional {
+				return ast.NewOptionalNone(), nil
 			}
 			return nil, &RuntimeError{
 				Message: fmt.Sprintf("list index out of range: %d", idx),
 				Node:    node,
 			}
 		}
+		if optional {
+			return ast.NewOptionalValue(values[idx]), nil
+		}
 		return values[idx], nil
 
-	case *ast.MapValue:
-		if value, exists := obj.Get(index); exists {
-			return value, nil
+	case ast.Keyed:
+		value, exists := obj.Get(index)
+		if optional {
+			if !exists {
+				return ast.NewOptionalNone(), nil
+			}
+			return ast.NewOptionalValue(value), nil
 		}
-		if node.Optional {
-			return ast.NewNullValue(), nil
+		if exists {
+			return value, nil
 		}
 		return nil, &RuntimeError{
 			Message: fmt.Sprintf("map does not have key: %s", index.String()),
@@ -201,33 +397,81 @@ func (runner *Runner) VisitConditional(node *ast.ConditionalNode) (interface{},
 	if err != nil {
 		return nil, err
 	}
+	if u, ok := condition.(*ast.UnknownValue); ok {
+		return u, nil
+	}
 
-	result, ok := condition.(*ast.BoolValue)
-	if !ok {
-		return nil, &RuntimeError{
-			Message: fmt.Sprintf("condition must be boolean, got %T", condition),
-			Node:    node,
-		}
+	result, err := conditionValue(node, condition)
+	if err != nil {
+		return nil, err
 	}
 
-	if result.BoolValue {
+	if result {
 		return runner.eval(node.TrueExpr)
 	} else {
 		return runner.eval(node.FalseExpr)
 	}
 }
 
+func conditionValue(node *ast.ConditionalNode, condition ast.Value) (bool, error) {
+	result, ok := condition.(*ast.BoolValue)
+	if !ok {
+		return false, &RuntimeError{
+			Message: fmt.Sprintf("condition must be boolean, got %T", condition),
+			Node:    node,
+		}
+	}
+	return result.BoolValue, nil
+}
+
 func (runner *Runner) VisitList(node *ast.ListNode) (interface{}, error) {
 	values := make([]ast.Value, len(node.Elements))
-	var elementType ast.ValueType = ast.AnyType
-
 	for i, elem := range node.Elements {
 		value, err := runner.eval(elem)
 		if err != nil {
 			return nil, err
 		}
 		values[i] = value
+	}
+	return newListValue(node, values)
+}
 
+// optionalEntry returns the value of an optional list element, map entry or
+// struct field, and whether it is present
+func optionalEntry(node ast.ASTNode, value ast.Value) (ast.Value, bool, error) {
+	o, ok := value.(*ast.OptionalValue)
+	if !ok {
+		return nil, false, &RuntimeError{
+			Message: fmt.Sprintf("optional entry requires an optional value, got %s", value.Type().String()),
+			Node:    node,
+		}
+	}
+	return o.Value, o.HasValue(), nil
+}
+
+func newListValue(node *ast.ListNode, elements []ast.Value) (ast.Value, error) {
+	if u, ok := ast.MergeUnknowns(elements...); ok {
+		return u, nil
+	}
+
+	values := make([]ast.Value, 0, len(elements))
+	for i, value := range elements {
+		if node.IsOptional(i) {
+			var present bool
+			var err error
+			value, present, err = optionalEntry(node.Elements[i], value)
+			if err != nil {
+				return nil, err
+			}
+			if !present {
+				continue
+			}
+		}
+		values = append(values, value)
+	}
+
+	var elementType ast.ValueType = ast.AnyType
+	for i, value := range values {
 		if i == 0 {
 			elementType = value.Type()
 		}
@@ -236,15 +480,12 @@ func (runner *Runner) VisitList(node *ast.ListNode) (interface{}, error) {
 			elementType = ast.AnyType
 		}
 	}
-
 	return ast.NewListValue(values, elementType), nil
 }
 
 func (runner *Runner) VisitMap(node *ast.MapNode) (interface{}, error) {
-	values := make(map[ast.Value]ast.Value)
-	var keyType, valueType ast.ValueType = ast.AnyType, ast.AnyType
-	keys := []ast.Value{}
-
+	keys := make([]ast.Value, len(node.Entries))
+	values := make([]ast.Value, len(node.Entries))
 	for i, entry := range node.Entries {
 		key, err := runner.eval(entry.Key)
 		if err != nil {
@@ -255,8 +496,21 @@ func (runner *Runner) VisitMap(node *ast.MapNode) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
+		keys[i], values[i] = key, value
+	}
+	return newMapValue(node, keys, values)
+}
+
+func newMapValue(node *ast.MapNode, keys, values []ast.Value) (ast.Value, error) {
+	if u, ok := ast.MergeUnknowns(append(slices.Clip(keys), values...)...); ok {
+		return u, nil
+	}
+
+	result := make(map[ast.Value]ast.Value, len(keys))
+	var keyType, valueType ast.ValueType = ast.AnyType, ast.AnyType
 
-		for _, j := range keys {
+	for i, key := range keys {
+		for _, j := range keys[:i] {
 			if j.Equal(key) {
 				return nil, &RuntimeError{
 					Message: fmt.Sprintf("map has repeated key: %s", key.String()),
@@ -265,13 +519,24 @@ func (runner *Runner) VisitMap(node *ast.MapNode) (interface{}, error) {
 			}
 		}
 
-		keys = append(keys, key)
-		values[key] = value
+		value := values[i]
+		if node.Entries[i].Optional {
+			var present bool
+			var err error
+			value, present, err = optionalEntry(node.Entries[i].Value, value)
+			if err != nil {
+				return nil, err
+			}
+			if !present {
+				continue
+			}
+		}
 
-		if i == 0 {
+		if len(result) == 0 {
 			keyType = key.Type()
 			valueType = value.Type()
 		}
+		result[key] = value
 
 		if !key.Type().Equals(keyType) {
 			keyType = ast.AnyType
@@ -281,25 +546,231 @@ func (runner *Runner) VisitMap(node *ast.MapNode) (interface{}, error) {
 		}
 	}
 
-	return ast.NewMapValue(values, keyType, valueType), nil
+	return ast.NewMapValue(result, keyType, valueType), nil
 }
 
-// TODO:
 func (runner *Runner) VisitStruct(node *ast.StructNode) (interface{}, error) {
-	// // Create a map to represent struct instance
-	// values := make(map[string]ast.Value)
-
-	// // Evaluate all fields
-	// for _, field := range node.Fields {
-	// 	value, err := runner.eval(field.Value)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	values[field.Name] = value
-	// }
-
-	// // Return a map value to represent struct instance
-	// // In a more complete implementation, a dedicated StructValue type may be needed
-	// return ast.NewMapValue(values, ast.StringType, ast.StringType), nil
-	return nil, fmt.Errorf("not implemented")
+	structType, ok := runner.env.GetType(node.TypeName)
+	if !ok {
+		return nil, &RuntimeError{
+			Message: fmt.Sprintf("undefined type: %s", node.TypeName),
+			Node:    node,
+		}
+	}
+
+	values := make([]ast.Value, len(node.Fields))
+	for i, field := range node.Fields {
+		value, err := runner.eval(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return newStructValue(node, structType, values)
+}
+
+func newStructValue(node *ast.StructNode, structType ast.StructType, values []ast.Value) (ast.Value, error) {
+	if u, ok := ast.MergeUnknowns(values...); ok {
+		return u, nil
+	}
+
+	fields := make(map[string]ast.Value, len(values))
+	for i, field := range node.Fields {
+		value := values[i]
+		if field.Optional {
+			var present bool
+			var err error
+			value, present, err = optionalEntry(field.Value, value)
+			if err != nil {
+				return nil, err
+			}
+			if !present {
+				continue
+			}
+		}
+		fields[field.Name] = value
+	}
+
+	value, err := structType.NewValue(fields)
+	if err != nil {
+		return nil, &RuntimeError{
+			Message: err.Error(),
+			Node:    node,
+		}
+	}
+	return value, nil
+}
+
+func (runner *Runner) VisitComprehension(node *ast.ComprehensionNode) (interface{}, error) {
+	iterRange, err := runner.eval(node.IterRange)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := iterRange.(*ast.UnknownValue); ok {
+		return u, nil
+	}
+
+	items, err := rangeItems(node, iterRange)
+	if err != nil {
+		return nil, err
+	}
+
+	accu, err := runner.eval(node.AccuInit)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := runner.locals
+	defer func() { runner.locals = outer }()
+
+	accu, err = runner.loop(node, items, accu)
+	if err != nil {
+		return nil, err
+	}
+
+	runner.locals = outer.push(node.AccuVar, accu)
+	return runner.eval(node.Result)
+}
+
+// loop evaluates the steps of a comprehension over items and returns the
+// accumulator
+func (runner *Runner) loop(node *ast.ComprehensionNode, items []ast.Value, accu ast.Value) (ast.Value, error) {
+	runner.partial.enterLoop()
+	defer runner.partial.exitLoop()
+
+	outer := runner.locals
+	for _, item := range items {
+		runner.locals = outer.push(node.AccuVar, accu).push(node.IterVar, item)
+
+		condition, err := runner.eval(node.LoopCondition)
+		ok, err := loopCondition(node, condition, err)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		accu, err = loopStep(runner.eval(node.LoopStep))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return accu, nil
+}
+
+// rangeItems returns the elements of a list or the keys of a map
+func rangeItems(node *ast.ComprehensionNode, iterRange ast.Value) ([]ast.Value, error) {
+	switch r := iterRange.(type) {
+	case *ast.ListValue:
+		return r.ListValue, nil
+	case ast.Keyed:
+		return r.Keys(), nil
+	default:
+		return nil, &RuntimeError{
+			Message: fmt.Sprintf("cannot iterate over type %T", iterRange),
+			Node:    node,
+		}
+	}
+}
+
+func loopCondition(node *ast.ComprehensionNode, condition ast.Value, err error) (bool, error) {
+	// like CEL, an error or an unknown condition does not stop the loop, a later
+	// step may still decide the result, e.g. exists finding a match after them
+	if err != nil {
+		if isBudgetError(err) {
+			return false, err
+		}
+		return true, nil
+	}
+	if _, ok := condition.(*ast.UnknownValue); ok {
+		return true, nil
+	}
+	result, ok := condition.(*ast.BoolValue)
+	if !ok {
+		return false, &RuntimeError{
+			Message: fmt.Sprintf("loop condition must be boolean, got %T", condition),
+			Node:    node,
+		}
+	}
+	return result.BoolValue, nil
+}
+
+// errorValue is the accumulator of a comprehension after a step failed, the
+// error is returned when the accumulator is read so that a later step may still
+// absorb it, e.g. [0, 1].exists(e, 1 / e == 1) is true
+type errorValue struct {
+	err error
+}
+
+func (v *errorValue) Type() ast.ValueType { return ast.AnyType }
+
+func (v *errorValue) Equal(other ast.Value) bool { return false }
+
+func (v *errorValue) String() string { return v.err.Error() }
+
+// loopStep keeps the error of a failed step in the accumulator
+func loopStep(accu ast.Value, err error) (ast.Value, error) {
+	if err != nil && !isBudgetError(err) {
+		return &errorValue{err: err}, nil
+	}
+	return accu, err
+}
+
+// localValue returns the value of a local, or the error of a failed
+// accumulator
+func localValue(value ast.Value) (ast.Value, error) {
+	if v, ok := value.(*errorValue); ok {
+		return nil, v.err
+	}
+	return value, nil
+}
+
+func (runner *Runner) VisitBind(node *ast.BindNode) (interface{}, error) {
+	value, err := runner.eval(node.Init)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := runner.locals
+	defer func() { runner.locals = outer }()
+
+	runner.locals = outer.push(node.Name, value)
+	return runner.eval(node.Result)
+}
+
+func (runner *Runner) VisitPresenceTest(node *ast.PresenceTestNode) (interface{}, error) {
+	object, err := runner.eval(node.Object)
+	if err != nil {
+		return nil, err
+	}
+	return testPresence(node, object)
+}
+
+func testPresence(node *ast.PresenceTestNode, object ast.Value) (ast.Value, error) {
+	if u, ok := object.(*ast.UnknownValue); ok {
+		return u, nil
+	}
+
+	// an absent optional value has no members
+	if o, ok := object.(*ast.OptionalValue); ok {
+		if !o.HasValue() {
+			return ast.NewBoolValue(false), nil
+		}
+		object = o.Value
+	}
+
+	key := ast.NewStringValue(node.Member)
+	switch obj := object.(type) {
+	case ast.FieldTester:
+		return ast.NewBoolValue(obj.Has(key)), nil
+	case ast.Selector:
+		_, exists := obj.Get(key)
+		return ast.NewBoolValue(exists), nil
+	default:
+		return nil, &RuntimeError{
+			Message: fmt.Sprintf("cannot test presence of member %s on type %T", node.Member, object),
+			Node:    node,
+		}
+	}
 }
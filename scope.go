@@ -0,0 +1,24 @@
+package sl
+
+// scope is a linked list of local variables, such as the iteration variable and
+// accumulator of comprehensions. A nil scope is empty.
+type scope[T any] struct {
+	parent *scope[T]
+	name   string
+	value  T
+}
+
+// push returns a new scope with name bound to value, shadowing outer bindings
+func (s *scope[T]) push(name string, value T) *scope[T] {
+	return &scope[T]{parent: s, name: name, value: value}
+}
+
+func (s *scope[T]) lookup(name string) (T, bool) {
+	for c := s; c != nil; c = c.parent {
+		if c.name == name {
+			return c.value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
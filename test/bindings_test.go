@@ -0,0 +1,98 @@
+package test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+func TestBindings(t *testing.T) {
+
+	tests := []string{
+		"testdata/bindings_ext.textproto",
+	}
+	skipTests := []string{}
+
+	files := LoadTestFile(tests)
+	for _, file := range files {
+		for _, section := range file.GetSection() {
+			for _, testCase := range section.GetTest() {
+				name := fmt.Sprintf("%s/%s/%s", file.GetName(), section.GetName(), testCase.GetName())
+
+				if slices.Contains(skipTests, name) {
+					continue
+				}
+
+				if err := RunTestCase(testCase); err != nil {
+					t.Errorf("RunTestCase(%q) error: %v", name, err)
+				}
+			}
+		}
+	}
+
+}
+
+func TestBind(t *testing.T) {
+	env := sl.NewStdEnv()
+	vars := sl.Variables{
+		"x": ast.NewIntValue(3),
+	}
+
+	tests := []struct {
+		expr string
+		want ast.Value
+	}{
+		{expr: `bind(y, x * 2, y + y)`, want: ast.NewIntValue(12)},
+		// the local shadows the variable in its scope only
+		{expr: `bind(x, x + 1, x * 2) + x`, want: ast.NewIntValue(11)},
+		{expr: `bind(x, "a", x + x)`, want: ast.NewStringValue("aa")},
+		{expr: `bind(a, 1, bind(a, a + 1, a))`, want: ast.NewIntValue(2)},
+		{expr: `bind(l, [1, 2], l.map(x, x + l.size()))`, want: ast.NewListValue([]ast.Value{ast.NewIntValue(3), ast.NewIntValue(4)}, ast.IntType)},
+		{expr: `[1, 2].map(i, bind(j, i * x, j + 1))[1]`, want: ast.NewIntValue(7)},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", tt.expr, err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+		if _, err := env.Check(program); err != nil {
+			t.Fatalf("Check(%q) error: %v", tt.expr, err)
+		}
+
+		got, err := env.Run(program, vars)
+		if err != nil {
+			t.Errorf("Run(%q) error: %v", tt.expr, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("Run(%q): got %v, want %v", tt.expr, got, tt.want)
+		}
+
+		compiled, err := env.Compile(program)
+		if err != nil {
+			t.Fatalf("Compile(%q) error: %v", tt.expr, err)
+		}
+		got, err = compiled.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.expr, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("Eval(%q): got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{`bind(a.b, 1, 2)`, `bind(.a, 1, a)`} {
+		if _, err := sl.Parse(expr); err == nil {
+			t.Errorf("Parse(%q): want error", expr)
+		}
+	}
+	node, err := sl.Parse(`bind(y, "a", y + 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Check(sl.NewProgram(node, vars.Type())); err == nil {
+		t.Errorf("Check(bind(y, \"a\", y + 1)): want error")
+	}
+}
@@ -0,0 +1,250 @@
+package test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/codec"
+	"github.com/yywing/sl/lib/types"
+	"github.com/yywing/sl/optimizer"
+)
+
+var codecs = []struct {
+	name      string
+	marshal   func(*codec.CheckedAST) ([]byte, error)
+	unmarshal func([]byte) (*codec.CheckedAST, error)
+}{
+	{"json", codec.MarshalJSON, codec.UnmarshalJSON},
+	{"binary", codec.MarshalBinary, codec.UnmarshalBinary},
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	env := sl.NewStdEnv()
+	vars := sl.Variables{
+		"x": ast.NewIntValue(3),
+		"s": ast.NewStringValue("abc"),
+		"m": ast.NewMapValue(map[ast.Value]ast.Value{ast.NewStringValue("a"): ast.NewIntValue(1)}, ast.StringType, ast.IntType),
+	}
+
+	tests := []string{
+		`x + 1 > 2 && s.startsWith("a")`,
+		`-x < 0 ? "neg" : 'pos\n'`,
+		`[1, 2, 3].map(y, y * x).filter(y, y > 3)`,
+		`{"a": 1u, "b": 2u}["a"] == 1u`,
+		`has(m.a) || .x == 1`,
+		`b"\x00\xff".size() == 2 && 1.5e3 > 1e-3 && null == null`,
+		`type(x) == type(1) && duration("1s") < duration("1m")`,
+		`[1, 2].exists(y, y == x) || s.matches("^a+$")`,
+		`[?m.?b, ?optional.of(x)] == [x] && {?"a": m[?"a"]}.a == m.?a.orValue(0)`,
+		`bind(y, x * 2, [y, y + 1].exists(z, z == bind(x, 7, x)))`,
+	}
+
+	for _, expr := range tests {
+		node, err := sl.Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", expr, err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+		checked, err := codec.Check(env, program)
+		if err != nil {
+			t.Fatalf("Check(%q) error: %v", expr, err)
+		}
+		want, wantErr := env.Run(program, vars)
+
+		for _, c := range codecs {
+			data, err := c.marshal(checked)
+			if err != nil {
+				t.Fatalf("%s: Marshal(%q) error: %v", c.name, expr, err)
+			}
+			decoded, err := c.unmarshal(data)
+			if err != nil {
+				t.Fatalf("%s: Unmarshal(%q) error: %v", c.name, expr, err)
+			}
+			compareChecked(t, c.name+": "+expr, checked, node, decoded, decoded.Root)
+
+			got, gotErr := env.Run(sl.NewProgram(decoded.Root, vars.Type()), vars)
+			if (wantErr != nil) != (gotErr != nil) || (wantErr == nil && !got.Equal(want)) {
+				t.Errorf("%s: Run(%q): got %v, %v, want %v, %v", c.name, expr, got, gotErr, want, wantErr)
+			}
+		}
+	}
+}
+
+// compareChecked compares the nodes, locations and types of two checked ASTs
+func compareChecked(t *testing.T, name string, want *codec.CheckedAST, wantNode ast.ASTNode, got *codec.CheckedAST, gotNode ast.ASTNode) {
+	t.Helper()
+	if gotNode.String() != wantNode.String() {
+		t.Errorf("%s: got node %s, want %s", name, gotNode, wantNode)
+		return
+	}
+	if gotNode.Location() != wantNode.Location() {
+		t.Errorf("%s: %s: got location %v, want %v", name, wantNode, gotNode.Location(), wantNode.Location())
+	}
+	wantType, wantOk := want.TypeOf(wantNode)
+	gotType, gotOk := got.TypeOf(gotNode)
+	if wantOk != gotOk || (wantOk && gotType.String() != wantType.String()) {
+		t.Errorf("%s: %s: got type %v, want %v", name, wantNode, gotType, wantType)
+	}
+
+	wantChildren, gotChildren := ast.Children(wantNode), ast.Children(gotNode)
+	for i := range wantChildren {
+		compareChecked(t, name, want, wantChildren[i], got, gotChildren[i])
+	}
+}
+
+func TestCodecValues(t *testing.T) {
+	regex, err := types.NewRegexValue("a+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []ast.Value{
+		ast.NewBoolValue(true),
+		ast.NewIntValue(math.MinInt64),
+		ast.NewUintValue(math.MaxUint64),
+		ast.NewDoubleValue(0.1),
+		ast.NewDoubleValue(math.Inf(-1)),
+		ast.NewStringValue("a\"\n✓"),
+		ast.NewBytesValue([]byte{0, 0xff}),
+		ast.NewNullValue(),
+		ast.NewTypeValue("int"),
+		ast.NewListValue([]ast.Value{ast.NewIntValue(1), ast.NewIntValue(2)}, ast.IntType),
+		ast.NewMapValue(map[ast.Value]ast.Value{
+			ast.NewStringValue("b"): ast.NewListValue(nil, ast.StringType),
+			ast.NewStringValue("a"): ast.NewListValue([]ast.Value{ast.NewStringValue("x")}, ast.StringType),
+		}, ast.StringType, ast.NewListType(ast.StringType)),
+		types.NewTimestampValue(1700000000, 5, "Asia/Shanghai"),
+		types.NewDurationValue(-1500),
+		types.NewXMLValue("<a>b</a>"),
+		regex,
+	}
+
+	for _, v := range values {
+		checked := &codec.CheckedAST{Root: ast.NewLiteral(v)}
+		for _, c := range codecs {
+			data, err := c.marshal(checked)
+			if err != nil {
+				t.Fatalf("%s: Marshal(%v) error: %v", c.name, v, err)
+			}
+			// map entries are sorted, the encoding is stable
+			again, _ := c.marshal(checked)
+			if string(again) != string(data) {
+				t.Errorf("%s: Marshal(%v) is not stable", c.name, v)
+			}
+
+			decoded, err := c.unmarshal(data)
+			if err != nil {
+				t.Fatalf("%s: Unmarshal(%v) error: %v", c.name, v, err)
+			}
+			got := decoded.Root.(*ast.LiteralNode).Value
+			if !got.Equal(v) || !got.Type().Equals(v.Type()) {
+				t.Errorf("%s: got %v (%s), want %v (%s)", c.name, got, got.Type(), v, v.Type())
+			}
+		}
+	}
+}
+
+func TestCodecOptimized(t *testing.T) {
+	env := sl.NewStdEnv()
+	node, err := sl.Parse(`s.matches("^a" + "+$")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimized := optimizer.New(env).Optimize(node)
+
+	data, err := codec.MarshalBinary(&codec.CheckedAST{Root: optimized})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := sl.Variables{"s": ast.NewStringValue("aa")}
+	got, err := env.Run(sl.NewProgram(decoded.Root, vars.Type()), vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(ast.NewBoolValue(true)) {
+		t.Errorf("Run(): got %v, want true", got)
+	}
+}
+
+// types set on the env are decoded once registered with the codec
+func TestCodecEnvTypes(t *testing.T) {
+	env := sl.NewStdEnv()
+	finding := ast.NewSchemaType("CodecFinding", map[string]ast.ValueType{"a": ast.IntType})
+	env.SetType("CodecFinding", finding)
+
+	node, err := sl.Parse(`CodecFinding{a: 1}.a == 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := sl.NewProgram(node, nil)
+	checked, err := codec.Check(env, program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range codecs {
+		data, err := c.marshal(checked)
+		if err != nil {
+			t.Fatalf("%s: Marshal error: %v", c.name, err)
+		}
+		if _, err := c.unmarshal(data); err == nil || !strings.Contains(err.Error(), "CodecFinding") {
+			t.Errorf("%s: Unmarshal before RegisterType: got %v, want unknown type error", c.name, err)
+		}
+	}
+
+	codec.RegisterType(finding)
+	for _, c := range codecs {
+		data, err := c.marshal(checked)
+		if err != nil {
+			t.Fatalf("%s: Marshal error: %v", c.name, err)
+		}
+		decoded, err := c.unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal error: %v", c.name, err)
+		}
+		compareChecked(t, c.name, checked, node, decoded, decoded.Root)
+		got, err := env.Run(sl.NewProgram(decoded.Root, nil), nil)
+		if err != nil || !got.Equal(ast.NewBoolValue(true)) {
+			t.Errorf("%s: Run(decoded): got %v, %v, want true", c.name, got, err)
+		}
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	node, err := sl.Parse(`x + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := &codec.CheckedAST{Root: node}
+
+	data, err := codec.MarshalJSON(checked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.UnmarshalJSON([]byte(strings.Replace(string(data), `"version":1`, `"version":2`, 1))); err == nil {
+		t.Errorf("UnmarshalJSON(version 2): want error")
+	}
+
+	data, err = codec.MarshalBinary(checked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(data); i++ {
+		if _, err := codec.UnmarshalBinary(data[:i]); err == nil {
+			t.Errorf("UnmarshalBinary(%d of %d bytes): want error", i, len(data))
+		}
+	}
+	if _, err := codec.UnmarshalBinary(append(data, 0)); err == nil {
+		t.Errorf("UnmarshalBinary(trailing byte): want error")
+	}
+
+	if _, err := codec.MarshalJSON(&codec.CheckedAST{Root: ast.NewLiteral(types.NewURL("http://a"))}); err == nil {
+		t.Errorf("MarshalJSON(url literal): want error")
+	}
+}
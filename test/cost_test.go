@@ -0,0 +1,137 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+func TestRunContextCostLimit(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	tests := []struct {
+		expr      string
+		limit     uint64
+		wantLimit bool
+	}{
+		{expr: "1 + 2", limit: 10},
+		{expr: "1 + 2", limit: 2, wantLimit: true},
+		{expr: "[1, 2, 3].all(x, x > 0)", limit: 100},
+		{expr: "[1, 2, 3].all(x, x > 0)", limit: 10, wantLimit: true},
+		{expr: "s.matches('a+b')", limit: 10, wantLimit: true},
+		{expr: "s.matches('a+b')", limit: 0},
+		// the right operand is not evaluated when the left one decides
+		{expr: "true || s.matches('a+b')", limit: 3},
+		{expr: "false && [1, 2, 3].all(x, x > 0)", limit: 3},
+		{expr: "s.matches('a+b') || true", limit: 10, wantLimit: true},
+	}
+
+	vars := sl.Variables{"s": ast.NewStringValue("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaab")}
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+
+		_, err = env.RunContext(context.Background(), program, vars, sl.RunOptions{CostLimit: tt.limit})
+		var costErr *sl.CostLimitError
+		if got := errors.As(err, &costErr); got != tt.wantLimit {
+			t.Errorf("RunContext(%q, %d) error: %v", tt.expr, tt.limit, err)
+		}
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	node, err := sl.Parse("[1, 2, 3].map(x, x * 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := sl.NewProgram(node, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := env.RunContext(ctx, program, nil, sl.RunOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunContext() error: %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCheckCost(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	stringMap := ast.NewMapType(ast.StringType, ast.StringType)
+	tests := []struct {
+		expr  string
+		types sl.VariablesType
+	}{
+		{expr: "1 + 2"},
+		{expr: "s.matches('a+b')", types: sl.VariablesType{"s": sl.NewSizedType(ast.StringType, ast.SizeEstimate{Min: 0, Max: 64})}},
+		{expr: "l.all(x, x > 0)", types: sl.VariablesType{"l": sl.NewSizedType(ast.NewListType(ast.IntType), ast.SizeEstimate{Min: 0, Max: 5})}},
+		{expr: "l.map(x, x * 2).filter(x, x > 2)", types: sl.VariablesType{"l": sl.NewSizedType(ast.NewListType(ast.IntType), ast.SizeEstimate{Min: 3, Max: 3})}},
+		{expr: "m.a.contains('b') ? s + s : s", types: sl.VariablesType{
+			"s": sl.NewSizedType(ast.StringType, ast.SizeEstimate{Min: 0, Max: 64}),
+			"m": sl.NewSizedType(stringMap, ast.UnknownSize).WithMemberSize("a", ast.SizeEstimate{Min: 0, Max: 8}),
+		}},
+		{expr: "s.size() > 64 && s.matches('a+b')", types: sl.VariablesType{"s": sl.NewSizedType(ast.StringType, ast.SizeEstimate{Min: 0, Max: 64})}},
+		{expr: "l.size() == 3 || l.all(x, x > 0)", types: sl.VariablesType{"l": sl.NewSizedType(ast.NewListType(ast.IntType), ast.SizeEstimate{Min: 0, Max: 5})}},
+	}
+
+	vars := sl.Variables{
+		"s": ast.NewStringValue("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaab"),
+		"l": ast.NewListValue([]ast.Value{ast.NewIntValue(1), ast.NewIntValue(2), ast.NewIntValue(3)}, ast.IntType),
+		"m": ast.NewMapValue(map[ast.Value]ast.Value{ast.NewStringValue("a"): ast.NewStringValue("abc")}, ast.StringType, ast.StringType),
+	}
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types := vars.Type()
+		for name, typ := range tt.types {
+			types[name] = typ
+		}
+		program := sl.NewProgram(node, types)
+
+		if _, err := env.Check(program); err != nil {
+			t.Fatalf("Check(%q) error: %v", tt.expr, err)
+		}
+		estimate, ok := program.Cost()
+		if !ok {
+			t.Fatalf("Check(%q) did not estimate the cost", tt.expr)
+		}
+
+		if err := program.CheckVariables(vars); err != nil {
+			t.Fatalf("CheckVariables(%q) error: %v", tt.expr, err)
+		}
+		runner := sl.NewRunnerContext(context.Background(), env, program, vars, sl.RunOptions{CostLimit: math.MaxUint64})
+		if _, err := runner.Eval(); err != nil {
+			t.Fatalf("Eval(%q) error: %v", tt.expr, err)
+		}
+		if cost := runner.Cost(); cost < estimate.Min || cost > estimate.Max {
+			t.Errorf("Cost(%q) = %v, actual cost %d", tt.expr, estimate, cost)
+		}
+	}
+}
+
+func TestCheckCostUnknownSize(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	node, err := sl.Parse("s.matches('a+b')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := sl.NewProgram(node, sl.VariablesType{"s": ast.StringType})
+	if _, err := env.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	if estimate, _ := program.Cost(); estimate.Max != math.MaxUint64 {
+		t.Errorf("Cost() = %v, want an unbounded estimate", estimate)
+	}
+}
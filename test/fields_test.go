@@ -35,11 +35,6 @@ func TestFields(t *testing.T) {
 		"fields/map_fields/map_bad_key_type_and_false",
 		"fields/map_fields/map_field_select_no_such_key_or_true",
 		"fields/map_fields/map_field_select_no_such_key_and_false",
-
-		// feature: map has not supported, use new has instead
-		"fields/map_has/has",
-		"fields/map_has/has_not",
-		"fields/map_has/has_empty",
 	}
 
 	files := LoadTestFile(tests)
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/native"
+)
+
+func TestCompile(t *testing.T) {
+	env := sl.NewStdEnv()
+	vars := sl.Variables{
+		"s":    ast.NewStringValue("abc"),
+		"list": ast.NewListValue([]ast.Value{ast.NewIntValue(1), ast.NewStringValue("a")}, ast.AnyType),
+	}
+
+	tests := []struct {
+		expr string
+		want ast.Value
+	}{
+		{expr: "s + 'd'", want: ast.NewStringValue("abcd")},
+		{expr: "s.startsWith('ab') ? 1 : 2", want: ast.NewIntValue(1)},
+		{expr: "[1, 2, 3].map(x, x * 2)[2]", want: ast.NewIntValue(6)},
+		{expr: "[1, 2].exists(x, [3, 4].exists(x, x == 4))", want: ast.NewBoolValue(true)},
+		// elements of list<any> are dispatched on their runtime type
+		{expr: "list[0] + 1 == 2 && list[1] + 'b' == 'ab'", want: ast.NewBoolValue(true)},
+		{expr: "{'a': s}.a", want: ast.NewStringValue("abc")},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+
+		compiled, err := env.Compile(program)
+		if err != nil {
+			t.Fatalf("Compile(%q) error: %v", tt.expr, err)
+		}
+		// evaluate twice, folded constants must not be modified
+		for i := 0; i < 2; i++ {
+			got, err := compiled.Eval(vars)
+			if err != nil {
+				t.Fatalf("Eval(%q) error: %v", tt.expr, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Eval(%q): got %v, want %v", tt.expr, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCompileFolding(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	tests := []struct {
+		expr   string
+		folded bool
+	}{
+		{expr: "'a' + 'b' == 'ab'", folded: true},
+		{expr: "[1, 2, 3].size() > 2 ? 'yes' : 'no'", folded: true},
+		{expr: "{'a': [1]}.a[0]", folded: true},
+		{expr: "base64Encode('abc')", folded: true},
+		// impure functions are not folded
+		{expr: "now() > timestamp('2020-01-01T00:00:00Z')", folded: false},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compiled, err := env.Compile(sl.NewProgram(node, nil))
+		if err != nil {
+			t.Fatalf("Compile(%q) error: %v", tt.expr, err)
+		}
+
+		// a folded program is a single constant which costs 1
+		_, err = compiled.EvalContext(context.Background(), nil, sl.RunOptions{CostLimit: 1})
+		if got := err == nil; got != tt.folded {
+			t.Errorf("Eval(%q) folded: got %t, want %t (%v)", tt.expr, got, tt.folded, err)
+		}
+	}
+}
+
+// functions registered without WithPure may return different results for the
+// same arguments and are called on each evaluation
+func TestCompileRegisteredFunction(t *testing.T) {
+	env := sl.NewStdEnv()
+	var calls int64
+	env.SetFunction("counter", ast.NewBaseFunction("counter", native.MustNewNativeFunction("counter", func(n int64) int64 {
+		calls++
+		return n + calls
+	}).Definitions()))
+
+	node, err := sl.Parse("counter(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := env.Compile(sl.NewProgram(node, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("Compile(counter(0)) called counter %d times", calls)
+	}
+	for i := int64(1); i <= 2; i++ {
+		got, err := compiled.Eval(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(ast.NewIntValue(i)) {
+			t.Errorf("Eval(counter(0)) #%d: got %v, want %d", i, got, i)
+		}
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	env := sl.NewStdEnv()
+	vars := sl.Variables{
+		"status":  ast.NewIntValue(200),
+		"body":    ast.NewStringValue(`{"user": "root", "groups": ["admin", "wheel"]}`),
+		"headers": ast.NewMapValue(map[ast.Value]ast.Value{ast.NewStringValue("Server"): ast.NewStringValue("nginx")}, ast.StringType, ast.StringType),
+	}
+	node, err := sl.Parse(`status == 200 && body.contains("root") && headers["Server"].startsWith("ng") && ["a", "b"].exists(x, x + "dmin" == "admin")`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	program := sl.NewProgram(node, vars.Type())
+	if _, err := env.Check(program); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Runner", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := env.Run(program, vars); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Compiled", func(b *testing.B) {
+		compiled, err := env.Compile(program)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := compiled.Eval(vars); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+func TestParseAll(t *testing.T) {
+	tests := []struct {
+		expr string
+		want int
+	}{
+		{expr: "1 + 2", want: 0},
+		{expr: "1 + # 2 @ )", want: 3},
+		{expr: "[99999999999999999999].all(1, true)", want: 2},
+	}
+
+	for _, tt := range tests {
+		node, issues := sl.ParseAll(tt.expr)
+		if got := issues.Len(); got != tt.want {
+			t.Errorf("ParseAll(%q) issues: got %d, want %d\n%s", tt.expr, got, tt.want, issues.Format(tt.expr))
+		}
+		if (node == nil) != (tt.want > 0) {
+			t.Errorf("ParseAll(%q) node: %v", tt.expr, node)
+		}
+		var parseErr *sl.ParseError
+		if tt.want > 0 && !errors.As(issues.Err(), &parseErr) {
+			t.Errorf("ParseAll(%q) error: %v, want *sl.ParseError", tt.expr, issues.Err())
+		}
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	env := sl.NewStdEnv()
+	vars := sl.Variables{"x": ast.NewIntValue(1)}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "x + 1 == 2", want: nil},
+		{
+			// errors in broken subtrees are only reported once
+			expr: `y.size() > "a" || x + "b" == 1 || (z ? 1 : 2) == foo(x)`,
+			want: []string{
+				"type check error: undefined identifier: y",
+				"type check error: function _+_ not found with args [int string]",
+				"type check error: undefined identifier: z",
+				"type check error: function foo not found",
+			},
+		},
+		{expr: "[1, 2].map(v, v + w)", want: []string{"type check error: undefined identifier: w"}},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+
+		typ, issues := env.CheckAll(program)
+		errs := issues.Errors()
+		if len(errs) != len(tt.want) {
+			t.Errorf("CheckAll(%q): got %v, want %v", tt.expr, errs, tt.want)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != tt.want[i] {
+				t.Errorf("CheckAll(%q) error %d: got %q, want %q", tt.expr, i, err.Error(), tt.want[i])
+			}
+		}
+		if len(tt.want) == 0 && typ != ast.BoolType {
+			t.Errorf("CheckAll(%q) type: got %v, want bool", tt.expr, typ)
+		}
+	}
+}
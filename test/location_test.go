@@ -0,0 +1,101 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+func TestNodeLocation(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "a + b", want: []string{"a + b", "a + b", "a", "b"}},
+		{expr: "(a) && b || c", want: []string{"(a) && b || c", "(a) && b || c", "(a) && b", "(a) && b", "a", "b", "c"}},
+		{expr: "!!x.y", want: []string{"!!x.y", "!!x.y", "!x.y", "!x.y", "x.y", "x"}},
+		{expr: "s.startsWith('a')", want: []string{"s.startsWith('a')", "s.startsWith('a')", "s", "'a'"}},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := []rune(tt.expr)
+		var got []string
+		ast.Walk(node, func(n ast.ASTNode) bool {
+			loc := n.Location()
+			if !loc.IsValid() {
+				t.Errorf("Parse(%q): node %s has no location", tt.expr, n)
+				return false
+			}
+			got = append(got, string(source[loc.Start:loc.Stop]))
+			return true
+		})
+		if len(got) != len(tt.want) {
+			t.Errorf("Parse(%q) locations: got %q, want %q", tt.expr, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Parse(%q) locations: got %q, want %q", tt.expr, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	env := sl.NewStdEnv()
+	vars := sl.Variables{"x": ast.NewIntValue(0)}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{
+			expr: "x == 0 &&\n  y > 1",
+			want: "type check error: undefined identifier: y\n" +
+				"  |\n" +
+				"2 |   y > 1\n" +
+				"  |   ^",
+		},
+		{
+			expr: "1 + (2",
+			want: "parse error at line 1, column 6: missing ')' at '<EOF>'\n" +
+				"  |\n" +
+				"1 | 1 + (2\n" +
+				"  |       ^",
+		},
+		{
+			expr: "x == 0 && 10 / x == 1",
+			want: "runtime error: divide by zero\n" +
+				"  |\n" +
+				"1 | x == 0 && 10 / x == 1\n" +
+				"  |           ^^^^^^",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := func() (ast.Value, error) {
+			node, err := sl.Parse(tt.expr)
+			if err != nil {
+				return nil, err
+			}
+			program := sl.NewProgram(node, vars.Type())
+			if _, err := env.Check(program); err != nil {
+				return nil, err
+			}
+			return env.Run(program, vars)
+		}()
+		if err == nil {
+			t.Errorf("%q: want error", tt.expr)
+			continue
+		}
+		if got := sl.FormatError(tt.expr, err); got != tt.want {
+			t.Errorf("FormatError(%q):\n%s\nwant:\n%s", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -11,19 +11,7 @@ func TestLogic(t *testing.T) {
 	tests := []string{
 		"testdata/logic.textproto",
 	}
-	skipTests := []string{
-		// feature: not return error
-		"logic/OR/error_right",
-		"logic/OR/error_left",
-
-		// wrong type not support
-		"logic/AND/short_circuit_type_left",
-		"logic/AND/short_circuit_type_right",
-		"logic/AND/short_circuit_error_left",
-		"logic/AND/short_circuit_error_right",
-		"logic/OR/short_circuit_type_left",
-		"logic/OR/short_circuit_type_right",
-	}
+	skipTests := []string{}
 
 	files := LoadTestFile(tests)
 	for _, file := range files {
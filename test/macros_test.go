@@ -0,0 +1,151 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+func TestMacros(t *testing.T) {
+
+	tests := []string{
+		"testdata/macros.textproto",
+	}
+	skipTests := []string{
+		// feature: unsupported mixed key types
+		"macros/exists/map_key_type_shortcircuit",
+		"macros/exists/map_key_type_exhaustive",
+		// feature: dyn not support
+		"macros/all/list_elem_type_shortcircuit",
+		"macros/exists/list_elem_type_shortcircuit",
+		"macros/exists/list_elem_type_exhaustive",
+	}
+
+	files := LoadTestFile(tests)
+	for _, file := range files {
+		for _, section := range file.GetSection() {
+			for _, testCase := range section.GetTest() {
+				name := fmt.Sprintf("%s/%s/%s", file.GetName(), section.GetName(), testCase.GetName())
+
+				if slices.Contains(skipTests, name) {
+					continue
+				}
+
+				if err := RunTestCase(testCase); err != nil {
+					t.Errorf("RunTestCase(%q) error: %v", name, err)
+				}
+			}
+		}
+	}
+
+}
+
+// an error of a step is kept in the accumulator, a later step that decides the
+// result absorbs it
+func TestComprehensionErrors(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	tests := []struct {
+		expr string
+		want ast.Value
+		err  string
+	}{
+		{expr: `[0, 1].exists(e, 1 / e == 1)`, want: ast.NewBoolValue(true)},
+		{expr: `[0, 1].all(e, 1 / e == 2)`, want: ast.NewBoolValue(false)},
+		{expr: `[0, 2].exists(e, 1 / e == 1)`, err: "divide by zero"},
+		{expr: `[0, 1].all(e, 1 / e == 1)`, err: "divide by zero"},
+		{expr: `[0, 1].map(e, 1 / e)`, err: "divide by zero"},
+		{expr: `[0, 1, 1].exists_one(e, 1 / e == 1)`, err: "divide by zero"},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := sl.NewProgram(node, nil)
+		compiled, err := env.Compile(program)
+		if err != nil {
+			t.Fatalf("Compile(%q) error: %v", tt.expr, err)
+		}
+
+		for _, run := range []func() (ast.Value, error){
+			func() (ast.Value, error) { return env.Run(program, nil) },
+			func() (ast.Value, error) { return compiled.Eval(nil) },
+		} {
+			got, err := run()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Run(%q): got %v, %v, want error %q", tt.expr, got, err, tt.err)
+				}
+			} else if err != nil || !got.Equal(tt.want) {
+				t.Errorf("Run(%q): got %v, %v, want %v", tt.expr, got, err, tt.want)
+			}
+		}
+	}
+
+	// errors of the cost limit are never absorbed
+	node, err := sl.Parse(`[1, 2, 3, 4, 5].exists(e, e == 5)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.RunContext(context.Background(), sl.NewProgram(node, nil), nil, sl.RunOptions{CostLimit: 10})
+	var costErr *sl.CostLimitError
+	if !errors.As(err, &costErr) {
+		t.Errorf("RunContext with a cost limit: got %v, want a cost limit error", err)
+	}
+}
+
+func TestComprehensionOverMap(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	vars := sl.Variables{
+		// a variable named like the accumulator of older versions
+		"__result__": ast.NewIntValue(1),
+		"m": ast.NewMapValue(map[ast.Value]ast.Value{
+			ast.NewStringValue("c"): ast.NewIntValue(3),
+			ast.NewStringValue("a"): ast.NewIntValue(1),
+			ast.NewStringValue("b"): ast.NewIntValue(2),
+			ast.NewStringValue("d"): ast.NewIntValue(4),
+		}, ast.StringType, ast.IntType),
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: `m.map(k, k)`, want: `["a", "b", "c", "d"]`},
+		{expr: `m.filter(k, m[k] > 1)`, want: `["b", "c", "d"]`},
+		{expr: `[1, 2].map(x, x + __result__)`, want: `[2, 3]`},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+		wantNode, err := sl.Parse(tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := env.Run(sl.NewProgram(wantNode, nil), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the order does not change between runs
+		for i := 0; i < 10; i++ {
+			got, err := env.Run(program, vars)
+			if err != nil || !got.Equal(want) {
+				t.Fatalf("Run(%q): got %v, %v, want %s", tt.expr, got, err, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+	"github.com/yywing/sl/native"
+	"github.com/yywing/sl/optimizer"
+)
+
+func TestOptimize(t *testing.T) {
+	env := sl.NewStdEnv()
+	vars := sl.Variables{
+		"x": ast.NewIntValue(1),
+		"s": ast.NewStringValue("abc"),
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: `"a" + "b" == s`, want: `_==_("ab", s)`},
+		{expr: `base64Decode("YWJj") == b"abc"`, want: `true`},
+		{expr: `s.startsWith("a" + "b")`, want: `(s.startsWith)("ab")`},
+		{expr: `true || x > 0`, want: `true`},
+		{expr: `x > 0 || true`, want: `_||_(_>_(x, 0), true)`},
+		{expr: `false && x > 0`, want: `false`},
+		{expr: `true && x > 0`, want: `_>_(x, 0)`},
+		{expr: `x > 0 || 1 > 2`, want: `_>_(x, 0)`},
+		{expr: `1 < 2 ? s : "b"`, want: `s`},
+		{expr: `[1, 2, 3][x] == 2`, want: `_==_(([1, 2, 3][x]), 2)`},
+		{expr: `{"a": 1}.a + x`, want: `_+_(1, x)`},
+		{expr: `[1, 2].map(y, y * (1 + 1))`, want: `__comprehension__(y, [1, 2], @result, [], true, _+_(@result, [_*_(y, 2)]), @result)`},
+		// failing and impure calls are kept
+		{expr: `x / 0 == 1 / 0`, want: `_==_(_/_(x, 0), _/_(1, 0))`},
+		{expr: `now() > timestamp("2020-01-01T00:00:00Z")`, want: `_>_(now(), timestamp("2020-01-01T00:00:00Z"))`},
+		{expr: `s.matches("a+")`, want: `(s.matches)(a+)`},
+		{expr: `matches(s, "a(")`, want: `matches(s, "a(")`},
+	}
+
+	o := optimizer.New(env)
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+		if _, err := env.Check(program); err != nil {
+			t.Fatalf("Check(%q) error: %v", tt.expr, err)
+		}
+
+		optimized := o.Optimize(node)
+		if got := optimized.String(); got != tt.want {
+			t.Errorf("Optimize(%q): got %s, want %s", tt.expr, got, tt.want)
+		}
+		if node.String() == optimized.String() {
+			continue
+		}
+
+		// the optimized expression must give the same result
+		optimizedProgram := sl.NewProgram(optimized, vars.Type())
+		if _, err := env.Check(optimizedProgram); err != nil {
+			t.Fatalf("Check(optimized %q) error: %v", tt.expr, err)
+		}
+		want, wantErr := env.Run(program, vars)
+		got, gotErr := env.Run(optimizedProgram, vars)
+		if (wantErr != nil) != (gotErr != nil) || (wantErr == nil && !got.Equal(want)) {
+			t.Errorf("Run(optimized %q): got %v, %v, want %v, %v", tt.expr, got, gotErr, want, wantErr)
+		}
+	}
+}
+
+func TestFoldRegisteredFunction(t *testing.T) {
+	env := sl.NewStdEnv()
+	var calls int64
+	env.SetFunction("counter", ast.NewBaseFunction("counter", native.MustNewNativeFunction("counter", func(n int64) int64 {
+		calls++
+		return n + calls
+	}).Definitions()))
+	env.SetFunction("double", ast.NewBaseFunction("double", native.MustNewNativeFunction("double", func(n int64) int64 {
+		return n * 2
+	}).WithPure().Definitions()))
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: `counter(0) + 1`, want: `_+_(counter(0), 1)`},
+		{expr: `double(2) + 1`, want: `5`},
+	}
+
+	o := optimizer.New(env)
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := o.Optimize(node).String(); got != tt.want {
+			t.Errorf("Optimize(%q): got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("Optimize called counter %d times", calls)
+	}
+}
+
+func TestPrecompileRegex(t *testing.T) {
+	env := sl.NewStdEnv()
+	node, err := sl.Parse(`s.matches("^a+b$")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	optimized := optimizer.New(env, optimizer.PrecompileRegex).Optimize(node)
+	call := optimized.(*ast.FunctionCallNode)
+	lit, ok := call.Args[0].(*ast.LiteralNode)
+	if !ok {
+		t.Fatalf("Optimize() pattern: got %s, want a literal", call.Args[0])
+	}
+	if _, ok := lit.Value.(*types.RegexValue); !ok {
+		t.Fatalf("Optimize() pattern: got %T, want *types.RegexValue", lit.Value)
+	}
+
+	for _, s := range []string{"aab", "abc"} {
+		vars := sl.Variables{"s": ast.NewStringValue(s)}
+		program := sl.NewProgram(optimized, vars.Type())
+		if _, err := env.Check(program); err != nil {
+			t.Fatal(err)
+		}
+		got, err := env.Run(program, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ast.NewBoolValue(s == "aab"); !got.Equal(want) {
+			t.Errorf("Run(%q): got %v, want %v", s, got, want)
+		}
+	}
+}
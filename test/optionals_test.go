@@ -0,0 +1,133 @@
+package test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+)
+
+func TestOptionals(t *testing.T) {
+
+	tests := []string{
+		"testdata/optionals.textproto",
+	}
+	skipTests := []string{
+		// feature: optMap and optFlatMap macros not support
+		"optionals/optionals/none_optMap_hasValue",
+		"optionals/optionals/empty_map_optFlatMap_hasValue",
+		"optionals/optionals/map_empty_submap_optFlatMap_hasValue",
+		"optionals/optionals/map_submap_subkey_optFlatMap_value",
+		"optionals/optionals/map_submap_optFlatMap_value",
+		"optionals/optionals/map_optindex_optFlatMap_optional_ofNonZeroValue_hasValue",
+		"optionals/optionals/optional_of_optMap_value",
+		// feature: dyn not support
+		"optionals/optionals/map_null_entry_hasValue",
+		"optionals/optionals/map_absent_key_absent_field_none",
+		"optionals/optionals/optional_chaining_15",
+		// feature: unsupported mixed key types
+		"optionals/optionals/map_key_mixed_type_optindex_value",
+		"optionals/optionals/map_key_mixed_numbers_double_key_optindex_value",
+		"optionals/optionals/map_key_mixed_numbers_uint_key_optindex_value",
+		"optionals/optionals/map_key_mixed_numbers_int_key_optindex_value",
+		// feature: type identifiers not support
+		"optionals/optionals/type",
+		// feature: proto messages not support
+		"optionals/optionals/has_optional_ofNonZeroValue_struct_optional_ofNonZeroValue_map_optindex_field",
+		"optionals/optionals/optional_ofNonZeroValue_struct_optional_ofNonZeroValue_map_optindex_field",
+		"optionals/optionals/struct_map_optindex_field",
+		"optionals/optionals/struct_optional_ofNonZeroValue_map_optindex_field",
+		"optionals/optionals/struct_map_optindex_field_nested",
+		"optionals/optionals/struct_list_optindex_field",
+		"optionals/optionals/empty_struct_optindex_hasValue",
+		"optionals/optionals/optional_empty_struct_optindex_hasValue",
+		"optionals/optionals/struct_optindex_value",
+		"optionals/optionals/optional_struct_optindex_value",
+		"optionals/optionals/optional_struct_optindex_index_value",
+	}
+
+	files := LoadTestFile(tests)
+	for _, file := range files {
+		for _, section := range file.GetSection() {
+			for _, testCase := range section.GetTest() {
+				name := fmt.Sprintf("%s/%s/%s", file.GetName(), section.GetName(), testCase.GetName())
+
+				if slices.Contains(skipTests, name) {
+					continue
+				}
+
+				if err := RunTestCase(testCase); err != nil {
+					t.Errorf("RunTestCase(%q) error: %v", name, err)
+				}
+			}
+		}
+	}
+
+}
+
+func TestOptionalCheckErrors(t *testing.T) {
+	env := sl.NewStdEnv()
+	for _, expr := range []string{
+		`[?1]`,
+		`{?"a": 1}`,
+		`HTTPRequest{?method: "GET"}`,
+		`optional.of(1).orValue("a")`,
+		`optional.of(1).or(optional.of("a"))`,
+		`optional.of(1).value() + "a"`,
+	} {
+		node, err := sl.Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", expr, err)
+		}
+		if _, err := env.Check(sl.NewProgram(node, nil)); err == nil {
+			t.Errorf("Check(%q): want error", expr)
+		}
+	}
+}
+
+func TestOptionalTypes(t *testing.T) {
+	env := sl.NewStdEnv()
+
+	tests := []struct {
+		expr string
+		want string
+		vars sl.Variables
+	}{
+		// optional.none() does not decide the type of the collection
+		{expr: `[?optional.none(), ?optional.of(2)]`, want: `list<int>`},
+		{expr: `[?optional.none()]`, want: `list<any>`},
+		{expr: `{?"a": optional.none(), "b": 1}`, want: `map<string, int>`},
+		{expr: `[?optional.of("a"), ?optional.of(2)]`, want: `list<any>`},
+		// a variable named optional keeps its method calls
+		{expr: `optional.size()`, want: `int`, vars: sl.Variables{"optional": ast.NewStringValue("abc")}},
+		{expr: `[""].map(optional, optional.size())`, want: `list<int>`},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", tt.expr, err)
+		}
+		program := sl.NewProgram(node, tt.vars.Type())
+		got, err := env.Check(program)
+		if err != nil {
+			t.Fatalf("Check(%q) error: %v", tt.expr, err)
+		}
+		if got.String() != tt.want {
+			t.Errorf("Check(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+
+		compiled, err := env.Compile(program)
+		if err != nil {
+			t.Fatalf("Compile(%q) error: %v", tt.expr, err)
+		}
+		if _, err := env.Run(program, tt.vars); err != nil {
+			t.Errorf("Run(%q) error: %v", tt.expr, err)
+		}
+		if _, err := compiled.Eval(tt.vars); err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.expr, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+)
+
+func TestStruct(t *testing.T) {
+	env := sl.NewStdEnv()
+	env.SetType("Finding", ast.NewSchemaType("Finding", map[string]ast.ValueType{
+		"name":     ast.StringType,
+		"severity": ast.IntType,
+		"tags":     ast.NewListType(ast.StringType),
+	}))
+	vars := sl.Variables{
+		"m": ast.NewMapValue(map[ast.Value]ast.Value{ast.NewStringValue("a"): ast.NewStringValue("x")}, ast.StringType, ast.StringType),
+	}
+
+	tests := []struct {
+		expr string
+		want ast.Value
+	}{
+		{expr: `HTTPRequest{method: "POST", body: b"a=1"}.method`, want: ast.NewStringValue("POST")},
+		{expr: `HTTPRequest{method: "POST", body: b"a=1"}.body == b"a=1"`, want: ast.NewBoolValue(true)},
+		{expr: `HTTPRequest{url: url("https://example.com/a")}.url.path`, want: ast.NewStringValue("/a")},
+		{expr: `has(HTTPRequest{method: "GET"}.body)`, want: ast.NewBoolValue(false)},
+		{expr: `HTTPResponse{status: 404}.status == 404`, want: ast.NewBoolValue(true)},
+		{expr: `.HTTPResponse{status: 200}.status`, want: ast.NewIntValue(200)},
+		// unset pointer members read as zero values
+		{expr: `HTTPResponse{status: 1}.latency == duration("0s")`, want: ast.NewBoolValue(true)},
+		{expr: `has(HTTPResponse{status: 1}.latency)`, want: ast.NewBoolValue(false)},
+		// headers are empty when unset, and set from maps
+		{expr: `HTTPRequest{method: "GET"}.headers.size() == 0 && !has(HTTPRequest{method: "GET"}.headers)`, want: ast.NewBoolValue(true)},
+		{expr: `HTTPRequest{headers: {"A": "b"}}.headers["a"]`, want: ast.NewStringValue("b")},
+		{expr: `has(HTTPRequest{headers: {"A": "b"}}.headers)`, want: ast.NewBoolValue(true)},
+		{expr: `HTTPRequest{headers: {"Set-Cookie": ["a=1", "b=2"], "A": ["b"]}}.headers.values("set-cookie")`, want: ast.NewListValue([]ast.Value{ast.NewStringValue("a=1"), ast.NewStringValue("b=2")}, ast.StringType)},
+		{expr: `HTTPResponse{headers: {"A": "b"}}.headers == {"a": "b"}`, want: ast.NewBoolValue(true)},
+		{expr: `Finding{name: "xss", tags: ["a"]}.severity`, want: ast.NewIntValue(0)},
+		{expr: `Finding{name: "xss"}.tags.size()`, want: ast.NewIntValue(0)},
+		{expr: `has(Finding{name: "xss"}.severity) || !has(Finding{name: "xss"}.name)`, want: ast.NewBoolValue(false)},
+		{expr: `Finding{name: "xss", severity: 0} == Finding{name: "xss"}`, want: ast.NewBoolValue(true)},
+		{expr: `Finding{name: "xss"} == Finding{name: "sqli"}`, want: ast.NewBoolValue(false)},
+		{expr: `[1, 2].map(i, Finding{severity: i})[1].severity`, want: ast.NewIntValue(2)},
+		// optional fields are left unset when absent
+		{expr: `has(Finding{?name: m.?b}.name)`, want: ast.NewBoolValue(false)},
+		{expr: `Finding{?name: m.?a}.name`, want: ast.NewStringValue("x")},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", tt.expr, err)
+		}
+		program := sl.NewProgram(node, vars.Type())
+		if _, err := env.Check(program); err != nil {
+			t.Fatalf("Check(%q) error: %v", tt.expr, err)
+		}
+
+		got, err := env.Run(program, vars)
+		if err != nil {
+			t.Errorf("Run(%q) error: %v", tt.expr, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("Run(%q): got %v, want %v", tt.expr, got, tt.want)
+		}
+
+		compiled, err := env.Compile(program)
+		if err != nil {
+			t.Fatalf("Compile(%q) error: %v", tt.expr, err)
+		}
+		got, err = compiled.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.expr, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("Eval(%q): got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestStructCheckErrors(t *testing.T) {
+	env := sl.NewStdEnv()
+	for _, expr := range []string{
+		`Unknown{a: 1}`,
+		`HTTPRequest{verb: "GET"}`,
+		`HTTPRequest{method: 1}`,
+		`HTTPRequest{method: "GET", method: "POST"}`,
+		`HTTPRequest{headers: {"A": 1}}`,
+		`HTTPRequest{headers: ["A"]}`,
+	} {
+		node, err := sl.Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", expr, err)
+		}
+		if _, err := env.Check(sl.NewProgram(node, nil)); err == nil {
+			t.Errorf("Check(%q): want error", expr)
+		}
+	}
+}
+
+func TestStructValue(t *testing.T) {
+	env := sl.NewStdEnv()
+	node, err := sl.Parse(`HTTPRequest{method: "POST", url: url("https://example.com/"), body: b"x"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := sl.NewProgram(node, nil)
+	if _, err := env.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	got, err := env.Run(program, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, ok := got.(*types.HTTPRequestValue)
+	if !ok {
+		t.Fatalf("Run(): got %T, want *types.HTTPRequestValue", got)
+	}
+	if req.Method != "POST" || req.URL.Host != "example.com:443" || string(req.Body) != "x" || req.Headers == nil || len(req.Headers.Headers) != 0 {
+		t.Errorf("Run(): got %+v", req)
+	}
+}
@@ -237,27 +237,46 @@ func RunTestCase(testCase *testpb.SimpleTest) error {
 	// eval
 	if !testCase.GetCheckOnly() {
 		result, err := env.Run(program, vars)
-		switch m := testCase.GetResultMatcher().(type) {
-		case *testpb.SimpleTest_EvalError:
-			if err == nil {
-				return fmt.Errorf("eval: got nil, want %v", m.EvalError)
-			}
-		case *testpb.SimpleTest_Value:
+		if err := matchResult(testCase, result, err); err != nil {
+			return err
+		}
+
+		// the compiled program must agree with the runner
+		if !testCase.GetDisableCheck() {
+			compiled, err := env.Compile(program)
 			if err != nil {
-				return fmt.Errorf("eval(%q) error: %v", testCase.GetName(), err)
+				return fmt.Errorf("Compile(%q) error: %v", testCase.GetName(), err)
 			}
-			val, err := ValueToExprValue(result)
-			if err != nil {
-				return fmt.Errorf("ValueToExprValue(%q) error: %v", testCase.GetName(), err)
+			result, err := compiled.Eval(vars)
+			if err := matchResult(testCase, result, err); err != nil {
+				return fmt.Errorf("compiled: %w", err)
 			}
+		}
+	}
+	return nil
+}
 
-			if diff := cmp.Diff(m.Value, val, protocmp.Transform(), protocmp.SortRepeatedFields(&expr.MapValue{}, "entries")); diff != "" {
-				return fmt.Errorf("program.Eval() diff (-want +got):\n%s", diff)
-			}
+func matchResult(testCase *testpb.SimpleTest, result ast.Value, err error) error {
+	switch m := testCase.GetResultMatcher().(type) {
+	case *testpb.SimpleTest_EvalError:
+		if err == nil {
+			return fmt.Errorf("eval: got nil, want %v", m.EvalError)
+		}
+	case *testpb.SimpleTest_Value:
+		if err != nil {
+			return fmt.Errorf("eval(%q) error: %v", testCase.GetName(), err)
+		}
+		val, err := ValueToExprValue(result)
+		if err != nil {
+			return fmt.Errorf("ValueToExprValue(%q) error: %v", testCase.GetName(), err)
+		}
 
-		default:
-			return fmt.Errorf("unexpected matcher kind: %T", testCase.GetResultMatcher())
+		if diff := cmp.Diff(m.Value, val, protocmp.Transform(), protocmp.SortRepeatedFields(&expr.MapValue{}, "entries")); diff != "" {
+			return fmt.Errorf("program.Eval() diff (-want +got):\n%s", diff)
 		}
+
+	default:
+		return fmt.Errorf("unexpected matcher kind: %T", testCase.GetResultMatcher())
 	}
 	return nil
 }
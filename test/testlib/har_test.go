@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+)
+
+func TestLoadHAR(t *testing.T) {
+	entries, err := types.LoadHARFile("testdata/traffic.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("LoadHARFile() entries: got %d, want 2", len(entries))
+	}
+
+	env := sl.NewStdEnv()
+	tests := []struct {
+		expr string
+		// the result for each entry
+		want []bool
+	}{
+		{expr: `request.method == "POST"`, want: []bool{true, false}},
+		{expr: `request.url.path == "/login" && request.url.query == "next=%2Fhome"`, want: []bool{true, false}},
+		{expr: `"Accept" in request.headers ? request.headers["Accept"] == "text/html,application/json" : false`, want: []bool{true, false}},
+		{expr: `"X-Trace-Id" in request.headers ? request.headers["X-Trace-Id"] == "abc" : false`, want: []bool{true, false}},
+		{expr: `request.body == b"password=secret&user=admin"`, want: []bool{true, false}},
+		{expr: `request.raw_header == b"POST /login?next=%2Fhome HTTP/1.1\r\nHost: example.com\r\nx-trace-id: abc\r\nAccept: text/html\r\nAccept: application/json\r\nContent-Type: application/x-www-form-urlencoded\r\n\r\n"`, want: []bool{true, false}},
+		{expr: `request.raw_header == b"GET /home HTTP/2.0\r\ncookie: session=1; theme=dark\r\n\r\n"`, want: []bool{false, true}},
+		{expr: `"Cookie" in request.headers`, want: []bool{false, true}},
+		{expr: `"Set-Cookie" in response.headers ? response.headers["Set-Cookie"] == "session=1; Path=/,theme=dark" : false`, want: []bool{true, false}},
+		{expr: `response.headers.values("set-cookie") == ["session=1; Path=/", "theme=dark"]`, want: []bool{true, false}},
+		{expr: `request.headers.names() == ["cookie"]`, want: []bool{false, true}},
+		{expr: `response.raw_header.bcontains(b"\r\nSet-Cookie: session=1; Path=/\r\nset-cookie: theme=dark\r\n")`, want: []bool{true, false}},
+		{expr: `response.status == 200 && response.body == b"<h1>hi</h1>"`, want: []bool{false, true}},
+		{expr: `response.raw_header.bstartsWith(b"HTTP/2.0 200 OK\r\n")`, want: []bool{false, true}},
+		{expr: `response.content_type == "text/html"`, want: []bool{true, true}},
+		{expr: `response.latency > duration("100ms")`, want: []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range entries {
+			vars := sl.Variables{"request": e.Request, "response": e.Response}
+			program := sl.NewProgram(node, vars.Type())
+			if _, err := env.Check(program); err != nil {
+				t.Fatalf("Check(%q) error: %v", tt.expr, err)
+			}
+			got, err := env.Run(program, vars)
+			if err != nil {
+				t.Errorf("Run(%q) entry %d error: %v", tt.expr, i, err)
+				continue
+			}
+			if want := ast.NewBoolValue(tt.want[i]); !got.Equal(want) {
+				t.Errorf("Run(%q) entry %d: got %v, want %v", tt.expr, i, got, want)
+			}
+		}
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"slices"
 	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
 )
 
 func TestUnknowns(t *testing.T) {
@@ -31,3 +35,112 @@ func TestUnknowns(t *testing.T) {
 	}
 
 }
+
+func TestPartialRun(t *testing.T) {
+	env := sl.NewStdEnv()
+	response, err := types.NewHTTPResponseValueFromRaw([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := sl.Variables{
+		"s":        ast.NewStringValue("abc"),
+		"response": response,
+	}
+	// x is declared but not set
+	varsType := vars.Type()
+	varsType["x"] = ast.IntType
+
+	tests := []struct {
+		expr     string
+		unknowns []string
+		want     ast.Value
+		residual string
+	}{
+		{expr: `x > 1 && s == "abc"`, want: ast.NewUnknownValue("x"), residual: `x > 1`},
+		{expr: `s == "x" && x > 1`, want: ast.NewBoolValue(false), residual: `false`},
+		{expr: `x > 1 || s.startsWith("a")`, want: ast.NewBoolValue(true), residual: `true`},
+		{expr: `size(s) + x`, want: ast.NewUnknownValue("x"), residual: `3 + x`},
+		// the branches are not evaluated
+		{expr: `x == 1 ? s : "b"`, want: ast.NewUnknownValue("x"), residual: `x == 1 ? s : "b"`},
+		{expr: `s == "abc" ? x : 0`, want: ast.NewUnknownValue("x"), residual: `x`},
+		{expr: `[1, 2].exists(i, i == x)`, want: ast.NewUnknownValue("x"), residual: `[1, 2].exists(i, i == x)`},
+		{expr: `[1, 2].exists(i, i == x || i == 2)`, want: ast.NewBoolValue(true), residual: `true`},
+		{expr: `[x, 1][1]`, want: ast.NewUnknownValue("x"), residual: `[x, 1][1]`},
+		{expr: `bind(y, size(s), y + x)`, want: ast.NewUnknownValue("x"), residual: `bind(y, 3, 3 + x)`},
+		{
+			expr:     `bind(code, response.status, code == 200 && s.startsWith("a"))`,
+			unknowns: []string{"response.status"},
+			want:     ast.NewUnknownValue("response.status"),
+			residual: `bind(code, response.status, code == 200)`,
+		},
+		// the steps of comprehensions are evaluated once per element, only the
+		// parts outside of them are folded
+		{expr: `[size(s)].exists(i, i == x && size(s) == 3)`, want: ast.NewUnknownValue("x"), residual: `[3].exists(i, i == x && size(s) == 3)`},
+		{
+			expr:     `response.status == 200 && response.body.bcontains(b"ok")`,
+			unknowns: []string{"response.body"},
+			want:     ast.NewUnknownValue("response.body"),
+			residual: `response.body.bcontains(b"ok")`,
+		},
+		{
+			expr:     `response.status == 404 && response.body.bcontains(b"ok")`,
+			unknowns: []string{"response.body"},
+			want:     ast.NewBoolValue(false),
+			residual: `false`,
+		},
+		{
+			expr:     `response.body.bcontains(b"ok") || x > 0`,
+			unknowns: []string{"response.body"},
+			want:     ast.NewUnknownValue("response.body", "x"),
+			residual: `response.body.bcontains(b"ok") || x > 0`,
+		},
+		{expr: `s + "d"`, unknowns: []string{"s"}, want: ast.NewUnknownValue("s"), residual: `s + "d"`},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", tt.expr, err)
+		}
+		program := sl.NewProgram(node, varsType)
+		if _, err := env.Check(program); err != nil {
+			t.Fatalf("Check(%q) error: %v", tt.expr, err)
+		}
+
+		got, residual, err := env.PartialRun(program, vars, tt.unknowns...)
+		if err != nil {
+			t.Errorf("PartialRun(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("PartialRun(%q): got %v, want %v", tt.expr, got, tt.want)
+		}
+		s, err := sl.Unparse(residual)
+		if err != nil {
+			t.Errorf("Unparse(%q) residual error: %v", tt.expr, err)
+		} else if s != tt.residual {
+			t.Errorf("PartialRun(%q) residual: got %s, want %s", tt.expr, s, tt.residual)
+		}
+	}
+
+	// the residual runs once the unknowns are known
+	node, err := sl.Parse(`size(s) + x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := sl.NewProgram(node, varsType)
+	_, residual, err := env.PartialRun(program, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := env.Run(sl.NewProgram(residual, sl.VariablesType{"x": ast.IntType}), sl.Variables{"x": ast.NewIntValue(2)})
+	if err != nil {
+		t.Fatal(err)
+	} else if !got.Equal(ast.NewIntValue(5)) {
+		t.Errorf("Run(residual): got %v, want 5", got)
+	}
+
+	if _, _, err := env.PartialRun(program, sl.Variables{"s": ast.NewIntValue(1)}); err == nil {
+		t.Errorf("PartialRun with a mistyped variable: want error")
+	}
+}
@@ -0,0 +1,249 @@
+package test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/codec"
+	"github.com/yywing/sl/optimizer"
+)
+
+func TestUnparse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: `a&&b||c`, want: `a && b || c`},
+		{expr: `a && (b || c)`, want: `a && (b || c)`},
+		{expr: `a || (b || c)`, want: `a || (b || c)`},
+		{expr: `(a || b) || c`, want: `a || b || c`},
+		{expr: `(1 + 2) * 3 - 4 / (5 % 6)`, want: `(1 + 2) * 3 - 4 / (5 % 6)`},
+		{expr: `1 - (2 - 3)`, want: `1 - (2 - 3)`},
+		{expr: `x < 1 == (y > 2)`, want: `x < 1 == (y > 2)`},
+		{expr: `"a" in ["a"] && !(x in m)`, want: `"a" in ["a"] && !(x in m)`},
+		{expr: `!!a && --x > -1 && -(1) < 0 && x - -2.5 > 1e100`, want: `!!a && --x > -1 && -(1) < 0 && x - -2.5 > 1e+100`},
+		{expr: `(-1).string() + (x + 1).string()`, want: `(-1).string() + (x + 1).string()`},
+		{expr: `a ? b : c ? d : e`, want: `a ? b : c ? d : e`},
+		{expr: `(a ? b : c) ? d : e`, want: `(a ? b : c) ? d : e`},
+		{expr: `a ? (b ? c : d) : e`, want: `a ? (b ? c : d) : e`},
+		{expr: `(a ? b : c).size()`, want: `(a ? b : c).size()`},
+		{expr: `.x + .f(1) + r.a.?b[0][?"c"]`, want: `.x + .f(1) + r.a.?b[0][?"c"]`},
+		{expr: "r.`a-b`.c", want: "r.`a-b`.c"},
+		{expr: `{"a": [1u, 2.0], 'b': {}}`, want: `{"a": [1u, 2.0], "b": {}}`},
+		{expr: `a.B{x: 1, ?y: 2} == .C{}`, want: `a.B{x: 1, ?y: 2} == .C{}`},
+		{expr: `[?a, b, ?optional.of(c)] + [{?"k": d.?e}]`, want: `[?a, b, ?optional.of(c)] + [{?"k": d.?e}]`},
+		{expr: `cel.bind(x, a.b, x + bind(y, x, y))`, want: `bind(x, a.b, x + bind(y, x, y))`},
+		{expr: `'\'"\n\t\\✓\u0001' + r"\d" + b"\xff\x00a"`, want: `"'\"\n\t\\✓\u0001" + "\\d" + b"\xff\x00a"`},
+		{expr: `has(r.a.b) && null == null && true != false`, want: `has(r.a.b) && null == null && true != false`},
+		{expr: `l.all(x, x > 0) && l.exists(x, x > 1) || l.exists_one(x, x == 2)`, want: `l.all(x, x > 0) && l.exists(x, x > 1) || l.exists_one(x, x == 2)`},
+		// map with the iteration variable as result expands like filter
+		{expr: `l.map(x, x * 2) + l.map(x, x > 1, x) + l.filter(x, x > 1) + l.map(x, x > 1, -x)`, want: `l.map(x, x * 2) + l.filter(x, x > 1) + l.filter(x, x > 1) + l.map(x, x > 1, -x)`},
+		{expr: `[1, 2].map(x, [3].map(y, x + y))`, want: `[1, 2].map(x, [3].map(y, x + y))`},
+		{expr: `x // comment
+			+ 1`, want: `x + 1`},
+	}
+
+	for _, tt := range tests {
+		node, err := sl.Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", tt.expr, err)
+		}
+		got, err := sl.Unparse(node)
+		if err != nil {
+			t.Fatalf("Unparse(%q) error: %v", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("Unparse(%q): got %s, want %s", tt.expr, got, tt.want)
+		}
+
+		reparsed, err := sl.Parse(got)
+		if err != nil {
+			t.Fatalf("Parse(Unparse(%q)) error: %v", tt.expr, err)
+		}
+		if reparsed.String() != node.String() {
+			t.Errorf("Parse(Unparse(%q)): got %s, want %s", tt.expr, reparsed, node)
+		}
+	}
+}
+
+func TestUnparseValues(t *testing.T) {
+	tests := []struct {
+		value ast.Value
+		want  string
+	}{
+		{value: ast.NewIntValue(math.MinInt64), want: `-9223372036854775808`},
+		{value: ast.NewUintValue(math.MaxUint64), want: `18446744073709551615u`},
+		{value: ast.NewDoubleValue(3), want: `3.0`},
+		{value: ast.NewDoubleValue(math.Inf(1)), want: `double("+Inf")`},
+		{value: ast.NewDoubleValue(math.NaN()), want: `double("NaN")`},
+		{value: ast.NewStringValue("\U0001F600\u200b"), want: `"` + "\U0001F600" + `\u200b"`},
+	}
+
+	env := sl.NewStdEnv()
+	for _, tt := range tests {
+		got, err := sl.Unparse(ast.NewLiteral(tt.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Unparse(%v): got %s, want %s", tt.value, got, tt.want)
+		}
+
+		node, err := sl.Parse(got)
+		if err != nil {
+			t.Fatalf("Parse(%s) error: %v", got, err)
+		}
+		value, err := env.Run(sl.NewProgram(node, nil), nil)
+		if err != nil {
+			t.Fatalf("Run(%s) error: %v", got, err)
+		}
+		if !value.Equal(tt.value) && !math.IsNaN(value.(*ast.DoubleValue).DoubleValue) {
+			t.Errorf("Run(%s): got %v, want %v", got, value, tt.value)
+		}
+	}
+
+	if _, err := sl.Unparse(ast.NewLiteral(ast.NewTypeValue("int"))); err == nil {
+		t.Errorf("Unparse(type literal): want error")
+	}
+	comprehension := ast.NewComprehension("x", ast.NewList(nil), "acc", ast.NewIdent("acc", false), ast.NewIdent("acc", false), ast.NewIdent("acc", false), ast.NewIdent("acc", false))
+	if _, err := sl.Unparse(comprehension); err == nil {
+		t.Errorf("Unparse(comprehension): want error")
+	}
+}
+
+func TestUnparseOptimizedAndDecoded(t *testing.T) {
+	env := sl.NewStdEnv()
+	node, err := sl.Parse(`s.matches("^a" + "+$") && 1 + 1 == x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimized := optimizer.New(env).Optimize(node)
+	want := `s.matches("^a+$") && 2 == x`
+
+	data, err := codec.MarshalBinary(&codec.CheckedAST{Root: optimized})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []ast.ASTNode{optimized, decoded.Root} {
+		got, err := sl.Unparse(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Unparse(): got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	expr := `request.method == "POST" && request.url.path.startsWith("/api/v1/upload") && response.status == 200 && response.body.bcontains(b"uploaded successfully") ? [request.url.path, response.status, response.headers["content-type"]] : []`
+	want := `request.method == "POST"
+  && request.url.path.startsWith("/api/v1/upload")
+  && response.status == 200
+  && response.body.bcontains(b"uploaded successfully")
+  ? [
+    request.url.path,
+    response.status,
+    response.headers["content-type"]
+  ]
+  : []`
+
+	node, err := sl.Parse(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := sl.Format(node, sl.FormatOptions{MaxWidth: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Format(): got\n%s\nwant\n%s", got, want)
+	}
+
+	reparsed, err := sl.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.String() != node.String() {
+		t.Errorf("Parse(Format()): got %s, want %s", reparsed, node)
+	}
+
+	// expressions that fit are not wrapped
+	got, err = sl.Format(node, sl.FormatOptions{MaxWidth: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flat, _ := sl.Unparse(node); got != flat {
+		t.Errorf("Format(wide): got %s, want %s", got, flat)
+	}
+}
+
+func TestFormatSource(t *testing.T) {
+	expr := `// check the upload
+request.method == "POST" // only POST
+  && request.url.path.startsWith("/api") &&
+  // the body
+  response.body.bcontains(b"ok") && [1, // one
+  2].exists(x, x > 1) && x + // inner
+  1 > 2
+// end`
+	want := `// check the upload
+request.method == "POST" // only POST
+  && request.url.path.startsWith("/api")
+  // the body
+  && response.body.bcontains(b"ok")
+  && [
+    1, // one
+    2
+  ].exists(x, x > 1)
+  && x + 1 > 2 // inner
+// end`
+
+	got, err := sl.FormatSource(expr, sl.FormatOptions{MaxWidth: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("FormatSource(): got\n%s\nwant\n%s", got, want)
+	}
+
+	// formatting is stable and keeps the AST
+	again, err := sl.FormatSource(got, sl.FormatOptions{MaxWidth: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != got {
+		t.Errorf("FormatSource(FormatSource()): got\n%s\nwant\n%s", again, got)
+	}
+	node, _ := sl.Parse(expr)
+	formatted, err := sl.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted.String() != node.String() {
+		t.Errorf("Parse(FormatSource()): got %s, want %s", formatted, node)
+	}
+
+	got, err = sl.FormatSource("a&&b // c", sl.FormatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a && b // c"; got != want {
+		t.Errorf("FormatSource(): got %s, want %s", got, want)
+	}
+
+	// string and bytes literals keep their quotes
+	got, err = sl.FormatSource(`'a'+"b"+r'\d'+string(B'c')`, sl.FormatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `'a' + "b" + r'\d' + string(B'c')`; got != want {
+		t.Errorf("FormatSource(): got %s, want %s", got, want)
+	}
+}
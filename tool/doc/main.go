@@ -4,10 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	libtypes "github.com/yywing/sl/lib/types"
 )
 
 func main() {
@@ -49,7 +52,12 @@ func generateMarkdown(env *sl.Env) string {
 		// Get all type signatures for the function
 		types := function.Types()
 
-		for i, fnType := range types {
+		i := 0
+		for _, fnType := range types {
+			// regex overloads are only created by the optimizer
+			if slices.Contains(fnType.ParamTypes(), ast.ValueType(libtypes.RegexType)) {
+				continue
+			}
 			var functionName string
 			if i == 0 {
 				// Escape pipe symbols in function names
@@ -75,6 +83,7 @@ func generateMarkdown(env *sl.Env) string {
 			// Add table row
 			builder.WriteString(fmt.Sprintf("| %s | %s | %s |\n",
 				functionName, inputStr, outputStr))
+			i++
 		}
 	}
 
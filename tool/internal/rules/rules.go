@@ -0,0 +1,72 @@
+// Package rules finds the expressions of YAML rule files, so that the tools
+// formatting and evaluating them agree on where the expressions are.
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultKeys are the keys whose values are expressions, comma separated
+const DefaultKeys = "expression"
+
+// Expression is the string value of one of the keys
+type Expression struct {
+	// Path locates the value in the file, e.g. rules.r0.expression
+	Path  string
+	Key   *yaml.Node
+	Value *yaml.Node
+}
+
+// SplitKeys splits a comma separated list of keys
+func SplitKeys(keys string) []string {
+	var result []string
+	for _, key := range strings.Split(keys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// Find returns the string values of the keys in a parsed YAML file, in the
+// order of the file
+func Find(node *yaml.Node, keys []string) []Expression {
+	return find(node, keys, "")
+}
+
+func find(node *yaml.Node, keys []string, path string) []Expression {
+	var result []Expression
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			result = append(result, find(child, keys, path)...)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := strings.TrimPrefix(path+"."+key.Value, ".")
+			if value.Kind == yaml.ScalarNode && value.Tag == "!!str" && contains(keys, key.Value) {
+				result = append(result, Expression{Path: childPath, Key: key, Value: value})
+				continue
+			}
+			result = append(result, find(value, keys, childPath)...)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			result = append(result, find(child, keys, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return result
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package rules
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFind(t *testing.T) {
+	src := `
+rules:
+  r0:
+    expression: response.status == 200
+  r1:
+    expression: 1
+    check: request.method == "GET"
+list:
+  - expression: "true"
+`
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keys string
+		want []string
+	}{
+		// values that are not strings are not expressions
+		{keys: DefaultKeys, want: []string{"rules.r0.expression", "list[0].expression"}},
+		{keys: "expression, check", want: []string{"rules.r0.expression", "rules.r1.check", "list[0].expression"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range Find(&doc, SplitKeys(tt.keys)) {
+			got = append(got, e.Path)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("Find(%q): got %v, want %v", tt.keys, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Find(%q): got %v, want %v", tt.keys, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/lib/types"
+)
+
+// loadHAR returns the variables of each entry of a HAR file
+func loadHAR(path string) ([]traffic, error) {
+	entries, err := types.LoadHARFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]traffic, len(entries))
+	for i, e := range entries {
+		result[i] = traffic{
+			name:      fmt.Sprintf("entry %d", i),
+			variables: sl.Variables{"request": e.Request, "response": e.Response},
+		}
+	}
+	return result, nil
+}
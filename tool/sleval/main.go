@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+	"github.com/yywing/sl/tool/internal/rules"
+)
+
+var (
+	expr     = flag.String("e", "", "expression to evaluate")
+	rule     = flag.String("f", "", "rule file, an .sl file or a YAML file whose values of the -keys are evaluated")
+	request  = flag.String("request", "", "raw HTTP request file")
+	response = flag.String("response", "", "raw HTTP response file")
+	scheme   = flag.String("scheme", "http", "scheme of the raw HTTP request")
+	har      = flag.String("har", "", "HAR file, expressions are evaluated against each entry")
+	entry    = flag.Int("entry", -1, "index of the only HAR entry to use")
+	keys     = flag.String("keys", rules.DefaultKeys, "comma separated keys of the expressions in YAML files")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: sleval (-e EXPR | -f RULE) (-request FILE [-response FILE] | -har FILE)\n\n")
+	fmt.Fprintf(os.Stderr, "Evaluates expressions with the request and response variables built from\n")
+	fmt.Fprintf(os.Stderr, "recorded traffic, and prints the result and its type.\n\n")
+	flag.PrintDefaults()
+}
+
+// expression is an expression to evaluate, name tells where it comes from
+type expression struct {
+	name   string
+	source string
+}
+
+// traffic is a set of variables to evaluate the expressions with
+type traffic struct {
+	name      string
+	variables sl.Variables
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if (*expr == "") == (*rule == "") || (*request == "") == (*har == "") || flag.NArg() > 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	exprs, err := loadExpressions()
+	if err != nil {
+		fatal(err)
+	}
+	traffics, err := loadTraffic()
+	if err != nil {
+		fatal(err)
+	}
+
+	env := sl.NewStdEnv()
+	failed := false
+	for _, t := range traffics {
+		for _, e := range exprs {
+			name := strings.TrimSpace(t.name + " " + e.name)
+			if name != "" {
+				name += ": "
+			}
+			value, valueType, err := eval(env, e.source, t.variables)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s%s\n", name, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s%s : %s\n", name, value.String(), valueType.String())
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func eval(env *sl.Env, source string, variables sl.Variables) (ast.Value, ast.ValueType, error) {
+	node, err := sl.Parse(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s", sl.FormatError(source, err))
+	}
+	program := sl.NewProgram(node, variables.Type())
+	t, err := env.Check(program)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s", sl.FormatError(source, err))
+	}
+	value, err := env.Run(program, variables)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s", sl.FormatError(source, err))
+	}
+	return value, t, nil
+}
+
+func loadExpressions() ([]expression, error) {
+	if *expr != "" {
+		return []expression{{source: *expr}}, nil
+	}
+
+	src, err := os.ReadFile(*rule)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(*rule) {
+	case ".yaml", ".yml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(src, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", *rule, err)
+		}
+		var exprs []expression
+		for _, e := range rules.Find(&doc, rules.SplitKeys(*keys)) {
+			exprs = append(exprs, expression{name: e.Path, source: e.Value.Value})
+		}
+		if len(exprs) == 0 {
+			return nil, fmt.Errorf("%s: no expression found", *rule)
+		}
+		return exprs, nil
+	}
+	return []expression{{source: string(src)}}, nil
+}
+
+func loadTraffic() ([]traffic, error) {
+	if *har != "" {
+		traffics, err := loadHAR(*har)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", *har, err)
+		}
+		if *entry >= 0 {
+			if *entry >= len(traffics) {
+				return nil, fmt.Errorf("%s: no entry %d, found %d entries", *har, *entry, len(traffics))
+			}
+			traffics = traffics[*entry : *entry+1]
+		}
+		return traffics, nil
+	}
+
+	raw, err := os.ReadFile(*request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := types.NewHTTPRequestValueFromRaw(raw, *scheme)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", *request, err)
+	}
+	variables := sl.Variables{"request": req}
+
+	if *response != "" {
+		raw, err := os.ReadFile(*response)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := types.NewHTTPResponseValueFromRaw(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", *response, err)
+		}
+		variables["response"] = resp
+	}
+	return []traffic{{variables: variables}}, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/tool/internal/rules"
+)
+
+var (
+	list  = flag.Bool("l", false, "list files whose formatting differs from slfmt's")
+	write = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	diff  = flag.Bool("d", false, "display diffs instead of rewriting files")
+	width = flag.Int("width", 80, "maximum line width")
+	keys  = flag.String("keys", rules.DefaultKeys, "comma separated keys of the expressions in YAML files")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: slfmt [flags] [path ...]\n\n")
+	fmt.Fprintf(os.Stderr, "Formats .sl files and the expressions of .yaml and .yml rule files,\n")
+	fmt.Fprintf(os.Stderr, "directories are processed recursively. Without a path, stdin is\n")
+	fmt.Fprintf(os.Stderr, "formatted as an .sl file.\n\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "slfmt: cannot use -w with standard input")
+			os.Exit(2)
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = process("<standard input>", src, os.Stdout, ".sl")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isRuleFile(path) {
+				return nil
+			}
+			if err := processFile(path, os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func isRuleFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".sl", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+func processFile(path string, out io.Writer) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return process(path, src, out, filepath.Ext(path))
+}
+
+func process(path string, src []byte, out io.Writer, ext string) error {
+	var res []byte
+	var err error
+	if ext == ".sl" {
+		res, err = formatExpression(string(src))
+	} else {
+		res, err = formatYAML(src, rules.SplitKeys(*keys))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	changed := !bytes.Equal(src, res)
+	if *list && changed {
+		fmt.Fprintln(out, path)
+	}
+	if *write && changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if *diff && changed {
+		fmt.Fprint(out, unifiedDiff(path, string(src), string(res)))
+	}
+	if !*list && !*write && !*diff {
+		_, err = out.Write(res)
+	}
+	return err
+}
+
+// formatExpression formats the content of an .sl file
+func formatExpression(src string) ([]byte, error) {
+	res, err := sl.FormatSource(src, sl.FormatOptions{MaxWidth: *width})
+	if err != nil {
+		return nil, fmt.Errorf("%s", sl.FormatError(src, err))
+	}
+	return []byte(res + "\n"), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// setModes sets the -l, -w and -d flags for a test
+func setModes(t *testing.T, l, w, d bool) {
+	oldList, oldWrite, oldDiff := *list, *write, *diff
+	*list, *write, *diff = l, w, d
+	t.Cleanup(func() { *list, *write, *diff = oldList, oldWrite, oldDiff })
+}
+
+func checkGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: got\n%s\nwant\n%s", golden, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	setModes(t, false, false, false)
+	for _, path := range []string{"testdata/expr.sl", "testdata/rule.yaml"} {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := process(path, src, &out, filepath.Ext(path)); err != nil {
+			t.Fatalf("process(%s) error: %v", path, err)
+		}
+		checkGolden(t, path+".golden", out.Bytes())
+
+		// formatting is stable
+		var again bytes.Buffer
+		if err := process(path, out.Bytes(), &again, filepath.Ext(path)); err != nil {
+			t.Fatalf("process(%s.golden) error: %v", path, err)
+		}
+		if !bytes.Equal(again.Bytes(), out.Bytes()) {
+			t.Errorf("process(%s.golden): got\n%s\nwant\n%s", path, again.Bytes(), out.Bytes())
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	setModes(t, false, false, true)
+	path := "testdata/rule.yaml"
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := process(path, src, &out, ".yaml"); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, path+".diff", out.Bytes())
+}
+
+func TestListAndWrite(t *testing.T) {
+	src, err := os.ReadFile("testdata/rule.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("testdata/rule.yaml.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "rule.yaml")
+	if err := os.WriteFile(path, src, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// -l lists the file without changing it
+	setModes(t, true, false, false)
+	var out bytes.Buffer
+	if err := processFile(path, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != path+"\n" {
+		t.Errorf("-l: got %q, want %q", got, path+"\n")
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, src) {
+		t.Errorf("-l changed the file")
+	}
+
+	// -w rewrites the file and keeps its mode
+	setModes(t, false, true, false)
+	out.Reset()
+	if err := processFile(path, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("-w: got output %q", out.String())
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, want) {
+		t.Errorf("-w: got\n%s\nwant\n%s", got, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("-w: got mode %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	// a formatted file is not listed
+	setModes(t, true, false, false)
+	out.Reset()
+	if err := processFile(path, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("-l on a formatted file: got %q", out.String())
+	}
+}
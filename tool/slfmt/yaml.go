@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/tool/internal/rules"
+)
+
+// edit replaces the lines [start, end) of a file
+type edit struct {
+	start, end int
+	lines      []string
+}
+
+// formatYAML formats the expressions of a YAML rule file in place, only the
+// lines of the expressions are rewritten, the rest of the file is kept as is
+func formatYAML(src []byte, keys []string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(src), "\n")
+
+	var edits []edit
+	var errs []string
+	for _, expr := range rules.Find(&doc, keys) {
+		e, err := formatScalar(lines, expr.Key, expr.Value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %v", expr.Value.Line, err))
+			continue
+		}
+		if e != nil {
+			edits = append(edits, *e)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+
+	// apply from the end of the file so that line numbers stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		lines = append(lines[:e.start], append(e.lines, lines[e.end:]...)...)
+	}
+	res := []byte(strings.Join(lines, ""))
+
+	if err := verify(src, res, keys); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// formatScalar formats the expression of value, it returns nil if the
+// expression is already formatted
+func formatScalar(lines []string, key, value *yaml.Node) (*edit, error) {
+	line := value.Line - 1
+	if line >= len(lines) {
+		return nil, fmt.Errorf("invalid position")
+	}
+	text := []rune(strings.TrimRight(lines[line], "\r\n"))
+	column := value.Column - 1
+	if column > len(text) {
+		return nil, fmt.Errorf("invalid position")
+	}
+	prefix := string(text[:column])
+	keyIndent := key.Column - 1
+
+	if value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		// the content of block scalars follows the header line and is more
+		// indented than the key
+		end := line + 1
+		indent := -1
+		for i := line + 1; i < len(lines); i++ {
+			l := strings.TrimRight(lines[i], "\r\n")
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			n := len(l) - len(strings.TrimLeft(l, " "))
+			if n <= keyIndent {
+				break
+			}
+			if indent < 0 {
+				indent = n
+			}
+			end = i + 1
+		}
+		if indent < 0 {
+			indent = keyIndent + 2
+		}
+
+		formatted, err := format(value.Value, indent)
+		if err != nil {
+			return nil, err
+		}
+		header := string(text[column:])
+		if strings.HasPrefix(header, ">") && !foldable(formatted) {
+			// folding the lines would join a comment with the next line
+			header = "|" + header[1:]
+		}
+		result := []string{prefix + header + "\n"}
+		for _, l := range strings.Split(formatted, "\n") {
+			result = append(result, strings.Repeat(" ", indent)+l+"\n")
+		}
+		return changed(lines, edit{start: line, end: end, lines: result})
+	}
+
+	// flow scalars must be on a single line to be rewritten
+	rest := string(text[column:])
+	comment := ""
+	if value.LineComment != "" {
+		i := strings.LastIndex(rest, value.LineComment)
+		if i < 0 {
+			return nil, fmt.Errorf("cannot find comment %q", value.LineComment)
+		}
+		rest, comment = rest[:i], " "+value.LineComment
+	}
+	var parsed string
+	if err := yaml.Unmarshal([]byte(strings.TrimSpace(rest)), &parsed); err != nil || parsed != value.Value {
+		return nil, fmt.Errorf("cannot rewrite a multi-line expression that is not a block scalar")
+	}
+
+	formatted, err := format(value.Value, column)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(formatted, "\n") {
+		// wrapped expressions become block scalars
+		indent := keyIndent + 2
+		result := []string{prefix + "|-" + comment + "\n"}
+		for _, l := range strings.Split(formatted, "\n") {
+			result = append(result, strings.Repeat(" ", indent)+l+"\n")
+		}
+		return changed(lines, edit{start: line, end: line + 1, lines: result})
+	}
+
+	scalar := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: formatted, Style: value.Style}
+	out, err := yaml.Marshal(scalar)
+	if err != nil {
+		return nil, err
+	}
+	newline := lines[line][len(strings.TrimRight(lines[line], "\r\n")):]
+	result := []string{prefix + strings.TrimRight(string(out), "\n") + comment + newline}
+	return changed(lines, edit{start: line, end: line + 1, lines: result})
+}
+
+// format formats an expression written at the given column
+func format(expression string, column int) (string, error) {
+	w := *width - column
+	if w < 20 {
+		w = 20
+	}
+	res, err := sl.FormatSource(expression, sl.FormatOptions{MaxWidth: w})
+	if err != nil {
+		return "", fmt.Errorf("%s", sl.FormatError(expression, err))
+	}
+	return res, nil
+}
+
+// foldable reports whether a formatted expression keeps its meaning in a
+// folded scalar, whose lines are joined with spaces
+func foldable(formatted string) bool {
+	var b strings.Builder
+	b.WriteString(">-\n")
+	for _, l := range strings.Split(formatted, "\n") {
+		b.WriteString("  " + l + "\n")
+	}
+	var folded string
+	if err := yaml.Unmarshal([]byte(b.String()), &folded); err != nil {
+		return false
+	}
+	want, err := sl.Parse(formatted)
+	if err != nil {
+		return false
+	}
+	got, err := sl.Parse(folded)
+	return err == nil && got.String() == want.String()
+}
+
+func changed(lines []string, e edit) (*edit, error) {
+	if strings.Join(lines[e.start:e.end], "") == strings.Join(e.lines, "") {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// verify checks that the rewritten file has the same expressions
+func verify(src, res []byte, keys []string) error {
+	var before, after yaml.Node
+	if err := yaml.Unmarshal(src, &before); err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(res, &after); err != nil {
+		return fmt.Errorf("invalid YAML after formatting: %w", err)
+	}
+	want, got := rules.Find(&before, keys), rules.Find(&after, keys)
+	if len(want) != len(got) {
+		return fmt.Errorf("found %d expressions after formatting, want %d", len(got), len(want))
+	}
+	for i := range want {
+		w, err := sl.Parse(want[i].Value.Value)
+		if err != nil {
+			return err
+		}
+		g, err := sl.Parse(got[i].Value.Value)
+		if err != nil || g.String() != w.String() {
+			return fmt.Errorf("line %d: expression changed by formatting", want[i].Value.Line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yywing/sl"
+)
+
+var commands = []string{":functions", ":help", ":overloads", ":quit", ":request", ":response", ":type", ":vars", "let"}
+
+// members is implemented by selector types that know their members, e.g.
+// native.NativeSelectorType
+type members interface {
+	Members() []string
+}
+
+// complete completes the word before pos, it returns the new line and cursor
+// position, and the candidates for the word
+func (r *repl) complete(line string, pos int) (string, int, []string) {
+	start := pos
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	word := line[start:pos]
+
+	var candidates []string
+	partial := word
+	if start == 0 && strings.HasPrefix(word, ":") {
+		candidates = commands
+	} else if dot := strings.LastIndex(word, "."); dot > 0 {
+		// members of the value before the dot, or functions called on it
+		partial = word[dot+1:]
+		if t, _, err := r.check(word[:dot]); err == nil {
+			if m, ok := t.(members); ok {
+				candidates = m.Members()
+			}
+		}
+		if len(candidates) == 0 {
+			candidates = r.env.Functions()
+		}
+	} else {
+		for name := range r.vars {
+			candidates = append(candidates, name)
+		}
+		candidates = append(candidates, r.env.Functions()...)
+		for _, m := range sl.BuiltinMacros {
+			candidates = append(candidates, m.Name)
+		}
+		if start == 0 {
+			candidates = append(candidates, commands...)
+		}
+	}
+
+	var matches []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		// operators such as _+_ are not completed
+		if strings.HasPrefix(c, "_") || !strings.HasPrefix(c, partial) {
+			continue
+		}
+		if isIdentifier(c) || strings.HasPrefix(c, ":") {
+			if !seen[c] {
+				seen[c] = true
+				matches = append(matches, c)
+			}
+		}
+	}
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		return line, pos, nil
+	}
+
+	completion := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	newLine := line[:pos] + completion[len(partial):] + line[pos:]
+	return newLine, pos + len(completion) - len(partial), matches
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '.' || c == ':' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
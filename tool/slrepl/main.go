@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+const prompt = "sl> "
+
+func main() {
+	r := newREPL(os.Stdout)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		// read commands from a pipe, without line editing
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			if r.handle(scanner.Text()) {
+				return
+			}
+		}
+		return
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set terminal mode: %v\n", err)
+		os.Exit(1)
+	}
+	defer term.Restore(fd, state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	r.out = t
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		newLine, newPos, candidates := r.complete(line, pos)
+		if len(candidates) > 1 && newLine == line {
+			fmt.Fprintln(t, columns(candidates))
+		}
+		return newLine, newPos, true
+	}
+
+	fmt.Fprintln(t, "sl REPL, :help for commands, Ctrl-D to exit")
+	for {
+		line, err := t.ReadLine()
+		if err != nil {
+			return
+		}
+		if r.handle(line) {
+			return
+		}
+	}
+}
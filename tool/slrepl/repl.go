@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yywing/sl"
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+)
+
+const help = `let NAME = EXPR             evaluate EXPR and store the result in NAME
+:request NAME FILE [SCHEME] load a raw HTTP request dump into NAME (scheme http)
+:response NAME FILE         load a raw HTTP response dump into NAME
+:type EXPR                  print the type of EXPR without evaluating it
+:vars                       list variables and their types
+:functions [PREFIX]         list functions
+:overloads NAME             list the overloads of a function
+:help                       print this help
+:quit                       exit
+EXPR                        evaluate EXPR and print its value and type
+
+Tab completes function names, variables and members of selector types.`
+
+type repl struct {
+	env  *sl.Env
+	vars sl.Variables
+	out  io.Writer
+}
+
+func newREPL(out io.Writer) *repl {
+	return &repl{env: sl.NewStdEnv(), vars: sl.Variables{}, out: out}
+}
+
+// handle runs a line of input, it returns true to exit
+func (r *repl) handle(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	var err error
+	switch command {
+	case ":quit", ":q", ":exit":
+		return true
+	case ":help", ":h":
+		fmt.Fprintln(r.out, help)
+	case "let":
+		err = r.let(arg)
+	case ":request", ":response":
+		err = r.load(command == ":request", strings.Fields(arg))
+	case ":type", ":t":
+		var t ast.ValueType
+		if t, _, err = r.check(arg); err == nil {
+			fmt.Fprintln(r.out, t.String())
+		}
+	case ":vars":
+		r.listVariables()
+	case ":functions":
+		r.listFunctions(arg)
+	case ":overloads":
+		err = r.listOverloads(arg)
+	default:
+		if strings.HasPrefix(command, ":") {
+			err = fmt.Errorf("unknown command %s, :help for commands", command)
+			break
+		}
+		var value ast.Value
+		var t ast.ValueType
+		if value, t, err = r.eval(line); err == nil {
+			fmt.Fprintf(r.out, "%s : %s\n", value.String(), t.String())
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, err.Error())
+	}
+	return false
+}
+
+func (r *repl) check(expr string) (ast.ValueType, *sl.Program, error) {
+	node, err := sl.Parse(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s", sl.FormatError(expr, err))
+	}
+	program := sl.NewProgram(node, r.vars.Type())
+	t, err := r.env.Check(program)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s", sl.FormatError(expr, err))
+	}
+	return t, program, nil
+}
+
+func (r *repl) eval(expr string) (ast.Value, ast.ValueType, error) {
+	t, program, err := r.check(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := r.env.Run(program, r.vars)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s", sl.FormatError(expr, err))
+	}
+	return value, t, nil
+}
+
+func (r *repl) let(arg string) error {
+	name, expr, ok := strings.Cut(arg, "=")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !ok || !isIdentifier(name) || expr == "" {
+		return fmt.Errorf("usage: let NAME = EXPR")
+	}
+	value, t, err := r.eval(expr)
+	if err != nil {
+		return err
+	}
+	r.vars[name] = value
+	fmt.Fprintf(r.out, "%s = %s : %s\n", name, value.String(), t.String())
+	return nil
+}
+
+func (r *repl) load(request bool, args []string) error {
+	if len(args) < 2 || len(args) > 3 || (!request && len(args) > 2) || !isIdentifier(args[0]) {
+		if request {
+			return fmt.Errorf("usage: :request NAME FILE [SCHEME]")
+		}
+		return fmt.Errorf("usage: :response NAME FILE")
+	}
+	raw, err := os.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+
+	var value ast.Value
+	if request {
+		scheme := "http"
+		if len(args) == 3 {
+			scheme = args[2]
+		}
+		value, err = types.NewHTTPRequestValueFromRaw(raw, scheme)
+	} else {
+		value, err = types.NewHTTPResponseValueFromRaw(raw)
+	}
+	if err != nil {
+		return err
+	}
+	r.vars[args[0]] = value
+	fmt.Fprintf(r.out, "%s : %s\n", args[0], value.Type().String())
+	return nil
+}
+
+func (r *repl) listVariables() {
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%s : %s\n", name, r.vars[name].Type().String())
+	}
+}
+
+func (r *repl) listFunctions(prefix string) {
+	var names []string
+	for _, name := range r.env.Functions() {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Fprintln(r.out, columns(names))
+}
+
+func (r *repl) listOverloads(name string) error {
+	fn, ok := r.env.GetFunction(name)
+	if !ok {
+		return fmt.Errorf("function %s not found", name)
+	}
+	for _, t := range fn.Types() {
+		fmt.Fprintln(r.out, t.String())
+	}
+	return nil
+}
+
+// columns lays out names in columns of an 80 character wide terminal
+func columns(names []string) string {
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name)+2)
+	}
+	perLine := max(80/max(width, 1), 1)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 && i%perLine == 0 {
+			b.WriteString("\n")
+		}
+		if (i+1)%perLine == 0 || i == len(names)-1 {
+			b.WriteString(name)
+		} else {
+			fmt.Fprintf(&b, "%-*s", width, name)
+		}
+	}
+	return b.String()
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
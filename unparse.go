@@ -0,0 +1,656 @@
+package sl
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yywing/sl/ast"
+	"github.com/yywing/sl/lib/types"
+)
+
+// precedence of the grammar rules, from the loosest to the tightest
+const (
+	precConditional = iota + 1
+	precOr
+	precAnd
+	precRelation
+	precAdditive
+	precMultiplicative
+	precUnary
+	precMember
+)
+
+type operator struct {
+	symbol string
+	prec   int
+}
+
+var binaryOperators = map[string]operator{
+	ast.LogicalOr:     {"||", precOr},
+	ast.LogicalAnd:    {"&&", precAnd},
+	ast.Equals:        {"==", precRelation},
+	ast.NotEquals:     {"!=", precRelation},
+	ast.Less:          {"<", precRelation},
+	ast.LessEquals:    {"<=", precRelation},
+	ast.Greater:       {">", precRelation},
+	ast.GreaterEquals: {">=", precRelation},
+	ast.In:            {"in", precRelation},
+	ast.Add:           {"+", precAdditive},
+	ast.Subtract:      {"-", precAdditive},
+	ast.Multiply:      {"*", precMultiplicative},
+	ast.Divide:        {"/", precMultiplicative},
+	ast.Modulo:        {"%", precMultiplicative},
+}
+
+var unaryOperators = map[string]string{
+	ast.LogicalNot: "!",
+	ast.Negate:     "-",
+}
+
+// FormatOptions controls the layout of Format
+type FormatOptions struct {
+	// MaxWidth is the line width above which expressions are wrapped, 0 writes
+	// the expression on a single line
+	MaxWidth int
+	// Indent is the indentation of wrapped lines, two spaces if empty
+	Indent string
+}
+
+// Unparse writes the AST back as SL source on a single line. Operators are
+// written infix with only the parentheses needed to keep the tree, and the
+// comprehensions generated by macros are written as the macro call, so that
+// parsing the result gives the same AST.
+func Unparse(node ast.ASTNode) (string, error) {
+	return Format(node, FormatOptions{})
+}
+
+// Format is Unparse, wrapping lines longer than opts.MaxWidth: && and || chains
+// get one operand per line, and arguments, list elements and map entries are
+// put on their own lines.
+func Format(node ast.ASTNode, opts FormatOptions) (string, error) {
+	if opts.Indent == "" {
+		opts.Indent = "  "
+	}
+	u := &unparser{opts: opts}
+	return u.expr(node, 0)
+}
+
+type unparser struct {
+	opts FormatOptions
+
+	// set by FormatSource, comments are written before or after the node
+	// starting their line, nodes containing comments are always wrapped
+	comments map[ast.ASTNode]*nodeComments
+	wrapped  map[ast.ASTNode]bool
+	// set by FormatSource, string and bytes literals keep their quotes
+	source []rune
+}
+
+// expr writes node at the given indentation depth, wrapped if it does not fit
+func (u *unparser) expr(node ast.ASTNode, depth int) (string, error) {
+	if u.hasComments(node) {
+		return u.layout(node, depth)
+	}
+	flat, err := u.layout(node, -1)
+	if err != nil || u.opts.MaxWidth <= 0 {
+		return flat, err
+	}
+	width := utf8.RuneCountInString(u.opts.Indent)*depth + utf8.RuneCountInString(flat)
+	if width <= u.opts.MaxWidth {
+		return flat, nil
+	}
+	return u.layout(node, depth)
+}
+
+// layout writes node, on a single line when depth is negative
+func (u *unparser) layout(node ast.ASTNode, depth int) (string, error) {
+	switch n := node.(type) {
+	case *ast.LiteralNode:
+		if text, ok := u.literalSource(n); ok {
+			return text, nil
+		}
+		return unparseValue(n.Value)
+	case *ast.IdentNode:
+		if n.LeadingDot {
+			return "." + n.Name, nil
+		}
+		return n.Name, nil
+	case *ast.MemberAccessNode:
+		object, err := u.operand(n.Object, precMember, false, depth)
+		if err != nil {
+			return "", err
+		}
+		if n.Optional {
+			return object + ".?" + memberName(n.Member), nil
+		}
+		return object + "." + memberName(n.Member), nil
+	case *ast.FunctionCallNode:
+		return u.call(n, depth)
+	case *ast.IndexNode:
+		object, err := u.operand(n.Object, precMember, false, depth)
+		if err != nil {
+			return "", err
+		}
+		index, err := u.child(n.Index, depth)
+		if err != nil {
+			return "", err
+		}
+		if n.Optional {
+			return object + "[?" + index + "]", nil
+		}
+		return object + "[" + index + "]", nil
+	case *ast.ConditionalNode:
+		return u.conditional(n, depth)
+	case *ast.ListNode:
+		elems := make([]string, len(n.Elements))
+		for i, elem := range n.Elements {
+			s, err := u.child(elem, nested(depth))
+			if err != nil {
+				return "", err
+			}
+			if n.IsOptional(i) {
+				s = "?" + s
+			}
+			elems[i] = s
+		}
+		return u.list("[", elems, n.Elements, "]", depth), nil
+	case *ast.MapNode:
+		entries := make([]string, len(n.Entries))
+		keys := make([]ast.ASTNode, len(n.Entries))
+		for i, entry := range n.Entries {
+			key, err := u.child(entry.Key, nested(depth))
+			if err != nil {
+				return "", err
+			}
+			value, err := u.child(entry.Value, nested(depth))
+			if err != nil {
+				return "", err
+			}
+			if entry.Optional {
+				key = "?" + key
+			}
+			entries[i] = key + ": " + value
+			keys[i] = entry.Key
+		}
+		return u.list("{", entries, keys, "}", depth), nil
+	case *ast.StructNode:
+		fields := make([]string, len(n.Fields))
+		values := make([]ast.ASTNode, len(n.Fields))
+		for i, field := range n.Fields {
+			value, err := u.child(field.Value, nested(depth))
+			if err != nil {
+				return "", err
+			}
+			name := memberName(field.Name)
+			if field.Optional {
+				name = "?" + name
+			}
+			fields[i] = name + ": " + value
+			values[i] = field.Value
+		}
+		typeName := n.TypeName
+		if n.ReceiverStyle {
+			typeName = "." + typeName
+		}
+		return u.list(typeName+"{", fields, values, "}", depth), nil
+	case *ast.ComprehensionNode:
+		target, name, args, ok := macroCall(n)
+		if !ok {
+			return "", fmt.Errorf("cannot unparse comprehension %s", n.String())
+		}
+		return u.method(target, name, args, depth)
+	case *ast.BindNode:
+		return u.args(MacroBind, []ast.ASTNode{ast.NewIdent(n.Name, false), n.Init, n.Result}, depth)
+	case *ast.PresenceTestNode:
+		member, err := u.layout(ast.NewMemberAccess(n.Object, n.Member, false), depth)
+		if err != nil {
+			return "", err
+		}
+		return MacroHas + "(" + member + ")", nil
+	}
+	return "", fmt.Errorf("cannot unparse node %T", node)
+}
+
+// child writes a node that does not need parentheses, e.g. an argument
+func (u *unparser) child(node ast.ASTNode, depth int) (string, error) {
+	if depth < 0 {
+		return u.layout(node, -1)
+	}
+	return u.expr(node, depth)
+}
+
+// operand writes node as an operand of an operator of precedence prec, in
+// parentheses if it binds looser, or as tight on the right of a left
+// associative operator
+func (u *unparser) operand(node ast.ASTNode, prec int, right bool, depth int) (string, error) {
+	s, err := u.child(node, depth)
+	if err != nil {
+		return "", err
+	}
+	p := precedenceOf(node)
+	if p < prec || (p == prec && right) {
+		return "(" + s + ")", nil
+	}
+	return s, nil
+}
+
+func (u *unparser) call(n *ast.FunctionCallNode, depth int) (string, error) {
+	switch fn := n.Function.(type) {
+	case *ast.MemberAccessNode:
+		if fn.Optional {
+			return "", fmt.Errorf("cannot unparse optional method call %s", n.String())
+		}
+		return u.method(fn.Object, fn.Member, n.Args, depth)
+	case *ast.IdentNode:
+		if op, ok := binaryOperators[fn.Name]; ok && len(n.Args) == 2 {
+			return u.binary(n, op, depth)
+		}
+		if op, ok := unaryOperators[fn.Name]; ok && len(n.Args) == 1 {
+			arg := n.Args[0]
+			// repeated operators are written together, e.g. !!x
+			if inner, ok := arg.(*ast.FunctionCallNode); ok && callee(inner) == fn.Name && len(inner.Args) == 1 {
+				s, err := u.child(arg, depth)
+				return op + s, err
+			}
+			// -(1) is not written -1, which is the literal
+			if lit, ok := arg.(*ast.LiteralNode); ok && fn.Name == ast.Negate && isNumber(lit.Value) {
+				s, err := u.child(arg, depth)
+				return op + "(" + s + ")", err
+			}
+			s, err := u.operand(arg, precMember, false, depth)
+			return op + s, err
+		}
+		if strings.HasPrefix(fn.Name, "_") && strings.HasSuffix(fn.Name, "_") {
+			return "", fmt.Errorf("cannot unparse operator %s with %d arguments", fn.Name, len(n.Args))
+		}
+		if fn.LeadingDot {
+			return u.args("."+fn.Name, n.Args, depth)
+		}
+		return u.args(fn.Name, n.Args, depth)
+	}
+	return "", fmt.Errorf("cannot unparse call of %s", n.Function.String())
+}
+
+func (u *unparser) binary(n *ast.FunctionCallNode, op operator, depth int) (string, error) {
+	// && and || chains are wrapped with one operand per line
+	if depth >= 0 && (op.prec == precOr || op.prec == precAnd) {
+		operands := chain(n, callee(n))
+		lines := make([]string, len(operands))
+		for i, operand := range operands {
+			s, err := u.operand(operand, op.prec, i > 0, depth+1)
+			if err != nil {
+				return "", err
+			}
+			if i > 0 {
+				s = u.indent(depth+1) + op.symbol + " " + s
+			}
+			lines[i] = u.commented(operand, s, depth+1, i == 0)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	left, err := u.operand(n.Args[0], op.prec, false, depth)
+	if err != nil {
+		return "", err
+	}
+	right, err := u.operand(n.Args[1], op.prec, true, depth)
+	if err != nil {
+		return "", err
+	}
+	return left + " " + op.symbol + " " + right, nil
+}
+
+func (u *unparser) conditional(n *ast.ConditionalNode, depth int) (string, error) {
+	cond, err := u.operand(n.Condition, precOr, false, depth)
+	if err != nil {
+		return "", err
+	}
+	inner := nested(depth)
+	trueExpr, err := u.operand(n.TrueExpr, precOr, false, inner)
+	if err != nil {
+		return "", err
+	}
+	falseExpr, err := u.operand(n.FalseExpr, precConditional, false, inner)
+	if err != nil {
+		return "", err
+	}
+	if depth < 0 {
+		return cond + " ? " + trueExpr + " : " + falseExpr, nil
+	}
+	return u.commented(n.Condition, cond, depth, true) +
+		"\n" + u.commented(n.TrueExpr, u.indent(inner)+"? "+trueExpr, inner, false) +
+		"\n" + u.commented(n.FalseExpr, u.indent(inner)+": "+falseExpr, inner, false), nil
+}
+
+func (u *unparser) method(target ast.ASTNode, name string, args []ast.ASTNode, depth int) (string, error) {
+	object, err := u.operand(target, precMember, false, depth)
+	if err != nil {
+		return "", err
+	}
+	return u.args(object+"."+name, args, depth)
+}
+
+func (u *unparser) args(prefix string, args []ast.ASTNode, depth int) (string, error) {
+	// the call may be wrapped for its receiver, keep the arguments on the line
+	// of the receiver if they fit
+	if depth >= 0 && u.opts.MaxWidth > 0 && !u.anyComments(args) {
+		flat, err := u.args(prefix, args, -1)
+		if err != nil {
+			return "", err
+		}
+		lines := strings.Split(flat, "\n")
+		width := utf8.RuneCountInString(lines[len(lines)-1])
+		if len(lines) == 1 {
+			width += utf8.RuneCountInString(u.opts.Indent) * depth
+		}
+		if width <= u.opts.MaxWidth {
+			return flat, nil
+		}
+	}
+
+	items := make([]string, len(args))
+	for i, arg := range args {
+		s, err := u.child(arg, nested(depth))
+		if err != nil {
+			return "", err
+		}
+		items[i] = s
+	}
+	return u.list(prefix+"(", items, args, ")", depth), nil
+}
+
+// list joins items, one per line when wrapped, nodes are the nodes of the items
+// for their comments
+func (u *unparser) list(open string, items []string, nodes []ast.ASTNode, close string, depth int) string {
+	if depth < 0 || len(items) == 0 {
+		return open + strings.Join(items, ", ") + close
+	}
+	var b strings.Builder
+	b.WriteString(open)
+	for i, item := range items {
+		line := u.indent(depth+1) + item
+		if i < len(items)-1 {
+			line += ","
+		}
+		b.WriteString("\n")
+		b.WriteString(u.commented(nodes[i], line, depth+1, false))
+	}
+	b.WriteString("\n")
+	b.WriteString(u.indent(depth))
+	b.WriteString(close)
+	return b.String()
+}
+
+// nested returns the depth of the children of a node at depth
+func nested(depth int) int {
+	if depth < 0 {
+		return depth
+	}
+	return depth + 1
+}
+
+func (u *unparser) indent(depth int) string {
+	return strings.Repeat(u.opts.Indent, depth)
+}
+
+// chain returns the operands of a left associative chain of op, a && b && c
+// is _&&_(_&&_(a, b), c)
+func chain(node ast.ASTNode, op string) []ast.ASTNode {
+	n, ok := node.(*ast.FunctionCallNode)
+	if !ok || callee(n) != op || len(n.Args) != 2 {
+		return []ast.ASTNode{node}
+	}
+	return append(chain(n.Args[0], op), n.Args[1])
+}
+
+// callee returns the name of a global function call
+func callee(n *ast.FunctionCallNode) string {
+	if ident, ok := n.Function.(*ast.IdentNode); ok && !ident.LeadingDot {
+		return ident.Name
+	}
+	return ""
+}
+
+func precedenceOf(node ast.ASTNode) int {
+	switch n := node.(type) {
+	case *ast.ConditionalNode:
+		return precConditional
+	case *ast.FunctionCallNode:
+		name := callee(n)
+		if op, ok := binaryOperators[name]; ok && len(n.Args) == 2 {
+			return op.prec
+		}
+		if _, ok := unaryOperators[name]; ok && len(n.Args) == 1 {
+			return precUnary
+		}
+	case *ast.LiteralNode:
+		// negative numbers are written with a sign
+		switch v := n.Value.(type) {
+		case *ast.IntValue:
+			if v.IntValue < 0 {
+				return precUnary
+			}
+		case *ast.DoubleValue:
+			if math.Signbit(v.DoubleValue) || math.IsNaN(v.DoubleValue) || math.IsInf(v.DoubleValue, 0) {
+				return precUnary
+			}
+		}
+	}
+	return precMember
+}
+
+// macroCall matches the comprehensions generated by the builtin macros
+func macroCall(n *ast.ComprehensionNode) (ast.ASTNode, string, []ast.ASTNode, bool) {
+	if n.AccuVar != AccumulatorName {
+		return nil, "", nil, false
+	}
+	iterVar := ast.NewIdent(n.IterVar, false)
+
+	switch {
+	// all: true, @result, @result && p, @result
+	case isBool(n.AccuInit, true) && isAccu(n.LoopCondition) && isAccu(n.Result):
+		if args, ok := callArgs(n.LoopStep, ast.LogicalAnd); ok && isAccu(args[0]) {
+			return n.IterRange, MacroAll, []ast.ASTNode{iterVar, args[1]}, true
+		}
+	// exists: false, !@result, @result || p, @result
+	case isBool(n.AccuInit, false) && isAccu(n.Result):
+		cond, ok := callArgs(n.LoopCondition, ast.LogicalNot)
+		if !ok || !isAccu(cond[0]) {
+			break
+		}
+		if args, ok := callArgs(n.LoopStep, ast.LogicalOr); ok && isAccu(args[0]) {
+			return n.IterRange, MacroExists, []ast.ASTNode{iterVar, args[1]}, true
+		}
+	// exists_one: 0, true, p ? @result + 1 : @result, @result == 1
+	case isInt(n.AccuInit, 0) && isBool(n.LoopCondition, true):
+		result, ok := callArgs(n.Result, ast.Equals)
+		if !ok || !isAccu(result[0]) || !isInt(result[1], 1) {
+			break
+		}
+		step, ok := n.LoopStep.(*ast.ConditionalNode)
+		if !ok || !isAccu(step.FalseExpr) {
+			break
+		}
+		if add, ok := callArgs(step.TrueExpr, ast.Add); ok && isAccu(add[0]) && isInt(add[1], 1) {
+			return n.IterRange, MacroExistsOne, []ast.ASTNode{iterVar, step.Condition}, true
+		}
+	// map and filter: [], true, step, @result
+	case isEmptyList(n.AccuInit) && isBool(n.LoopCondition, true) && isAccu(n.Result):
+		// @result + [t]
+		if t, ok := appendedElement(n.LoopStep); ok {
+			return n.IterRange, MacroMap, []ast.ASTNode{iterVar, t}, true
+		}
+		// p ? @result + [t] : @result
+		step, ok := n.LoopStep.(*ast.ConditionalNode)
+		if !ok || !isAccu(step.FalseExpr) {
+			break
+		}
+		t, ok := appendedElement(step.TrueExpr)
+		if !ok {
+			break
+		}
+		if ident, ok := t.(*ast.IdentNode); ok && !ident.LeadingDot && ident.Name == n.IterVar {
+			return n.IterRange, MacroFilter, []ast.ASTNode{iterVar, step.Condition}, true
+		}
+		return n.IterRange, MacroMap, []ast.ASTNode{iterVar, step.Condition, t}, true
+	}
+	return nil, "", nil, false
+}
+
+func callArgs(node ast.ASTNode, name string) ([]ast.ASTNode, bool) {
+	n, ok := node.(*ast.FunctionCallNode)
+	if !ok || callee(n) != name {
+		return nil, false
+	}
+	if _, binary := binaryOperators[name]; binary && len(n.Args) != 2 {
+		return nil, false
+	}
+	if _, unary := unaryOperators[name]; unary && len(n.Args) != 1 {
+		return nil, false
+	}
+	return n.Args, true
+}
+
+// appendedElement matches @result + [t]
+func appendedElement(node ast.ASTNode) (ast.ASTNode, bool) {
+	args, ok := callArgs(node, ast.Add)
+	if !ok || !isAccu(args[0]) {
+		return nil, false
+	}
+	list, ok := args[1].(*ast.ListNode)
+	if !ok || len(list.Elements) != 1 || list.IsOptional(0) {
+		return nil, false
+	}
+	return list.Elements[0], true
+}
+
+func isAccu(node ast.ASTNode) bool {
+	ident, ok := node.(*ast.IdentNode)
+	return ok && !ident.LeadingDot && ident.Name == AccumulatorName
+}
+
+func isBool(node ast.ASTNode, b bool) bool {
+	lit, ok := node.(*ast.LiteralNode)
+	if !ok {
+		return false
+	}
+	v, ok := lit.Value.(*ast.BoolValue)
+	return ok && v.BoolValue == b
+}
+
+func isInt(node ast.ASTNode, i int64) bool {
+	lit, ok := node.(*ast.LiteralNode)
+	if !ok {
+		return false
+	}
+	v, ok := lit.Value.(*ast.IntValue)
+	return ok && v.IntValue == i
+}
+
+func isEmptyList(node ast.ASTNode) bool {
+	list, ok := node.(*ast.ListNode)
+	return ok && len(list.Elements) == 0
+}
+
+func isNumber(v ast.Value) bool {
+	switch v.(type) {
+	case *ast.IntValue, *ast.UintValue, *ast.DoubleValue:
+		return true
+	}
+	return false
+}
+
+// memberName escapes names that are not identifiers with backquotes, names
+// parsed from escaped identifiers keep them
+func memberName(name string) string {
+	if isIdentifier(name) || (len(name) > 2 && strings.HasPrefix(name, "`") && strings.HasSuffix(name, "`")) {
+		return name
+	}
+	return "`" + name + "`"
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// unparseValue writes a value as a literal, regexes are written as their pattern
+func unparseValue(v ast.Value) (string, error) {
+	switch v := v.(type) {
+	case *ast.BoolValue:
+		return strconv.FormatBool(v.BoolValue), nil
+	case *ast.IntValue:
+		return strconv.FormatInt(v.IntValue, 10), nil
+	case *ast.UintValue:
+		return strconv.FormatUint(v.UintValue, 10) + "u", nil
+	case *ast.DoubleValue:
+		d := v.DoubleValue
+		if math.IsNaN(d) || math.IsInf(d, 0) {
+			return fmt.Sprintf("%s(%q)", ast.Double, strconv.FormatFloat(d, 'g', -1, 64)), nil
+		}
+		s := strconv.FormatFloat(d, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	case *ast.StringValue:
+		return quote(v.StringValue), nil
+	case *ast.BytesValue:
+		return "b" + quoteBytes(v.BytesValue), nil
+	case *ast.NullValue:
+		return "null", nil
+	case *types.RegexValue:
+		return quote(v.Pattern), nil
+	}
+	return "", fmt.Errorf("cannot unparse value of type %s", v.Type().String())
+}
+
+var escapes = map[rune]string{
+	'\a': `\a`, '\b': `\b`, '\f': `\f`, '\n': `\n`, '\r': `\r`, '\t': `\t`,
+	'\v': `\v`, '"': `\"`, '\\': `\\`,
+}
+
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if e, ok := escapes[r]; ok {
+			b.WriteString(e)
+		} else if strconv.IsPrint(r) {
+			b.WriteRune(r)
+		} else if r < 0x10000 {
+			fmt.Fprintf(&b, `\u%04x`, r)
+		} else {
+			fmt.Fprintf(&b, `\U%08x`, r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func quoteBytes(bs []byte) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range bs {
+		if e, ok := escapes[rune(c)]; ok {
+			b.WriteString(e)
+		} else if c >= 0x20 && c < 0x7f {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -14,3 +14,34 @@ func (v Variables) Type() VariablesType {
 	}
 	return t
 }
+
+// SizedType declares a variable with the sizes used to estimate the cost of
+// programs, strings, bytes, lists and maps without a size have an unknown size
+type SizedType struct {
+	ast.ValueType
+	size    ast.SizeEstimate
+	members map[string]ast.SizeEstimate
+}
+
+// NewSizedType declares a variable of type t whose value has a size in size
+func NewSizedType(t ast.ValueType, size ast.SizeEstimate) *SizedType {
+	return &SizedType{ValueType: t, size: size}
+}
+
+// WithMemberSize sets the size of a member of the variable by its path, like
+// "body" for response.body
+func (t *SizedType) WithMemberSize(path string, size ast.SizeEstimate) *SizedType {
+	if t.members == nil {
+		t.members = make(map[string]ast.SizeEstimate)
+	}
+	t.members[path] = size
+	return t
+}
+
+// declaredType returns the type of a declared variable without its sizes
+func declaredType(t ast.ValueType) ast.ValueType {
+	if sized, ok := t.(*SizedType); ok {
+		return sized.ValueType
+	}
+	return t
+}